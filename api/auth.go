@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/pixperk/chug/internal/config"
+	"go.uber.org/zap"
+)
+
+const tokenHashPrefix = "sha256:"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Method string `json:"method"` // token, jwt, or none when auth is disabled
+}
+
+// anonymous is the caller of every request while auth is disabled
+var anonymous = &Principal{Name: "anonymous", Role: config.RoleOperator, Method: "none"}
+
+type principalKey struct{}
+
+// principalFrom returns the caller attached to the request by protect
+func principalFrom(r *http.Request) *Principal {
+	if p, ok := r.Context().Value(principalKey{}).(*Principal); ok {
+		return p
+	}
+	return anonymous
+}
+
+type staticToken struct {
+	name string
+	hash []byte
+	role string
+}
+
+// authenticator checks static tokens and JWTs presented as bearer tokens
+type authenticator struct {
+	tokens []staticToken
+	jwt    *jwtVerifier
+}
+
+// newAuthenticator returns nil when no tokens or JWKS file are configured
+func newAuthenticator(cfg config.AuthConfig) (*authenticator, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	a := &authenticator{}
+	for _, t := range cfg.Tokens {
+		if t.Role != config.RoleReadOnly && t.Role != config.RoleOperator {
+			return nil, fmt.Errorf("token %q: unknown role %q (want read_only or operator)", t.Name, t.Role)
+		}
+		if !strings.HasPrefix(t.Hash, tokenHashPrefix) {
+			return nil, fmt.Errorf("token %q: hash must start with %q", t.Name, tokenHashPrefix)
+		}
+		hash, err := hex.DecodeString(strings.TrimPrefix(t.Hash, tokenHashPrefix))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("token %q: invalid sha256 hash", t.Name)
+		}
+		a.tokens = append(a.tokens, staticToken{name: t.Name, hash: hash, role: t.Role})
+	}
+
+	if cfg.JWT != nil {
+		verifier, err := newJWTVerifier(*cfg.JWT)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = verifier
+	}
+	return a, nil
+}
+
+// HashToken returns the form of an API token stored in the config
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return tokenHashPrefix + hex.EncodeToString(sum[:])
+}
+
+func (a *authenticator) authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, errors.New("missing bearer token")
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(sum[:], t.hash) == 1 {
+			return &Principal{Name: t.name, Role: t.role, Method: "token"}, nil
+		}
+	}
+
+	if a.jwt != nil && strings.Count(token, ".") == 2 {
+		return a.jwt.Verify(token)
+	}
+	return nil, errors.New("invalid token")
+}
+
+// bearerToken reads the token from the Authorization header. Browsers cannot
+// set headers on WebSocket and EventSource requests, so GET requests may pass
+// it as ?access_token= instead.
+func bearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if r.Method == http.MethodGet {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// protect wraps h so GET requests need at least the read-only role and
+// everything else needs the operator role
+func (s *Server) protect(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil {
+			h(w, r)
+			return
+		}
+
+		principal, err := s.auth.authenticate(r)
+		if err != nil {
+			s.audit(r, "auth_failed", zap.Error(err))
+			w.Header().Set("WWW-Authenticate", `Bearer realm="chug"`)
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Unauthorized")
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && principal.Role != config.RoleOperator {
+			r = r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+			s.audit(r, "forbidden")
+			writeError(w, http.StatusForbidden, CodeForbidden, "Forbidden: operator role required")
+			return
+		}
+
+		h(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// checkOrigin decides which browser origins may open a WebSocket. Without an
+// allow-list any origin is accepted while auth is disabled, and only the
+// server's own origin once auth is enabled.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Not a browser, so there is no cross-site request to guard against
+		return true
+	}
+
+	allowed := s.config.Server.Auth.AllowedOrigins
+	if len(allowed) > 0 {
+		return slices.Contains(allowed, "*") || slices.Contains(allowed, origin)
+	}
+	if s.auth == nil {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// audit records who did what. Entries go to the audit log if one is configured.
+func (s *Server) audit(r *http.Request, action string, fields ...zap.Field) {
+	p := principalFrom(r)
+	s.auditLog.Info("audit",
+		append([]zap.Field{
+			zap.String("action", action),
+			zap.String("principal", p.Name),
+			zap.String("role", p.Role),
+			zap.String("auth_method", p.Method),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("path", r.URL.Path),
+		}, fields...)...)
+}
+
+// newAuditLogger writes audit entries as JSON lines to path, or to logger when path is empty
+func newAuditLogger(path string, logger *zap.Logger) (*zap.Logger, error) {
+	if path == "" {
+		return logger.Named("audit"), nil
+	}
+	cfg := zap.NewProductionConfig()
+	cfg.OutputPaths = []string{path}
+	cfg.Sampling = nil
+	auditLogger, err := cfg.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return auditLogger.Named("audit"), nil
+}
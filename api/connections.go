@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/pixperk/chug/api/types"
+	"github.com/pixperk/chug/internal/config"
+)
+
+type (
+	ConnectionInfo      = types.ConnectionInfo
+	ConnectionsResponse = types.ConnectionsResponse
+)
+
+func (s *Server) handleListConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	connections := make([]ConnectionInfo, 0, len(s.config.Connections))
+	for name, profile := range s.config.Connections {
+		connections = append(connections, ConnectionInfo{
+			Name:    name,
+			Type:    profile.Type,
+			Default: name == s.config.PostgresConnection || name == s.config.ClickHouseConnection,
+		})
+	}
+	sort.Slice(connections, func(i, j int) bool {
+		return connections[i].Name < connections[j].Name
+	})
+
+	writeJSON(w, http.StatusOK, ConnectionsResponse{
+		Connections:    connections,
+		RawURLsAllowed: s.config.RawURLsAllowed(),
+	})
+}
+
+// resolveConnection returns the URL for a request that names a connection
+// profile or carries a raw URL, falling back to the server default for kind
+func (s *Server) resolveConnection(name, rawURL, kind string) (string, error) {
+	switch {
+	case name != "" && rawURL != "":
+		return "", fmt.Errorf("pass either a %s connection name or a URL, not both", kind)
+	case name != "":
+		profile, err := s.config.Profile(name, kind)
+		if err != nil {
+			return "", err
+		}
+		return profile.URL, nil
+	case rawURL != "":
+		if !s.config.RawURLsAllowed() {
+			return "", fmt.Errorf("%s URLs are not accepted by this server, reference a connection by name (see GET /api/v1/connections)", kind)
+		}
+		return rawURL, nil
+	case kind == config.ConnectionPostgres:
+		return s.config.PostgresURL, nil
+	default:
+		return s.config.ClickHouseURL, nil
+	}
+}
+
+// validateConnections checks the connections of an ingest request before a job is started
+func (s *Server) validateConnections(req IngestRequest) error {
+	if _, err := s.resolveConnection(req.PgConnection, req.PgURL, config.ConnectionPostgres); err != nil {
+		return err
+	}
+	_, err := s.resolveConnection(req.ChConnection, req.ChURL, config.ConnectionClickHouse)
+	return err
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/pixperk/chug/api/types"
+	"github.com/pixperk/chug/internal/etl"
+	"go.uber.org/zap"
+)
+
+// errJobCancelled is the cancellation cause for jobs and tables stopped through the API
+var errJobCancelled = errors.New("cancelled by user")
+
+// errServerShutdown is the cancellation cause for jobs stopped by a server
+// shutdown. Unlike errJobCancelled it keeps CDC pollers recorded, so they are
+// re-attached on the next start.
+var errServerShutdown = errors.New("server shutting down")
+
+// tableRun is the cancel function and pause control of one active table of a job
+type tableRun struct {
+	cancel  context.CancelCauseFunc
+	control *etl.Control
+}
+
+type JobActionResponse = types.JobActionResponse
+
+// contextLocked returns the context shared by every table of the job. Caller holds j.mu.
+func (j *IngestionJob) contextLocked() context.Context {
+	if j.ctx == nil {
+		j.ctx, j.cancel = context.WithCancelCause(context.Background())
+	}
+	return j.ctx
+}
+
+// activeLocked reports whether the job is still loading or has running pollers
+func (j *IngestionJob) activeLocked() bool {
+	return j.EndTime == nil || len(j.runs) > 0
+}
+
+// finishedStatusLocked is the status of a job whose initial load has ended
+func (j *IngestionJob) finishedStatusLocked() string {
+	for _, result := range j.Results {
+		if !result.Success {
+			return "failed"
+		}
+	}
+	return "completed"
+}
+
+// tableContext derives a cancellable context and pause control for a table.
+// Tables started while the job is paused start paused.
+func (s *Server) tableContext(job *IngestionJob, ctx context.Context, table string) (context.Context, *etl.Control) {
+	tableCtx, cancel := context.WithCancelCause(ctx)
+	control := etl.NewControl()
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.Status == "paused" {
+		control.Pause()
+	}
+	if job.runs == nil {
+		job.runs = make(map[string]*tableRun)
+	}
+	job.runs[table] = &tableRun{cancel: cancel, control: control}
+	return tableCtx, control
+}
+
+// finishTable releases the context of a table that is no longer active and
+// forgets its run
+func (s *Server) finishTable(jobID, table string) {
+	jobValue, ok := s.jobs.Load(jobID)
+	if !ok {
+		return
+	}
+	job := jobValue.(*IngestionJob)
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if run, ok := job.runs[table]; ok {
+		run.cancel(nil)
+	}
+	delete(job.runs, table)
+}
+
+// tableControl returns the pause control of an active table, nil if there is none
+func (s *Server) tableControl(jobID, table string) *etl.Control {
+	jobValue, ok := s.jobs.Load(jobID)
+	if !ok {
+		return nil
+	}
+	job := jobValue.(*IngestionJob)
+	job.mu.RLock()
+	defer job.mu.RUnlock()
+	if run, ok := job.runs[table]; ok {
+		return run.control
+	}
+	return nil
+}
+
+// handleJobAction serves POST /api/v1/jobs/{id}/cancel, /pause, /resume and /retry.
+// An optional ?table= applies the action to a single table of the job.
+func (s *Server) handleJobAction(w http.ResponseWriter, r *http.Request, jobID, action string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	jobValue, ok := s.jobs.Load(jobID)
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Job not found")
+		return
+	}
+	job := jobValue.(*IngestionJob)
+	if action == "retry" {
+		s.handleRetryJob(w, r, job)
+		return
+	}
+	table := r.URL.Query().Get("table")
+
+	var event, message string
+	var status int
+	var err error
+	switch action {
+	case "cancel":
+		event, message = "cancelled", "Cancelled by user"
+		status, err = s.cancelJob(job, table)
+	case "pause":
+		event, message = "paused", "Paused by user"
+		status, err = s.pauseJob(job, table)
+	case "resume":
+		event, message = "resumed", "Resumed by user"
+		status, err = s.resumeJob(job, table)
+	default:
+		writeError(w, http.StatusNotFound, CodeNotFound, fmt.Sprintf("Unknown job action: %s", action))
+		return
+	}
+	if err != nil {
+		writeError(w, status, codeForStatus(status), err.Error())
+		return
+	}
+
+	s.audit(r, "job_"+event, zap.String("job_id", jobID), zap.String("table", table))
+
+	s.saveJob(job)
+	s.sendUpdate(ProgressUpdate{
+		JobID:     jobID,
+		Table:     table,
+		Event:     event,
+		Message:   message,
+		Timestamp: time.Now(),
+	})
+
+	job.mu.RLock()
+	response := JobActionResponse{JobID: jobID, Table: table, Status: job.Status}
+	job.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) cancelJob(job *IngestionJob, table string) (int, error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if table != "" {
+		run, ok := job.runs[table]
+		if !ok {
+			return http.StatusConflict, fmt.Errorf("table %s is not running", table)
+		}
+		run.cancel(errJobCancelled)
+		delete(job.runs, table)
+		return 0, nil
+	}
+
+	if !job.activeLocked() {
+		return http.StatusConflict, errors.New("job is not running")
+	}
+
+	job.contextLocked()
+	job.cancel(errJobCancelled)
+	job.cancelled = true
+	job.runs = nil
+	if job.EndTime == nil {
+		// runIngestion sets the final status once every table has stopped
+		job.Status = "cancelling"
+	} else {
+		job.Status = "cancelled"
+	}
+	return 0, nil
+}
+
+func (s *Server) pauseJob(job *IngestionJob, table string) (int, error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if table != "" {
+		run, ok := job.runs[table]
+		if !ok {
+			return http.StatusConflict, fmt.Errorf("table %s is not running", table)
+		}
+		if !run.control.Pause() {
+			return http.StatusConflict, fmt.Errorf("table %s is already paused", table)
+		}
+		return 0, nil
+	}
+
+	if !job.activeLocked() || job.cancelled {
+		return http.StatusConflict, errors.New("job is not running")
+	}
+	if job.Status == "paused" {
+		return http.StatusConflict, errors.New("job is already paused")
+	}
+
+	job.Status = "paused"
+	for _, run := range job.runs {
+		run.control.Pause()
+	}
+	return 0, nil
+}
+
+func (s *Server) resumeJob(job *IngestionJob, table string) (int, error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if table != "" {
+		run, ok := job.runs[table]
+		if !ok {
+			return http.StatusConflict, fmt.Errorf("table %s is not running", table)
+		}
+		if !run.control.Resume() {
+			return http.StatusConflict, fmt.Errorf("table %s is not paused", table)
+		}
+		return 0, nil
+	}
+
+	if job.Status != "paused" {
+		return http.StatusConflict, errors.New("job is not paused")
+	}
+
+	if job.EndTime == nil {
+		job.Status = "running"
+	} else {
+		job.Status = job.finishedStatusLocked()
+	}
+	for _, run := range job.runs {
+		run.control.Resume()
+	}
+	return 0, nil
+}
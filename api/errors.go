@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pixperk/chug/api/types"
+)
+
+// Error codes of ErrorResponse. Clients should branch on the code, the
+// message is for humans and may change.
+const (
+	CodeInvalidRequest    = types.CodeInvalidRequest
+	CodeValidationFailed  = types.CodeValidationFailed
+	CodeInvalidConnection = types.CodeInvalidConnection
+	CodeUnauthorized      = types.CodeUnauthorized
+	CodeForbidden         = types.CodeForbidden
+	CodeNotFound          = types.CodeNotFound
+	CodeMethodNotAllowed  = types.CodeMethodNotAllowed
+	CodeConflict          = types.CodeConflict
+	CodeDatabaseError     = types.CodeDatabaseError
+	CodeInternal          = types.CodeInternal
+)
+
+type (
+	ErrorResponse = types.ErrorResponse
+	APIError      = types.APIError
+	FieldError    = types.FieldError
+)
+
+// writeJSON sends v with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError sends an ErrorResponse
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, ErrorResponse{Error: APIError{Code: code, Message: message}})
+}
+
+// writeAPIError sends err with the given status, keeping its details
+func writeAPIError(w http.ResponseWriter, status int, err *APIError) {
+	writeJSON(w, status, ErrorResponse{Error: *err})
+}
+
+// codeForStatus picks the error code for failures that only carry a status
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	default:
+		return CodeInternal
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"sync"
+)
+
+const (
+	// eventHistorySize is how many recent updates of all jobs are kept for
+	// replay to subscribers of every job. Subscribers of one job replay from
+	// the job's own progress history instead.
+	eventHistorySize = 1000
+
+	// subscriberQueueSize is how many updates may wait for a slow subscriber
+	// before it is dropped. Dropped subscribers reconnect with their last seq.
+	subscriberQueueSize = 256
+)
+
+// eventBus numbers progress updates, keeps recent ones for replay and fans
+// them out to subscribers without ever blocking the publisher
+type eventBus struct {
+	mu          sync.Mutex
+	seq         int64
+	history     []ProgressUpdate // oldest first, at most eventHistorySize
+	subscribers map[*subscription]struct{}
+	closed      bool
+}
+
+// subscription receives the updates of one job, or of every job when jobID is empty
+type subscription struct {
+	jobID  string
+	queue  chan ProgressUpdate
+	lagged bool // closed by the bus because the queue was full
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subscribers: make(map[*subscription]struct{})}
+}
+
+// setSeq continues numbering after the updates of restored jobs
+func (b *eventBus) setSeq(seq int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if seq > b.seq {
+		b.seq = seq
+	}
+}
+
+// publish assigns the next sequence number to update, runs record while the
+// number is still the latest, so history and replay never disagree, and
+// queues the update for every matching subscriber
+func (b *eventBus) publish(update ProgressUpdate, record func(ProgressUpdate)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	update.Seq = b.seq
+	record(update)
+
+	b.history = append(b.history, update)
+	if len(b.history) > eventHistorySize {
+		b.history = b.history[len(b.history)-eventHistorySize:]
+	}
+
+	for sub := range b.subscribers {
+		if sub.jobID != "" && sub.jobID != update.JobID {
+			continue
+		}
+		select {
+		case sub.queue <- update:
+		default:
+			sub.lagged = true
+			delete(b.subscribers, sub)
+			close(sub.queue)
+		}
+	}
+}
+
+// subscribe registers a subscription and returns the updates after since it
+// missed. replay loads them for job subscriptions; updates of every job are
+// replayed from the bus history. A negative since skips replay.
+func (b *eventBus) subscribe(jobID string, since int64, replay func(since, until int64) []ProgressUpdate) (*subscription, []ProgressUpdate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscription{jobID: jobID, queue: make(chan ProgressUpdate, subscriberQueueSize)}
+	if b.closed {
+		close(sub.queue)
+		return sub, nil
+	}
+	b.subscribers[sub] = struct{}{}
+
+	if since < 0 {
+		return sub, nil
+	}
+	if jobID != "" {
+		return sub, replay(since, b.seq)
+	}
+	var missed []ProgressUpdate
+	for _, update := range b.history {
+		if update.Seq > since {
+			missed = append(missed, update)
+		}
+	}
+	return sub, missed
+}
+
+func (b *eventBus) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.queue)
+	}
+}
+
+// close ends every subscription, and the ones made afterwards, on shutdown
+func (b *eventBus) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for sub := range b.subscribers {
+		delete(b.subscribers, sub)
+		close(sub.queue)
+	}
+}
+
+// lastSeq returns the sequence number of the latest update
+func (b *eventBus) lastSeq() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+// isLagged reports whether the bus dropped the subscription for falling behind
+func (b *eventBus) isLagged(sub *subscription) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sub.lagged
+}
+
+// subscribe follows the updates of jobID ("" = every job), returning the
+// updates after since that the caller missed
+func (s *Server) subscribe(jobID string, since int64) (*subscription, []ProgressUpdate) {
+	return s.events.subscribe(jobID, since, func(since, until int64) []ProgressUpdate {
+		jobValue, ok := s.jobs.Load(jobID)
+		if !ok {
+			return nil
+		}
+		job := jobValue.(*IngestionJob)
+		job.mu.RLock()
+		defer job.mu.RUnlock()
+
+		var missed []ProgressUpdate
+		for _, update := range job.Progress {
+			// Updates recorded before sequencing was added have seq 0
+			if (update.Seq > since || since == 0) && update.Seq <= until {
+				missed = append(missed, update)
+			}
+		}
+		return missed
+	})
+}
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pixperk/chug/api/types"
+	"github.com/pixperk/chug/internal/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultJobsLimit = 50
+	maxJobsLimit     = 500
+
+	// progressHistoryLimit is how many updates a job keeps before its progress
+	// history is compacted to its milestones and the latest update per table
+	progressHistoryLimit = 1000
+
+	// progressMilestoneLimit is how many milestones survive compaction, the most recent ones
+	progressMilestoneLimit = 200
+
+	// jobPruneInterval is how often the retention policy is applied
+	jobPruneInterval = 10 * time.Minute
+)
+
+// Views of GET /api/v1/jobs
+const (
+	JobsViewSummary  = types.JobsViewSummary
+	JobsViewDetailed = types.JobsViewDetailed
+)
+
+var jobStatuses = []string{"pending", "running", "paused", "cancelling", "cancelled", "completed", "failed"}
+
+// jobQuery is a parsed GET /api/v1/jobs request
+type jobQuery struct {
+	statuses []string
+	table    string
+	since    time.Time
+	limit    int
+	cursor   *jobCursor
+	view     string
+}
+
+// jobCursor is the position of the last job of a page. Jobs are listed
+// newest first, ties broken by ID.
+type jobCursor struct {
+	start time.Time
+	id    string
+}
+
+func (c jobCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.start.UnixNano(), 10) + "|" + c.id))
+}
+
+func decodeCursor(value string) (*jobCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %q", value)
+	}
+	nanos, id, ok := strings.Cut(string(data), "|")
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if !ok || err != nil || id == "" {
+		return nil, fmt.Errorf("invalid cursor: %q", value)
+	}
+	return &jobCursor{start: time.Unix(0, n), id: id}, nil
+}
+
+// before reports whether a job starting at start with ID id is listed before c
+func (c jobCursor) before(start time.Time, id string) bool {
+	if !start.Equal(c.start) {
+		return start.After(c.start)
+	}
+	return id >= c.id
+}
+
+func parseJobQuery(values url.Values) (*jobQuery, error) {
+	q := &jobQuery{table: values.Get("table"), limit: defaultJobsLimit, view: JobsViewSummary}
+
+	if value := values.Get("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			if !slices.Contains(jobStatuses, status) {
+				return nil, fmt.Errorf("invalid status: %q", status)
+			}
+			q.statuses = append(q.statuses, status)
+		}
+	}
+	if value := values.Get("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since, expected an RFC 3339 time: %q", value)
+		}
+		q.since = since
+	}
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxJobsLimit {
+			return nil, fmt.Errorf("invalid limit, expected 1-%d: %q", maxJobsLimit, value)
+		}
+		q.limit = limit
+	}
+	if value := values.Get("cursor"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			return nil, err
+		}
+		q.cursor = cursor
+	}
+	if value := values.Get("view"); value != "" {
+		if value != JobsViewSummary && value != JobsViewDetailed {
+			return nil, fmt.Errorf("invalid view, expected %s or %s: %q", JobsViewSummary, JobsViewDetailed, value)
+		}
+		q.view = value
+	}
+	return q, nil
+}
+
+func (q *jobQuery) matches(job *types.IngestionJob) bool {
+	if len(q.statuses) > 0 && !slices.Contains(q.statuses, job.Status) {
+		return false
+	}
+	if q.table != "" && !slices.Contains(job.Tables, q.table) {
+		return false
+	}
+	if !q.since.IsZero() && job.StartTime.Before(q.since) {
+		return false
+	}
+	return q.cursor == nil || !q.cursor.before(job.StartTime, job.ID)
+}
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	q, err := parseJobQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	jobs := make([]*types.IngestionJob, 0)
+	s.jobs.Range(func(_, value any) bool {
+		if job := value.(*IngestionJob).snapshot(); q.matches(job) {
+			jobs = append(jobs, job)
+		}
+		return true
+	})
+	slices.SortFunc(jobs, func(a, b *types.IngestionJob) int {
+		if c := b.StartTime.Compare(a.StartTime); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID, a.ID)
+	})
+
+	resp := JobsResponse{Jobs: jobs}
+	if len(jobs) > q.limit {
+		resp.Jobs = jobs[:q.limit]
+		last := resp.Jobs[q.limit-1]
+		resp.NextCursor = jobCursor{start: last.StartTime, id: last.ID}.encode()
+	}
+	if q.view == JobsViewSummary {
+		for _, job := range resp.Jobs {
+			job.Progress = latestProgress(job.Progress)
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// isProgressTick reports whether update is a periodic progress report, as
+// opposed to a milestone such as a table starting, completing or failing
+func isProgressTick(update ProgressUpdate) bool {
+	return update.Event == "cdc_update" || (update.Phase != "" && update.Phase != "completed")
+}
+
+// compactProgress keeps the most recent milestones and the latest progress
+// report of each table, in their original order
+func compactProgress(updates []ProgressUpdate) []ProgressUpdate {
+	latestTick := make(map[string]int) // table -> index of its latest progress report
+	milestones := 0
+	for i, update := range updates {
+		if isProgressTick(update) {
+			latestTick[update.Table] = i
+		} else {
+			milestones++
+		}
+	}
+
+	skip := max(milestones-progressMilestoneLimit, 0)
+	compacted := make([]ProgressUpdate, 0, milestones-skip+len(latestTick))
+	for i, update := range updates {
+		if isProgressTick(update) {
+			if latestTick[update.Table] != i {
+				continue
+			}
+		} else if skip > 0 {
+			skip--
+			continue
+		}
+		compacted = append(compacted, update)
+	}
+	return compacted
+}
+
+// latestProgress keeps the latest update of each table, and of the job itself
+func latestProgress(updates []ProgressUpdate) []ProgressUpdate {
+	latest := make(map[string]int)
+	for i, update := range updates {
+		latest[update.Table] = i
+	}
+	result := make([]ProgressUpdate, 0, len(latest))
+	for i, update := range updates {
+		if latest[update.Table] == i {
+			result = append(result, update)
+		}
+	}
+	return result
+}
+
+// pruneJobsPeriodically applies the retention policy every jobPruneInterval
+func (s *Server) pruneJobsPeriodically() {
+	ticker := time.NewTicker(jobPruneInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.pruneJobs()
+	}
+}
+
+// pruneJobs forgets finished jobs past the retention policy: those older
+// than max_age_days and those beyond the newest max_jobs
+func (s *Server) pruneJobs() {
+	retention := s.config.Server.JobStore.Retention
+	maxJobs := retention.JobLimit()
+
+	type finishedJob struct {
+		id  string
+		end time.Time
+	}
+	var finished []finishedJob
+	s.jobs.Range(func(_, value any) bool {
+		job := value.(*IngestionJob)
+		job.mu.RLock()
+		if !job.activeLocked() && len(job.PollingTables) == 0 {
+			finished = append(finished, finishedJob{id: job.ID, end: *job.EndTime})
+		}
+		job.mu.RUnlock()
+		return true
+	})
+	slices.SortFunc(finished, func(a, b finishedJob) int {
+		return b.end.Compare(a.end)
+	})
+
+	cutoff := time.Now().AddDate(0, 0, -retention.MaxAgeDays)
+	pruned := 0
+	for i, job := range finished {
+		if (maxJobs < 0 || i < maxJobs) && (retention.MaxAgeDays <= 0 || job.end.After(cutoff)) {
+			continue
+		}
+		s.jobs.Delete(job.id)
+		s.dirty.Delete(job.id)
+		metrics.DeleteJob(job.id)
+		if s.store != nil {
+			if err := s.store.Delete(job.id); err != nil {
+				s.logger.Warn("Failed to delete pruned job", zap.String("job_id", job.id), zap.Error(err))
+			}
+		}
+		pruned++
+	}
+	if pruned > 0 {
+		s.logger.Info("Pruned old jobs", zap.Int("jobs", pruned))
+	}
+}
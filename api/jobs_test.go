@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pixperk/chug/api/types"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 123, time.UTC)
+	cursor, err := decodeCursor(jobCursor{start: start, id: "job-1"}.encode())
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+	if !cursor.start.Equal(start) || cursor.id != "job-1" {
+		t.Errorf("decoded %v %q, want %v job-1", cursor.start, cursor.id, start)
+	}
+
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	for _, value := range []string{"!!", encode("123"), encode("123|"), encode("abc|job-1"), encode("")} {
+		if _, err := decodeCursor(value); err == nil {
+			t.Errorf("decodeCursor(%q) succeeded", value)
+		}
+	}
+}
+
+func TestParseJobQueryInvalid(t *testing.T) {
+	tests := []string{
+		"status=done",
+		"status=running,bogus",
+		"since=yesterday",
+		"limit=0",
+		"limit=501",
+		"limit=x",
+		"cursor=!!",
+		"view=full",
+	}
+	for _, query := range tests {
+		t.Run(query, func(t *testing.T) {
+			values, err := url.ParseQuery(query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q, err := parseJobQuery(values); err == nil {
+				t.Errorf("parseJobQuery(%q) = %+v, want error", query, q)
+			}
+		})
+	}
+}
+
+func TestListJobsPagination(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := &Server{}
+	add := func(id, status string, start time.Time) {
+		s.jobs.Store(id, &IngestionJob{IngestionJob: types.IngestionJob{ID: id, Status: status, StartTime: start}})
+	}
+	// c, d and e start together, so their order falls back to the ID
+	add("a", "completed", base)
+	add("b", "failed", base.Add(time.Minute))
+	add("c", "completed", base.Add(2*time.Minute))
+	add("d", "running", base.Add(2*time.Minute))
+	add("e", "completed", base.Add(2*time.Minute))
+	add("f", "completed", base.Add(3*time.Minute))
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"limit=2", []string{"f", "e", "d", "c", "b", "a"}},
+		{"limit=1", []string{"f", "e", "d", "c", "b", "a"}},
+		{"limit=50", []string{"f", "e", "d", "c", "b", "a"}},
+		{"limit=2&status=completed", []string{"f", "e", "c", "a"}},
+		{"limit=2&since=" + base.Add(time.Minute).Format(time.RFC3339), []string{"f", "e", "d", "c", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var ids []string
+			cursor := ""
+			for page := 0; ; page++ {
+				if page > len(tt.want) {
+					t.Fatalf("still paging after %d pages", page)
+				}
+				target := "/api/v1/jobs?" + tt.query
+				if cursor != "" {
+					target += "&cursor=" + cursor
+				}
+				rec := httptest.NewRecorder()
+				s.handleListJobs(rec, httptest.NewRequest(http.MethodGet, target, nil))
+				if rec.Code != http.StatusOK {
+					t.Fatalf("GET %s: %d %s", target, rec.Code, rec.Body)
+				}
+				var resp JobsResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				for _, job := range resp.Jobs {
+					ids = append(ids, job.ID)
+				}
+				if resp.NextCursor == "" {
+					break
+				}
+				cursor = resp.NextCursor
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("listed %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pixperk/chug/internal/config"
+)
+
+// signJWT builds a compact JWT signed with key; ECDSA signatures use the
+// fixed-size r||s form of RFC 7518 unless der is set
+func signJWT(t *testing.T, alg, kid string, claims map[string]any, key crypto.Signer, der bool) string {
+	t.Helper()
+	segment := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(map[string]string{"alg": alg, "kid": kid}) + "." + segment(claims)
+
+	var hash crypto.Hash
+	switch alg[2:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return signed + "."
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if alg[:2] == "PS" {
+			sig, err = rsa.SignPSS(rand.Reader, k, hash, digest, nil)
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, k, hash, digest)
+		}
+	case *ecdsa.PrivateKey:
+		if der {
+			sig, err = ecdsa.SignASN1(rand.Reader, k, digest)
+			break
+		}
+		r, s, signErr := ecdsa.Sign(rand.Reader, k, digest)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		sig, err = make([]byte, 2*size), signErr
+		if err == nil {
+			r.FillBytes(sig[:size])
+			s.FillBytes(sig[size:])
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &jwtVerifier{
+		config: config.JWTConfig{Issuer: "issuer", Audience: "chug", RoleClaim: "role", DefaultRole: config.RoleReadOnly},
+		keys: map[string]crypto.PublicKey{
+			"rsa":  &rsaKey.PublicKey,
+			"p256": &p256.PublicKey,
+			"p384": &p384.PublicKey,
+		},
+	}
+
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	valid := map[string]any{"sub": "alice", "iss": "issuer", "aud": "chug", "exp": exp}
+	with := func(key string, value any) map[string]any {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name     string
+		alg, kid string
+		key      crypto.Signer
+		claims   map[string]any
+		der      bool
+		wantRole string // "" when the token is rejected
+	}{
+		{name: "RS256", alg: "RS256", kid: "rsa", key: rsaKey, claims: valid, wantRole: config.RoleReadOnly},
+		{name: "PS384", alg: "PS384", kid: "rsa", key: rsaKey, claims: valid, wantRole: config.RoleReadOnly},
+		{name: "ES256 on P-256", alg: "ES256", kid: "p256", key: p256, claims: valid, wantRole: config.RoleReadOnly},
+		{name: "ES384 on P-384", alg: "ES384", kid: "p384", key: p384, claims: valid, wantRole: config.RoleReadOnly},
+		{name: "role claim", alg: "ES256", kid: "p256", key: p256, claims: with("role", config.RoleOperator), wantRole: config.RoleOperator},
+		{name: "audience list", alg: "ES256", kid: "p256", key: p256, claims: with("aud", []any{"other", "chug"}), wantRole: config.RoleReadOnly},
+
+		{name: "ES384 on a P-256 key", alg: "ES384", kid: "p256", key: p256, claims: valid},
+		{name: "ES256 on a P-384 key", alg: "ES256", kid: "p384", key: p384, claims: valid},
+		{name: "DER-encoded ECDSA signature", alg: "ES256", kid: "p256", key: p256, claims: valid, der: true},
+		{name: "RS256 on an EC key", alg: "RS256", kid: "p256", key: rsaKey, claims: valid},
+		{name: "ES256 on an RSA key", alg: "ES256", kid: "rsa", key: p256, claims: valid},
+		{name: "none", alg: "none", kid: "rsa", key: rsaKey, claims: valid},
+		{name: "HS256", alg: "HS256", kid: "rsa", key: rsaKey, claims: valid},
+		{name: "unknown kid", alg: "RS256", kid: "other", key: rsaKey, claims: valid},
+		{name: "expired", alg: "RS256", kid: "rsa", key: rsaKey, claims: with("exp", float64(time.Now().Add(-time.Hour).Unix()))},
+		{name: "no exp", alg: "RS256", kid: "rsa", key: rsaKey, claims: with("exp", nil)},
+		{name: "not yet valid", alg: "RS256", kid: "rsa", key: rsaKey, claims: with("nbf", float64(time.Now().Add(time.Hour).Unix()))},
+		{name: "wrong issuer", alg: "RS256", kid: "rsa", key: rsaKey, claims: with("iss", "other")},
+		{name: "wrong audience", alg: "RS256", kid: "rsa", key: rsaKey, claims: with("aud", "other")},
+		{name: "unknown role", alg: "RS256", kid: "rsa", key: rsaKey, claims: with("role", "admin")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := signJWT(t, tt.alg, tt.kid, tt.claims, tt.key, tt.der)
+			principal, err := v.Verify(token)
+			if tt.wantRole == "" {
+				if err == nil {
+					t.Fatalf("Verify accepted the token as %+v", principal)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if principal.Role != tt.wantRole || principal.Name != "alice" {
+				t.Errorf("principal = %+v, want alice with role %s", principal, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestJWTVerifyMalformed(t *testing.T) {
+	v := &jwtVerifier{keys: map[string]crypto.PublicKey{}}
+	for _, token := range []string{"", "a.b", "a.b.c.d", "!!.e30.", "e30.e30.!!"} {
+		if _, err := v.Verify(token); err == nil {
+			t.Errorf("Verify(%q) succeeded", token)
+		}
+	}
+}
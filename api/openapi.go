@@ -0,0 +1,134 @@
+package api
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+// openAPISpec describes every endpoint of the API and is served at /api/v1/openapi.yaml
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// loadSpec parses and checks the embedded OpenAPI document and builds the
+// router used to find the operation of a request
+func loadSpec() (*openapi3.T, routers.Router, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to route OpenAPI document: %w", err)
+	}
+	return doc, router, nil
+}
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(openAPISpec)
+}
+
+// validate checks the parameters and body of a request against the OpenAPI
+// document before h runs
+func (s *Server) validate(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := s.router.FindRoute(r)
+		if err != nil {
+			// Unknown paths and methods are answered by the handlers' own 404 and 405
+			h(w, r)
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				// protect has already authenticated the caller
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+				MultiError:         true,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			writeAPIError(w, http.StatusBadRequest, validationError(err))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// validationError turns the errors of openapi3filter into an APIError with one
+// detail per problem. Bodies that are not JSON at all are invalid_request.
+func validationError(err error) *APIError {
+	apiErr := &APIError{Code: CodeValidationFailed, Message: "Request does not match the API schema"}
+	for _, e := range flattenErrors(err) {
+		var reqErr *openapi3filter.RequestError
+		if !errors.As(e, &reqErr) {
+			apiErr.Details = append(apiErr.Details, FieldError{Field: "", Message: e.Error()})
+			continue
+		}
+
+		field := "body"
+		if reqErr.Parameter != nil {
+			field = reqErr.Parameter.Name
+		}
+
+		var parseErr *openapi3filter.ParseError
+		if errors.As(reqErr.Err, &parseErr) && reqErr.Parameter == nil {
+			apiErr.Code = CodeInvalidRequest
+			apiErr.Message = "Request body is not valid JSON"
+		}
+
+		causes := flattenErrors(reqErr.Err)
+		if len(causes) == 0 {
+			apiErr.Details = append(apiErr.Details, FieldError{Field: field, Message: reqErr.Reason})
+			continue
+		}
+		for _, cause := range causes {
+			detail := FieldError{Field: field, Message: cause.Error()}
+			var schemaErr *openapi3.SchemaError
+			if errors.As(cause, &schemaErr) {
+				detail.Message = schemaErr.Reason
+				if pointer := schemaErr.JSONPointer(); len(pointer) > 0 && reqErr.Parameter == nil {
+					detail.Field = "/" + strings.Join(pointer, "/")
+				}
+			}
+			apiErr.Details = append(apiErr.Details, detail)
+		}
+	}
+	return apiErr
+}
+
+// flattenErrors expands the nested openapi3.MultiError values of err
+func flattenErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	// Not errors.As: a RequestError wrapping a MultiError must stay intact
+	multi, ok := err.(openapi3.MultiError)
+	if !ok {
+		return []error{err}
+	}
+	var flat []error
+	for _, e := range multi {
+		flat = append(flat, flattenErrors(e)...)
+	}
+	return flat
+}
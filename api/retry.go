@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/pixperk/chug/api/types"
+	"github.com/pixperk/chug/internal/tracing"
+	"go.uber.org/zap"
+)
+
+type (
+	RetryJobRequest  = types.RetryJobRequest
+	RetryJobResponse = types.RetryJobResponse
+)
+
+// handleRetryJob starts a new job re-running the failed tables of job with
+// their original settings, merged with any overrides
+func (s *Server) handleRetryJob(w http.ResponseWriter, r *http.Request, job *IngestionJob) {
+	var retryReq RetryJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&retryReq); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+
+	job.mu.RLock()
+	if job.activeLocked() {
+		job.mu.RUnlock()
+		writeError(w, http.StatusConflict, CodeConflict, "Job is still running")
+		return
+	}
+	if job.redacted {
+		job.mu.RUnlock()
+		writeError(w, http.StatusConflict, CodeConflict, "Job used connection URLs that were not persisted, start a new job instead")
+		return
+	}
+	failed := failedTablesLocked(job)
+	original := job.request
+	job.mu.RUnlock()
+
+	if len(retryReq.Tables) > 0 {
+		for _, name := range retryReq.Tables {
+			if !slices.Contains(failed, name) {
+				writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Table %s did not fail in job %s", name, job.ID))
+				return
+			}
+		}
+		failed = retryReq.Tables
+	}
+	if len(failed) == 0 {
+		writeError(w, http.StatusConflict, CodeConflict, "Job has no failed tables to retry")
+		return
+	}
+
+	for _, override := range retryReq.Overrides {
+		if !slices.Contains(failed, override.Name) {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Override for %s does not match a retried table", override.Name))
+			return
+		}
+	}
+	if err := s.validateHooks(retryReq.Overrides); err != nil {
+		writeError(w, http.StatusForbidden, CodeForbidden, err.Error())
+		return
+	}
+
+	req := original
+	req.Tables = make([]TableConfigRequest, 0, len(failed))
+	for _, tc := range original.Tables {
+		if !slices.Contains(failed, tc.Name) {
+			continue
+		}
+		for _, override := range retryReq.Overrides {
+			if override.Name == tc.Name {
+				tc = mergeTableConfig(tc, override)
+			}
+		}
+		req.Tables = append(req.Tables, tc)
+	}
+	// Tables that loaded in the retried job are not waited for again
+	pruneDependencies(req.Tables)
+	if err := validateDependencies(req.Tables); err != nil {
+		writeError(w, http.StatusBadRequest, CodeValidationFailed, err.Error())
+		return
+	}
+
+	retry := s.startJob(tracing.Extract(r.Context(), r.Header), req, job.ID, "")
+
+	job.mu.Lock()
+	job.Retries = append(job.Retries, retry.ID)
+	job.mu.Unlock()
+	s.saveJob(job)
+
+	s.sendUpdate(ProgressUpdate{
+		JobID:     job.ID,
+		Event:     "retried",
+		Message:   fmt.Sprintf("Retrying %d failed tables as %s", len(req.Tables), retry.ID),
+		Timestamp: time.Now(),
+	})
+
+	s.audit(r, "job_retried",
+		zap.String("job_id", job.ID),
+		zap.String("retry_job_id", retry.ID),
+		zap.Strings("tables", retry.Tables))
+
+	writeJSON(w, http.StatusOK, RetryJobResponse{
+		JobID:   retry.ID,
+		Status:  "accepted",
+		RetryOf: job.ID,
+		Tables:  retry.Tables,
+	})
+}
+
+// failedTablesLocked lists the tables of a job without a successful result,
+// including tables that never ran because the job was cancelled or interrupted
+func failedTablesLocked(job *IngestionJob) []string {
+	var failed []string
+	for _, name := range job.Tables {
+		succeeded := false
+		for _, result := range job.Results {
+			if result.TableName == name && result.Success {
+				succeeded = true
+				break
+			}
+		}
+		if !succeeded {
+			failed = append(failed, name)
+		}
+	}
+	return failed
+}
+
+// mergeTableConfig applies the settings present in override on top of tc
+func mergeTableConfig(tc, override TableConfigRequest) TableConfigRequest {
+	if override.Limit != nil {
+		tc.Limit = override.Limit
+	}
+	if override.BatchSize != nil {
+		tc.BatchSize = override.BatchSize
+	}
+	if override.ExactCount != nil {
+		tc.ExactCount = override.ExactCount
+	}
+	if override.Priority != nil {
+		tc.Priority = override.Priority
+	}
+	if override.LoadMode != "" {
+		tc.LoadMode = override.LoadMode
+	}
+	if override.DependsOn != nil {
+		tc.DependsOn = override.DependsOn
+	}
+	if override.PreSQL != nil {
+		tc.PreSQL = override.PreSQL
+	}
+	if override.PostSQL != nil {
+		tc.PostSQL = override.PostSQL
+	}
+	if override.Polling != nil {
+		tc.Polling = override.Polling
+	}
+	if override.ErrorPolicy != nil {
+		tc.ErrorPolicy = override.ErrorPolicy
+	}
+	if override.Retry != nil {
+		tc.Retry = override.Retry
+	}
+	return tc
+}
@@ -0,0 +1,441 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pixperk/chug/api/types"
+	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/schedule"
+	"go.uber.org/zap"
+)
+
+// Schedule sources
+const (
+	ScheduleFromConfig = types.ScheduleFromConfig
+	ScheduleFromAPI    = types.ScheduleFromAPI
+)
+
+// maxScheduleRuns is how many recent runs a schedule remembers
+const maxScheduleRuns = 50
+
+// Schedule is a schedule and the state the server keeps to trigger its runs
+type Schedule struct {
+	types.Schedule
+	request IngestRequest
+	cron    *schedule.Cron
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+}
+
+type (
+	ScheduleRun           = types.ScheduleRun
+	CreateScheduleRequest = types.CreateScheduleRequest
+	SchedulesResponse     = types.SchedulesResponse
+	ScheduleResponse      = types.ScheduleResponse
+)
+
+// startConfigSchedules registers the schedules of the serve config: one for
+// the tables without their own schedule when schedule is set, and one per
+// table that has one
+func (s *Server) startConfigSchedules() error {
+	var shared []config.TableConfig
+	for _, tc := range s.config.GetEffectiveTableConfigs() {
+		if tc.Schedule == "" {
+			shared = append(shared, tc)
+			continue
+		}
+		sched := &Schedule{
+			Schedule: types.Schedule{ID: "config:" + tc.Name, Cron: tc.Schedule, Source: ScheduleFromConfig},
+			request:  s.configRequest([]config.TableConfig{tc}),
+		}
+		if err := s.addSchedule(sched); err != nil {
+			return fmt.Errorf("table %s: %w", tc.Name, err)
+		}
+	}
+
+	if s.config.Schedule != "" && len(shared) > 0 {
+		sched := &Schedule{
+			Schedule: types.Schedule{ID: "config", Cron: s.config.Schedule, Source: ScheduleFromConfig},
+			request:  s.configRequest(shared),
+		}
+		if err := s.addSchedule(sched); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreSchedules restarts the schedules created through the API before the
+// last restart. It runs after restoreJobs so their runs are recovered.
+func (s *Server) restoreSchedules() error {
+	if s.store == nil {
+		return nil
+	}
+	records, err := s.store.ListSchedules()
+	if err != nil {
+		return fmt.Errorf("failed to load schedules: %w", err)
+	}
+
+	for _, record := range records {
+		id := record.Schedule.ID
+		if record.Redacted {
+			s.logger.Warn("Not restoring schedule, its connection URLs were not persisted; use named connections",
+				zap.String("schedule_id", id))
+			continue
+		}
+		sched := &Schedule{
+			Schedule: types.Schedule{
+				ID:     id,
+				Name:   record.Schedule.Name,
+				Cron:   record.Schedule.Cron,
+				Source: ScheduleFromAPI,
+			},
+			request: record.Request,
+		}
+		if err := s.addSchedule(sched); err != nil {
+			s.logger.Warn("Not restoring schedule", zap.String("schedule_id", id), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// saveSchedule persists a schedule created through the API
+func (s *Server) saveSchedule(sched *Schedule) error {
+	if s.store == nil {
+		return nil
+	}
+	req, redacted := redactRequest(sched.request)
+	if redacted {
+		s.logger.Warn("Schedule passes connection URLs with passwords, it will not be restored after a restart; use named connections",
+			zap.String("schedule_id", sched.ID))
+	}
+	return s.store.SaveSchedule(&ScheduleRecord{
+		Schedule: &types.Schedule{ID: sched.ID, Name: sched.Name, Cron: sched.Cron, Source: sched.Source},
+		Request:  req,
+		Redacted: redacted,
+	})
+}
+
+// configRequest builds the ingest request of a config schedule. Connections
+// are left empty so the server's own pg_url and ch_url are used.
+func (s *Server) configRequest(tables []config.TableConfig) IngestRequest {
+	req := IngestRequest{
+		Limit:      s.config.Limit,
+		BatchSize:  s.config.BatchSize,
+		ExactCount: s.config.ExactCount,
+		LoadMode:   s.config.LoadMode,
+	}
+	if s.config.Polling.Enabled {
+		// Rejected by validateSchedule rather than silently dropped
+		polling := s.config.Polling
+		req.Polling = &polling
+	}
+	if s.config.ErrorPolicy != (config.ErrorPolicy{}) {
+		policy := s.config.ErrorPolicy
+		req.ErrorPolicy = &policy
+	}
+	if s.config.Retry != (config.RetryPolicy{}) {
+		retry := s.config.Retry
+		req.Retry = &retry
+	}
+	for _, tc := range tables {
+		table := TableConfigRequest{
+			Name:        tc.Name,
+			Limit:       tc.Limit,
+			BatchSize:   tc.BatchSize,
+			ExactCount:  tc.ExactCount,
+			LoadMode:    tc.LoadMode,
+			Polling:     tc.Polling,
+			ErrorPolicy: tc.ErrorPolicy,
+			Retry:       tc.Retry,
+			DependsOn:   tc.DependsOn,
+			PreSQL:      tc.PreSQL,
+			PostSQL:     tc.PostSQL,
+		}
+		if tc.Priority != 0 {
+			priority := tc.Priority
+			table.Priority = &priority
+		}
+		req.Tables = append(req.Tables, table)
+	}
+	// A table with its own schedule runs without the tables it depends on
+	pruneDependencies(req.Tables)
+	return req
+}
+
+// validateSchedule parses expr and checks that req can run on a schedule
+func (s *Server) validateSchedule(expr string, req IngestRequest) (*schedule.Cron, error) {
+	cron, err := schedule.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	if cron.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never runs", expr)
+	}
+	if len(req.Tables) == 0 {
+		return nil, errors.New("no tables to schedule")
+	}
+	// A polling job never ends, so every later run would be skipped
+	if req.Polling != nil && req.Polling.Enabled {
+		return nil, errors.New("scheduled jobs cannot enable polling")
+	}
+	for _, tc := range req.Tables {
+		if tc.Polling != nil && tc.Polling.Enabled {
+			return nil, fmt.Errorf("table %s: scheduled jobs cannot enable polling", tc.Name)
+		}
+	}
+	if err := s.validateConnections(req); err != nil {
+		return nil, err
+	}
+	if err := validateDependencies(req.Tables); err != nil {
+		return nil, err
+	}
+	return cron, nil
+}
+
+// addSchedule validates sched, recovers its past runs from job history and
+// starts its timer
+func (s *Server) addSchedule(sched *Schedule) error {
+	cron, err := s.validateSchedule(sched.Cron, sched.request)
+	if err != nil {
+		return err
+	}
+	sched.cron = cron
+	sched.Tables = make([]string, len(sched.request.Tables))
+	for i, tc := range sched.request.Tables {
+		sched.Tables[i] = tc.Name
+	}
+	sched.Runs = s.scheduleHistory(sched.ID)
+	next := cron.Next(time.Now())
+	sched.NextRun = &next
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sched.cancel = cancel
+	s.schedules.Store(sched.ID, sched)
+	go s.runSchedule(ctx, sched)
+
+	s.logger.Info("Registered schedule",
+		zap.String("schedule_id", sched.ID),
+		zap.String("schedule", sched.Cron),
+		zap.Strings("tables", sched.Tables))
+	return nil
+}
+
+// scheduleHistory lists the restored jobs started by a schedule
+func (s *Server) scheduleHistory(id string) []ScheduleRun {
+	var jobs []*IngestionJob
+	s.jobs.Range(func(key, value any) bool {
+		job := value.(*IngestionJob)
+		job.mu.RLock()
+		if job.ScheduleID == id {
+			jobs = append(jobs, job)
+		}
+		job.mu.RUnlock()
+		return true
+	})
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].StartTime.Before(jobs[j].StartTime) })
+
+	runs := make([]ScheduleRun, 0, len(jobs))
+	for _, job := range jobs {
+		runs = append(runs, ScheduleRun{Time: job.StartTime, Status: "started", JobID: job.ID})
+	}
+	if len(runs) > maxScheduleRuns {
+		runs = runs[len(runs)-maxScheduleRuns:]
+	}
+	return runs
+}
+
+// runSchedule triggers sched at every due time until ctx is cancelled
+func (s *Server) runSchedule(ctx context.Context, sched *Schedule) {
+	for {
+		next := sched.cron.Next(time.Now())
+		if next.IsZero() {
+			s.logger.Warn("Schedule has no further runs", zap.String("schedule_id", sched.ID))
+			return
+		}
+		sched.mu.Lock()
+		sched.NextRun = &next
+		sched.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.triggerSchedule(sched, next)
+	}
+}
+
+// triggerSchedule starts a job for sched unless its previous job is still active
+func (s *Server) triggerSchedule(sched *Schedule, due time.Time) {
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+
+	run := ScheduleRun{Time: due, Status: "started"}
+	if active := s.activeScheduleJobLocked(sched); active != "" {
+		run.Status = "skipped"
+		run.JobID = active
+		s.logger.Warn("Skipping scheduled run, the previous run is still active",
+			zap.String("schedule_id", sched.ID),
+			zap.String("job_id", active))
+	} else {
+		job := s.startJob(context.Background(), sched.request, "", sched.ID)
+		sched.ActiveJob = job.ID
+		run.JobID = job.ID
+		s.logger.Info("Started scheduled job",
+			zap.String("schedule_id", sched.ID),
+			zap.String("job_id", job.ID))
+	}
+
+	sched.Runs = append(sched.Runs, run)
+	if len(sched.Runs) > maxScheduleRuns {
+		sched.Runs = sched.Runs[len(sched.Runs)-maxScheduleRuns:]
+	}
+}
+
+// activeScheduleJobLocked returns the job of the schedule's run in progress,
+// forgetting it once the job has ended. Caller holds sched.mu.
+func (s *Server) activeScheduleJobLocked(sched *Schedule) string {
+	if sched.ActiveJob == "" {
+		return ""
+	}
+	if jobValue, ok := s.jobs.Load(sched.ActiveJob); ok {
+		job := jobValue.(*IngestionJob)
+		job.mu.RLock()
+		active := job.activeLocked()
+		job.mu.RUnlock()
+		if active {
+			return sched.ActiveJob
+		}
+	}
+	sched.ActiveJob = ""
+	return ""
+}
+
+// snapshotSchedule copies sched under its lock so it can be encoded safely
+func (s *Server) snapshotSchedule(sched *Schedule) *types.Schedule {
+	sched.mu.Lock()
+	defer sched.mu.Unlock()
+	var nextRun *time.Time
+	if sched.NextRun != nil {
+		next := *sched.NextRun
+		nextRun = &next
+	}
+	return &types.Schedule{
+		ID:        sched.ID,
+		Name:      sched.Name,
+		Cron:      sched.Cron,
+		Source:    sched.Source,
+		Tables:    sched.Tables,
+		NextRun:   nextRun,
+		ActiveJob: s.activeScheduleJobLocked(sched),
+		Runs:      append([]ScheduleRun{}, sched.Runs...),
+	}
+}
+
+// handleSchedules serves GET (list) and POST (create) /api/v1/schedules
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		schedules := make([]*types.Schedule, 0)
+		s.schedules.Range(func(key, value any) bool {
+			schedules = append(schedules, s.snapshotSchedule(value.(*Schedule)))
+			return true
+		})
+		sort.Slice(schedules, func(i, j int) bool { return schedules[i].ID < schedules[j].ID })
+		writeJSON(w, http.StatusOK, SchedulesResponse{Schedules: schedules})
+
+	case http.MethodPost:
+		var req CreateScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Invalid request: %v", err))
+			return
+		}
+		sched := &Schedule{
+			Schedule: types.Schedule{
+				ID:     fmt.Sprintf("sched_%d", time.Now().UnixNano()),
+				Name:   req.Name,
+				Cron:   req.Schedule,
+				Source: ScheduleFromAPI,
+			},
+			request: req.Request,
+		}
+		if err := s.validateConnections(req.Request); err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidConnection, err.Error())
+			return
+		}
+		if err := s.validateHooks(req.Request.Tables); err != nil {
+			writeError(w, http.StatusForbidden, CodeForbidden, err.Error())
+			return
+		}
+		if err := s.addSchedule(sched); err != nil {
+			writeError(w, http.StatusBadRequest, CodeValidationFailed, err.Error())
+			return
+		}
+		if err := s.saveSchedule(sched); err != nil {
+			// A schedule that would silently vanish on restart is not created
+			sched.cancel()
+			s.schedules.Delete(sched.ID)
+			s.logger.Error("Failed to persist schedule", zap.String("schedule_id", sched.ID), zap.Error(err))
+			writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to persist schedule")
+			return
+		}
+
+		s.audit(r, "schedule_created",
+			zap.String("schedule_id", sched.ID),
+			zap.String("schedule", sched.Cron),
+			zap.Strings("tables", sched.Tables))
+
+		writeJSON(w, http.StatusOK, ScheduleResponse{Schedule: s.snapshotSchedule(sched)})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleSchedule serves GET and DELETE /api/v1/schedules/{id}
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/schedules/")
+	value, ok := s.schedules.Load(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Schedule not found")
+		return
+	}
+	sched := value.(*Schedule)
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, ScheduleResponse{Schedule: s.snapshotSchedule(sched)})
+
+	case http.MethodDelete:
+		if sched.Source == ScheduleFromConfig {
+			writeError(w, http.StatusConflict, CodeConflict, "Schedule comes from the server config, remove it there")
+			return
+		}
+		if s.store != nil {
+			if err := s.store.DeleteSchedule(id); err != nil {
+				s.logger.Error("Failed to delete schedule", zap.String("schedule_id", id), zap.Error(err))
+				writeError(w, http.StatusInternalServerError, CodeInternal, "Failed to delete schedule")
+				return
+			}
+		}
+		// A run in progress keeps going, only future runs are dropped
+		sched.cancel()
+		s.schedules.Delete(id)
+		s.audit(r, "schedule_deleted", zap.String("schedule_id", id))
+		writeJSON(w, http.StatusOK, ScheduleResponse{Schedule: s.snapshotSchedule(sched)})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	}
+}
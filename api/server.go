@@ -3,18 +3,30 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
 	"github.com/gorilla/websocket"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/api/types"
 	"github.com/pixperk/chug/internal/config"
 	"github.com/pixperk/chug/internal/db"
 	"github.com/pixperk/chug/internal/etl"
+	"github.com/pixperk/chug/internal/metrics"
 	"github.com/pixperk/chug/internal/poller"
+	"github.com/pixperk/chug/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -23,92 +35,208 @@ type Server struct {
 	logger    *zap.Logger
 	upgrader  websocket.Upgrader
 	jobs      sync.Map // jobID -> *IngestionJob
-	broadcast chan ProgressUpdate
-	clients   sync.Map // clientID -> *websocket.Conn
+	store     JobStore
+	auth      *authenticator // nil when auth is disabled
+	auditLog  *zap.Logger
+	dirty     sync.Map // jobID -> struct{}, jobs with unsaved progress
+	events    *eventBus
+	spec      *openapi3.T
+	router    routers.Router // finds the OpenAPI operation of a request for validation
+	schedules sync.Map       // scheduleID -> *Schedule
+	http      *http.Server
+	metrics   *http.Server   // nil unless server.metrics_addr is set
+	running   sync.WaitGroup // ingestion runs and CDC pollers, waited for on shutdown
+	closing   atomic.Bool
+	memory    *etl.MemoryBudget // rows buffered by all jobs and pollers
+	workers   *etl.WorkerBudget // batch inserts of all jobs and pollers
 }
 
+// IngestionJob is a job and the state the server keeps to run it
 type IngestionJob struct {
-	ID           string              `json:"id"`
-	Status       string              `json:"status"` // pending, running, completed, failed
-	Tables       []string            `json:"tables"`
-	TableConfigs []TableConfigRequest `json:"table_configs,omitempty"` // Store table configurations for UI display
-	Results      []etl.TableResult   `json:"results"`
-	Progress     []ProgressUpdate    `json:"progress"`
-	StartTime    time.Time           `json:"start_time"`
-	EndTime      *time.Time          `json:"end_time,omitempty"`
-	Error        string              `json:"error,omitempty"`
-	mu           sync.RWMutex
+	types.IngestionJob
+	request   IngestRequest
+	ctx       context.Context
+	cancel    context.CancelCauseFunc
+	runs      map[string]*tableRun // active tables: loading or polling
+	cancelled bool
+	redacted  bool // restored from a record whose request URLs had their passwords removed
+	mu        sync.RWMutex
+	saveMu    sync.Mutex // serialises saves so an older snapshot never overwrites a newer one
 }
 
-type ProgressUpdate struct {
-	JobID        string    `json:"job_id"`
-	Table        string    `json:"table"`
-	Event        string    `json:"event"` // started, extracting, inserting, completed, error
-	Message      string    `json:"message"`
-	RowCount     int64     `json:"row_count,omitempty"`      // Total rows processed for this table
-	CurrentRows  int64     `json:"current_rows,omitempty"`   // Current batch/progress
-	TotalRows    int64     `json:"total_rows,omitempty"`     // Expected total (from limit)
-	Percentage   float64   `json:"percentage,omitempty"`     // Completion percentage
-	Phase        string    `json:"phase,omitempty"`          // extracting, inserting, completed
-	Duration     string    `json:"duration,omitempty"`
-	Timestamp    time.Time `json:"timestamp"`
-}
+// Requests and responses are defined in api/types, which clients import
+// without depending on the server
+type (
+	ProgressUpdate     = types.ProgressUpdate
+	TableConfigRequest = types.TableConfigRequest
+	IngestRequest      = types.IngestRequest
+	HealthResponse     = types.HealthResponse
+	JobStatusResponse  = types.JobStatusResponse
+	JobsResponse       = types.JobsResponse
+	IngestResponse     = types.IngestResponse
+	TablesResponse     = types.TablesResponse
+	ColumnInfo         = types.ColumnInfo
+	ColumnsResponse    = types.ColumnsResponse
+)
 
-type TableConfigRequest struct {
-	Name      string                `json:"name"`
-	Limit     *int                  `json:"limit,omitempty"`
-	BatchSize *int                  `json:"batch_size,omitempty"`
-	Polling   *config.PollingConfig `json:"polling,omitempty"`
-}
+func NewServer(cfg *config.Config, logger *zap.Logger, store JobStore) (*Server, error) {
+	auth, err := newAuthenticator(cfg.Server.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth config: %w", err)
+	}
+	auditLog, err := newAuditLogger(cfg.Server.Auth.AuditLog, logger)
+	if err != nil {
+		return nil, err
+	}
 
-type IngestRequest struct {
-	Tables    []TableConfigRequest `json:"tables"`
-	PgURL     string               `json:"pg_url,omitempty"`
-	ChURL     string               `json:"ch_url,omitempty"`
-	Limit     *int                 `json:"limit,omitempty"`     // Default limit for tables without specific config
-	BatchSize *int                 `json:"batch_size,omitempty"` // Default batch size
-	Polling   *config.PollingConfig `json:"polling,omitempty"`   // Default polling config
-}
+	spec, router, err := loadSpec()
+	if err != nil {
+		return nil, err
+	}
 
-type HealthResponse struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Version   string    `json:"version"`
+	s := &Server{
+		config:   cfg,
+		logger:   logger,
+		store:    store,
+		auth:     auth,
+		auditLog: auditLog,
+		events:   newEventBus(),
+		spec:     spec,
+		router:   router,
+		http:     &http.Server{},
+		memory:   etl.NewMemoryBudget(cfg.MemoryLimit()),
+		workers:  etl.NewWorkerBudget(cfg.InsertWorkerLimit()),
+	}
+	s.upgrader = websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	return s, nil
 }
 
-type JobStatusResponse struct {
-	Job *IngestionJob `json:"job"`
-}
+func (s *Server) Start(addr string) error {
+	go s.flushJobs()
+	go s.pruneJobsPeriodically()
+
+	db.OnBreakerStateChange(func(status db.BreakerStatus) {
+		s.logger.Warn("Database connection state changed",
+			zap.String("database", status.Name),
+			zap.String("state", string(status.State)),
+			zap.String("last_error", status.LastError))
+	})
 
-func NewServer(cfg *config.Config, logger *zap.Logger) *Server {
-	return &Server{
-		config:    cfg,
-		logger:    logger,
-		broadcast: make(chan ProgressUpdate, 100),
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins (configure properly in production)
-			},
-		},
+	if err := s.restoreJobs(); err != nil {
+		return err
+	}
+	if err := s.startConfigSchedules(); err != nil {
+		return fmt.Errorf("invalid schedule: %w", err)
+	}
+	if err := s.restoreSchedules(); err != nil {
+		return err
 	}
-}
 
-func (s *Server) Start(addr string) error {
-	// Start WebSocket broadcaster
-	go s.broadcastUpdates()
+	if s.auth == nil {
+		s.logger.Warn("API authentication is disabled, configure server.auth to require tokens")
+	}
 
 	// Setup routes
 	http.HandleFunc("/", s.handleWebUI)
 	http.HandleFunc("/health", s.handleHealth)
-	http.HandleFunc("/api/v1/tables", s.handleListTables)
-	http.HandleFunc("/api/v1/tables/columns", s.handleTableColumns)
-	http.HandleFunc("/api/v1/ingest", s.handleIngest)
-	http.HandleFunc("/api/v1/jobs", s.handleListJobs)
-	http.HandleFunc("/api/v1/jobs/", s.handleJobStatus)
-	http.HandleFunc("/ws", s.handleWebSocket)
+	http.HandleFunc("/api/v1/openapi.yaml", s.handleOpenAPI)
+	http.HandleFunc("/api/v1/connections", s.protect(s.validate(s.handleListConnections)))
+	http.HandleFunc("/api/v1/tables", s.protect(s.validate(s.handleListTables)))
+	http.HandleFunc("/api/v1/tables/columns", s.protect(s.validate(s.handleTableColumns)))
+	http.HandleFunc("/api/v1/tables/", s.protect(s.validate(s.handleTableAction)))
+	http.HandleFunc("/api/v1/ingest", s.protect(s.validate(s.handleIngest)))
+	http.HandleFunc("/api/v1/jobs", s.protect(s.validate(s.handleListJobs)))
+	http.HandleFunc("/api/v1/jobs/", s.protect(s.validate(s.handleJobStatus)))
+	http.HandleFunc("/api/v1/schedules", s.protect(s.validate(s.handleSchedules)))
+	http.HandleFunc("/api/v1/schedules/", s.protect(s.validate(s.handleSchedule)))
+	http.HandleFunc("/api/v1/events", s.protect(s.validate(s.handleEvents)))
+	http.HandleFunc("/api/v1/events/poll", s.protect(s.validate(s.handleEvents)))
+	http.HandleFunc("/ws", s.protect(s.validate(s.handleWebSocket)))
+	if err := s.startMetrics(); err != nil {
+		return err
+	}
 
 	s.logger.Info("Starting API server", zap.String("addr", addr))
-	return http.ListenAndServe(addr, nil)
+	s.http.Addr = addr
+	return s.http.ListenAndServe()
+}
+
+// startMetrics serves /metrics on server.metrics_addr without auth, so
+// Prometheus can scrape it from a private interface without a token. Without
+// an address, /metrics is served on the API address behind auth.
+func (s *Server) startMetrics() error {
+	addr := s.config.Server.MetricsAddr
+	if addr == "" {
+		http.HandleFunc("/metrics", s.protect(metrics.Handler().ServeHTTP))
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	s.metrics = &http.Server{Handler: mux}
+	s.logger.Info("Serving Prometheus metrics without auth", zap.String("addr", addr))
+	go func() {
+		if err := s.metrics.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Metrics server stopped", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops schedules, closes event streams and cancels every active job
+// with errServerShutdown: batches being inserted are flushed, pollers commit
+// their last cycle and stay recorded so they are re-attached on the next
+// start. It then stops the HTTP server and waits for the jobs until ctx ends.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closing.Store(true)
+
+	s.schedules.Range(func(_, value any) bool {
+		sched := value.(*Schedule)
+		sched.cancel()
+		// Wait for a run being triggered right now
+		sched.mu.Lock()
+		sched.mu.Unlock()
+		return true
+	})
+
+	s.jobs.Range(func(_, value any) bool {
+		job := value.(*IngestionJob)
+		job.mu.Lock()
+		if job.activeLocked() {
+			job.contextLocked()
+			job.cancel(errServerShutdown)
+		}
+		job.mu.Unlock()
+		return true
+	})
+
+	s.events.close()
+	httpErr := s.http.Shutdown(ctx)
+	if s.metrics != nil {
+		httpErr = errors.Join(httpErr, s.metrics.Shutdown(ctx))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("jobs still running at the shutdown deadline: %w", ctx.Err())
+	}
+
+	s.jobs.Range(func(_, value any) bool {
+		s.saveJob(value.(*IngestionJob))
+		return true
+	})
+	return errors.Join(httpErr, err)
 }
 
 func (s *Server) handleWebUI(w http.ResponseWriter, r *http.Request) {
@@ -129,43 +257,49 @@ func (s *Server) handleWebUI(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	response := HealthResponse{
 		Status:    "healthy",
 		Timestamp: time.Now(),
-		Version:   "1.0.0",
+		Version:   s.spec.Info.Version,
+		Databases: db.BreakerStatuses(),
+	}
+	for _, status := range response.Databases {
+		if status.State != db.BreakerClosed {
+			response.Status = "degraded"
+		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 }
 
 func (s *Server) handleListTables(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	// Get pg_url from query params or use server default
-	pgURL := r.URL.Query().Get("pg_url")
-	if pgURL == "" {
-		pgURL = s.config.PostgresURL
+	// Use the named connection or pg_url from query params, or the server default
+	pgURL, err := s.resolveConnection(r.URL.Query().Get("connection"), r.URL.Query().Get("pg_url"), config.ConnectionPostgres)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidConnection, err.Error())
+		return
 	}
-
 	if pgURL == "" {
-		http.Error(w, "PostgreSQL URL not configured", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidConnection, "PostgreSQL URL not configured")
 		return
 	}
 
 	// Connect to PostgreSQL
-	pgConn, err := db.GetPostgresPool(pgURL)
+	pgConn, release, err := db.Pools.AcquirePostgres(pgURL)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to PostgreSQL: %v", err), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeDatabaseError, fmt.Sprintf("Failed to connect to PostgreSQL: %v", err))
 		return
 	}
+	defer release()
 
 	// Query for all tables in public schema
 	ctx := context.Background()
@@ -179,7 +313,7 @@ func (s *Server) handleListTables(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := pgConn.Query(ctx, query)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to query tables: %v", err), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeDatabaseError, fmt.Sprintf("Failed to query tables: %v", err))
 		return
 	}
 	defer rows.Close()
@@ -193,41 +327,42 @@ func (s *Server) handleListTables(w http.ResponseWriter, r *http.Request) {
 		tables = append(tables, tableName)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"tables": tables,
-	})
+	if tables == nil {
+		tables = []string{}
+	}
+	writeJSON(w, http.StatusOK, TablesResponse{Tables: tables})
 }
 
 func (s *Server) handleTableColumns(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	// Get parameters from query
 	tableName := r.URL.Query().Get("table")
 	if tableName == "" {
-		http.Error(w, "table parameter is required", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "table parameter is required")
 		return
 	}
 
-	pgURL := r.URL.Query().Get("pg_url")
-	if pgURL == "" {
-		pgURL = s.config.PostgresURL
+	pgURL, err := s.resolveConnection(r.URL.Query().Get("connection"), r.URL.Query().Get("pg_url"), config.ConnectionPostgres)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidConnection, err.Error())
+		return
 	}
-
 	if pgURL == "" {
-		http.Error(w, "PostgreSQL URL not configured", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidConnection, "PostgreSQL URL not configured")
 		return
 	}
 
 	// Connect to PostgreSQL
-	pgConn, err := db.GetPostgresPool(pgURL)
+	pgConn, release, err := db.Pools.AcquirePostgres(pgURL)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect to PostgreSQL: %v", err), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeDatabaseError, fmt.Sprintf("Failed to connect to PostgreSQL: %v", err))
 		return
 	}
+	defer release()
 
 	// Query for columns of the specified table
 	ctx := context.Background()
@@ -241,56 +376,77 @@ func (s *Server) handleTableColumns(w http.ResponseWriter, r *http.Request) {
 
 	rows, err := pgConn.Query(ctx, query, tableName)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to query columns: %v", err), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeDatabaseError, fmt.Sprintf("Failed to query columns: %v", err))
 		return
 	}
 	defer rows.Close()
 
-	type Column struct {
-		Name     string `json:"name"`
-		DataType string `json:"data_type"`
-	}
-
-	var columns []Column
+	columns := []ColumnInfo{}
 	for rows.Next() {
-		var col Column
+		var col ColumnInfo
 		if err := rows.Scan(&col.Name, &col.DataType); err != nil {
-			http.Error(w, fmt.Sprintf("Failed to scan column: %v", err), http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, CodeDatabaseError, fmt.Sprintf("Failed to scan column: %v", err))
 			return
 		}
 		columns = append(columns, col)
 	}
 
 	if err := rows.Err(); err != nil {
-		http.Error(w, fmt.Sprintf("Error iterating columns: %v", err), http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, CodeDatabaseError, fmt.Sprintf("Error iterating columns: %v", err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"columns": columns,
-	})
+	writeJSON(w, http.StatusOK, ColumnsResponse{Columns: columns})
 }
 
 func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	var req IngestRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("Invalid request: %v", err))
 		return
 	}
 
 	// Validate request
 	if len(req.Tables) == 0 {
-		http.Error(w, "No tables specified", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, CodeValidationFailed, "No tables specified")
+		return
+	}
+	if err := s.validateConnections(req); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidConnection, err.Error())
+		return
+	}
+	if err := validateDependencies(req.Tables); err != nil {
+		writeError(w, http.StatusBadRequest, CodeValidationFailed, err.Error())
+		return
+	}
+	if err := s.validateHooks(req.Tables); err != nil {
+		writeError(w, http.StatusForbidden, CodeForbidden, err.Error())
 		return
 	}
 
-	// Create job
+	job := s.startJob(tracing.Extract(r.Context(), r.Header), req, "", "")
+	s.audit(r, "job_started",
+		zap.String("job_id", job.ID),
+		zap.Strings("tables", job.Tables),
+		zap.String("pg_connection", req.PgConnection),
+		zap.String("ch_connection", req.ChConnection),
+		zap.String("pg_url", db.RedactDSN(req.PgURL)),
+		zap.String("ch_url", db.RedactDSN(req.ChURL)))
+
+	// Return job ID immediately
+	writeJSON(w, http.StatusOK, IngestResponse{JobID: job.ID, Status: "accepted"})
+}
+
+// startJob registers a job for req and runs it in the background. retryOf
+// links the job to the job it retries, scheduleID to the schedule that
+// started it. The job's span continues the trace in ctx, usually the one sent
+// by the API caller.
+func (s *Server) startJob(ctx context.Context, req IngestRequest, retryOf, scheduleID string) *IngestionJob {
 	jobID := fmt.Sprintf("job_%d", time.Now().UnixNano())
 
 	// Extract table names for job tracking
@@ -300,62 +456,63 @@ func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	job := &IngestionJob{
-		ID:           jobID,
-		Status:       "pending",
-		Tables:       tableNames,
-		TableConfigs: req.Tables, // Store table configurations for UI display
-		Progress:     make([]ProgressUpdate, 0),
-		StartTime:    time.Now(),
+		IngestionJob: types.IngestionJob{
+			ID:           jobID,
+			Status:       "pending",
+			Tables:       tableNames,
+			TableConfigs: req.Tables, // Store table configurations for UI display
+			Progress:     make([]ProgressUpdate, 0),
+			StartTime:    time.Now(),
+			RetryOf:      retryOf,
+			ScheduleID:   scheduleID,
+		},
+		request: req,
 	}
 	s.jobs.Store(jobID, job)
+	s.saveJob(job)
+	if s.closing.Load() {
+		// Started while shutting down: runIngestion stops right away
+		job.mu.Lock()
+		job.contextLocked()
+		job.cancel(errServerShutdown)
+		job.mu.Unlock()
+	}
 
-	// Start ingestion in background
-	go s.runIngestion(jobID, req)
+	// Start ingestion in background. The job outlives the request, so only
+	// the caller's span context is carried over, not its cancellation.
+	traceCtx := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+	s.running.Add(1)
+	go s.runIngestion(traceCtx, jobID, req)
 
-	// Return job ID immediately
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"job_id": jobID,
-		"status": "accepted",
-	})
+	return job
 }
 
-func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func (s *Server) handleJobStatus(w http.ResponseWriter, r *http.Request) {
+	// Extract job ID from path
+	jobID := r.URL.Path[len("/api/v1/jobs/"):]
+	if jobID == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "Job ID required")
 		return
 	}
 
-	jobs := make([]*IngestionJob, 0)
-	s.jobs.Range(func(key, value interface{}) bool {
-		if job, ok := value.(*IngestionJob); ok {
-			jobs = append(jobs, job)
+	// /api/v1/jobs/{id}/{action}
+	if id, action, ok := strings.Cut(jobID, "/"); ok {
+		if action == "events" || action == "events/poll" {
+			s.handleJobEvents(w, r, id, action)
+			return
 		}
-		return true
-	})
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"jobs": jobs,
-	})
-}
-
-func (s *Server) handleJobStatus(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		s.handleJobAction(w, r, id, action)
 		return
 	}
 
-	// Extract job ID from path
-	jobID := r.URL.Path[len("/api/v1/jobs/"):]
-	if jobID == "" {
-		http.Error(w, "Job ID required", http.StatusBadRequest)
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	jobValue, ok := s.jobs.Load(jobID)
 	if !ok {
-		http.Error(w, "Job not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, CodeNotFound, "Job not found")
 		return
 	}
 
@@ -363,77 +520,43 @@ func (s *Server) handleJobStatus(w http.ResponseWriter, r *http.Request) {
 	job.mu.RLock()
 	defer job.mu.RUnlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(JobStatusResponse{Job: job})
+	writeJSON(w, http.StatusOK, JobStatusResponse{Job: &job.IngestionJob})
 }
 
-func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := s.upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		s.logger.Error("WebSocket upgrade failed", zap.Error(err))
-		return
-	}
-
-	clientID := fmt.Sprintf("client_%d", time.Now().UnixNano())
-	s.clients.Store(clientID, conn)
-
-	s.logger.Info("WebSocket client connected", zap.String("client_id", clientID))
-
-	// Keep connection alive and handle client disconnect
-	go func() {
-		defer func() {
-			s.clients.Delete(clientID)
-			conn.Close()
-			s.logger.Info("WebSocket client disconnected", zap.String("client_id", clientID))
-		}()
-
-		for {
-			if _, _, err := conn.ReadMessage(); err != nil {
-				break
+func (s *Server) sendUpdate(update ProgressUpdate) {
+	s.events.publish(update, func(update ProgressUpdate) {
+		// Add to job progress
+		if jobValue, ok := s.jobs.Load(update.JobID); ok {
+			job := jobValue.(*IngestionJob)
+			job.mu.Lock()
+			job.Progress = append(job.Progress, update)
+			if len(job.Progress) > progressHistoryLimit {
+				job.Progress = compactProgress(job.Progress)
 			}
+			job.mu.Unlock()
+			s.dirty.Store(update.JobID, struct{}{})
 		}
-	}()
-}
-
-func (s *Server) broadcastUpdates() {
-	for update := range s.broadcast {
-		// Send to all connected WebSocket clients
-		s.clients.Range(func(key, value interface{}) bool {
-			conn := value.(*websocket.Conn)
-			if err := conn.WriteJSON(update); err != nil {
-				s.logger.Warn("Failed to send update to client",
-					zap.String("client_id", key.(string)),
-					zap.Error(err))
-			}
-			return true
-		})
-	}
-}
-
-func (s *Server) sendUpdate(update ProgressUpdate) {
-	// Add to job progress
-	if jobValue, ok := s.jobs.Load(update.JobID); ok {
-		job := jobValue.(*IngestionJob)
-		job.mu.Lock()
-		job.Progress = append(job.Progress, update)
-		job.mu.Unlock()
-	}
-
-	// Broadcast to WebSocket clients
-	select {
-	case s.broadcast <- update:
-	default:
-		s.logger.Warn("Broadcast channel full, dropping update")
-	}
+	})
 }
 
-func (s *Server) runIngestion(jobID string, req IngestRequest) {
+func (s *Server) runIngestion(traceCtx context.Context, jobID string, req IngestRequest) {
+	defer s.running.Done()
 	jobValue, _ := s.jobs.Load(jobID)
 	job := jobValue.(*IngestionJob)
 
+	_, span := tracing.Tracer().Start(traceCtx, "ingestion job", trace.WithAttributes(
+		tracing.JobKey.String(jobID),
+		attribute.StringSlice("chug.tables", job.Tables),
+	))
+	defer span.End()
+
 	job.mu.Lock()
 	job.Status = "running"
+	if span.SpanContext().IsSampled() {
+		job.TraceID = span.SpanContext().TraceID().String()
+	}
 	job.mu.Unlock()
+	s.saveJob(job)
 
 	s.sendUpdate(ProgressUpdate{
 		JobID:     jobID,
@@ -442,52 +565,29 @@ func (s *Server) runIngestion(jobID string, req IngestRequest) {
 		Timestamp: time.Now(),
 	})
 
-	// Build config
-	cfg := &config.Config{
-		PostgresURL:   s.getOrDefault(req.PgURL, s.config.PostgresURL),
-		ClickHouseURL: s.getOrDefault(req.ChURL, s.config.ClickHouseURL),
-		Limit:         req.Limit,
-		BatchSize:     req.BatchSize,
-	}
-
-	if req.Polling != nil {
-		cfg.Polling = *req.Polling
+	cfg, err := s.buildConfig(req)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		s.handleJobError(job, err.Error())
+		return
 	}
 
-	// Create table configs using per-table settings
-	for _, tableConfig := range req.Tables {
-		// Use table-specific config if provided, otherwise fall back to defaults
-		limit := tableConfig.Limit
-		if limit == nil {
-			limit = req.Limit
-		}
-		batchSize := tableConfig.BatchSize
-		if batchSize == nil {
-			batchSize = req.BatchSize
-		}
-		polling := tableConfig.Polling
-		if polling == nil {
-			polling = req.Polling
-		}
-
-		cfg.Tables = append(cfg.Tables, config.TableConfig{
-			Name:      tableConfig.Name,
-			Limit:     limit,
-			BatchSize: batchSize,
-			Polling:   polling,
-		})
-	}
+	job.mu.Lock()
+	ctx := trace.ContextWithSpan(job.contextLocked(), span)
+	job.mu.Unlock()
 
 	// Get PostgreSQL connection
-	ctx := context.Background()
-	pgConn, err := db.GetPostgresPool(cfg.PostgresURL)
+	pgConn, release, err := db.Pools.AcquirePostgres(cfg.PostgresURL)
 	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
 		s.handleJobError(job, fmt.Sprintf("Failed to connect to PostgreSQL: %v", err))
 		return
 	}
+	defer release()
 
 	// Create ingestion options with progress callbacks
 	opts := &etl.IngestOptions{
+		JobID: jobID,
 		OnTableStart: func(tableName string) {
 			s.sendUpdate(ProgressUpdate{
 				JobID:     jobID,
@@ -515,20 +615,28 @@ func (s *Server) runIngestion(jobID string, req IngestRequest) {
 				Timestamp: time.Now(),
 			})
 		},
-		OnProgress: func(tableName string, currentRows int64, totalRows int64, percentage float64, phase string) {
+		OnProgress: func(tableName string, progress etl.TableProgress) {
 			s.sendUpdate(ProgressUpdate{
-				JobID:       jobID,
-				Table:       tableName,
-				Event:       phase,
-				Message:     fmt.Sprintf("Processing: %d rows", currentRows),
-				CurrentRows: currentRows,
-				TotalRows:   totalRows,
-				Percentage:  percentage,
-				Phase:       phase,
-				Timestamp:   time.Now(),
+				JobID:          jobID,
+				Table:          tableName,
+				Event:          progress.Phase,
+				Message:        fmt.Sprintf("Processing: %d rows", progress.Inserted),
+				CurrentRows:    progress.Inserted,
+				ExtractedRows:  progress.Extracted,
+				TotalRows:      progress.Total,
+				TotalEstimated: progress.TotalEstimated,
+				Percentage:     progress.Percentage,
+				RowsPerSec:     progress.RowsPerSec,
+				BytesPerSec:    progress.BytesPerSec,
+				ETASeconds:     progress.ETA.Round(time.Second).Seconds(),
+				Phase:          progress.Phase,
+				Timestamp:      time.Now(),
 			})
 		},
 		OnTableComplete: func(tableName string, rowCount int64, duration time.Duration) {
+			if !pollingEnabled(cfg, tableName) {
+				s.finishTable(jobID, tableName)
+			}
 			s.sendUpdate(ProgressUpdate{
 				JobID:       jobID,
 				Table:       tableName,
@@ -543,6 +651,7 @@ func (s *Server) runIngestion(jobID string, req IngestRequest) {
 			})
 		},
 		OnTableError: func(tableName string, err error) {
+			s.finishTable(jobID, tableName)
 			s.sendUpdate(ProgressUpdate{
 				JobID:     jobID,
 				Table:     tableName,
@@ -552,8 +661,17 @@ func (s *Server) runIngestion(jobID string, req IngestRequest) {
 			})
 		},
 		StartPolling: func(ctx context.Context, tableConfig config.ResolvedTableConfig) {
-			s.startTablePolling(ctx, cfg, tableConfig, pgConn, jobID)
+			s.startTablePolling(ctx, cfg, tableConfig, jobID)
+		},
+		TableContext: func(ctx context.Context, tableName string) (context.Context, *etl.Control) {
+			return s.tableContext(job, ctx, tableName)
+		},
+		OnQueue: func(queued []string) {
+			s.setQueued(jobID, queued)
 		},
+		Pollers: &s.running,
+		Memory:  s.memory,
+		Workers: s.workers,
 	}
 
 	// Run ingestion
@@ -574,12 +692,22 @@ func (s *Server) runIngestion(jobID string, req IngestRequest) {
 		}
 	}
 
-	if allSuccess {
+	switch {
+	case job.cancelled:
+		job.Status = "cancelled"
+	case job.Status == "paused" && len(job.runs) > 0:
+		// Pollers stay paused, resume picks the final status
+	case allSuccess:
 		job.Status = "completed"
-	} else {
+	case errors.Is(context.Cause(ctx), errServerShutdown):
+		job.Status = "failed"
+		job.Error = "interrupted by server shutdown"
+	default:
 		job.Status = "failed"
 	}
+	span.SetAttributes(attribute.String("chug.status", job.Status))
 	job.mu.Unlock()
+	s.saveJob(job)
 
 	// Only send job_completed update if CDC is running (to keep tracking)
 	// Otherwise job is truly done and doesn't need WebSocket updates
@@ -602,6 +730,119 @@ func (s *Server) runIngestion(jobID string, req IngestRequest) {
 	}
 }
 
+// buildConfig turns an ingest request into a config, filling gaps from the server defaults
+func (s *Server) buildConfig(req IngestRequest) (*config.Config, error) {
+	pgURL, err := s.resolveConnection(req.PgConnection, req.PgURL, config.ConnectionPostgres)
+	if err != nil {
+		return nil, err
+	}
+	chURL, err := s.resolveConnection(req.ChConnection, req.ChURL, config.ConnectionClickHouse)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config.Config{
+		PostgresURL:   pgURL,
+		ClickHouseURL: chURL,
+		Limit:         req.Limit,
+		BatchSize:     req.BatchSize,
+		ExactCount:    req.ExactCount,
+		LoadMode:      req.LoadMode,
+		InsertWorkers: s.config.InsertWorkers,
+	}
+	cfg.MaxParallelTables = s.config.MaxParallelTables
+	if req.MaxParallelTables != nil {
+		cfg.MaxParallelTables = *req.MaxParallelTables
+	}
+
+	if req.Polling != nil {
+		cfg.Polling = *req.Polling
+	}
+	if req.ErrorPolicy != nil {
+		cfg.ErrorPolicy = *req.ErrorPolicy
+	}
+	if req.Retry != nil {
+		cfg.Retry = *req.Retry
+	}
+
+	// Create table configs using per-table settings
+	for _, tableConfig := range req.Tables {
+		// Use table-specific config if provided, otherwise fall back to defaults
+		limit := tableConfig.Limit
+		if limit == nil {
+			limit = req.Limit
+		}
+		batchSize := tableConfig.BatchSize
+		if batchSize == nil {
+			batchSize = req.BatchSize
+		}
+		polling := tableConfig.Polling
+		if polling == nil {
+			polling = req.Polling
+		}
+
+		var priority int
+		if tableConfig.Priority != nil {
+			priority = *tableConfig.Priority
+		}
+
+		cfg.Tables = append(cfg.Tables, config.TableConfig{
+			Name:        tableConfig.Name,
+			Limit:       limit,
+			BatchSize:   batchSize,
+			ExactCount:  tableConfig.ExactCount,
+			Priority:    priority,
+			LoadMode:    tableConfig.LoadMode,
+			DependsOn:   tableConfig.DependsOn,
+			PreSQL:      tableConfig.PreSQL,
+			PostSQL:     tableConfig.PostSQL,
+			Polling:     polling,
+			ErrorPolicy: tableConfig.ErrorPolicy,
+			Retry:       tableConfig.Retry,
+		})
+	}
+
+	return cfg, nil
+}
+
+// validateDependencies checks that the depends_on of tables name tables of
+// the same request and have no cycle
+func validateDependencies(tables []TableConfigRequest) error {
+	configs := make([]config.TableConfig, len(tables))
+	for i, tc := range tables {
+		configs[i] = config.TableConfig{Name: tc.Name, DependsOn: tc.DependsOn}
+	}
+	return config.ValidateDependencies(configs)
+}
+
+// validateHooks rejects pre_sql and post_sql unless the server accepts them
+// from API requests
+func (s *Server) validateHooks(tables []TableConfigRequest) error {
+	if s.config.Server.AllowSQLHooks {
+		return nil
+	}
+	for _, tc := range tables {
+		if tc.PreSQL != nil || tc.PostSQL != nil {
+			return fmt.Errorf("table %s: pre_sql and post_sql are not accepted by this server (see server.allow_sql_hooks)", tc.Name)
+		}
+	}
+	return nil
+}
+
+// pruneDependencies drops the dependencies on tables outside tables, which
+// loaded in an earlier run
+func pruneDependencies(tables []TableConfigRequest) {
+	for i, tc := range tables {
+		var deps []string
+		for _, dep := range tc.DependsOn {
+			if slices.ContainsFunc(tables, func(t TableConfigRequest) bool { return t.Name == dep }) {
+				deps = append(deps, dep)
+			}
+		}
+		tables[i].DependsOn = deps
+	}
+}
+
 func (s *Server) handleJobError(job *IngestionJob, errMsg string) {
 	job.mu.Lock()
 	job.Status = "failed"
@@ -609,6 +850,7 @@ func (s *Server) handleJobError(job *IngestionJob, errMsg string) {
 	endTime := time.Now()
 	job.EndTime = &endTime
 	job.mu.Unlock()
+	s.saveJob(job)
 
 	s.sendUpdate(ProgressUpdate{
 		JobID:     job.ID,
@@ -618,18 +860,41 @@ func (s *Server) handleJobError(job *IngestionJob, errMsg string) {
 	})
 }
 
-func (s *Server) getOrDefault(value, defaultValue string) string {
-	if value != "" {
-		return value
+// pollingEnabled reports whether CDC polling follows the initial load of a table
+func pollingEnabled(cfg *config.Config, table string) bool {
+	for _, tc := range cfg.Tables {
+		if tc.Name == table {
+			return cfg.ResolveTableConfig(tc).Polling.Enabled
+		}
 	}
-	return defaultValue
+	return false
 }
 
-func (s *Server) startTablePolling(ctx context.Context, cfg *config.Config, tableConfig config.ResolvedTableConfig, pgConn *pgxpool.Pool, jobID string) {
+func (s *Server) startTablePolling(ctx context.Context, cfg *config.Config, tableConfig config.ResolvedTableConfig, jobID string) {
 	if !tableConfig.Polling.Enabled {
 		s.logger.Warn("Polling not enabled for table", zap.String("table", tableConfig.Name))
 		return
 	}
+	defer s.finishTable(jobID, tableConfig.Name)
+
+	// Hold our own references so the pools outlive the ingestion job
+	pgConn, releasePG, err := db.Pools.AcquirePostgres(cfg.PostgresURL)
+	if err != nil {
+		s.logger.Error("CDC poller could not connect to PostgreSQL",
+			zap.String("table", tableConfig.Name),
+			zap.Error(err))
+		return
+	}
+	defer releasePG()
+
+	_, releaseCH, err := db.Pools.AcquireClickHouse(cfg.ClickHouseURL)
+	if err != nil {
+		s.logger.Error("CDC poller could not connect to ClickHouse",
+			zap.String("table", tableConfig.Name),
+			zap.Error(err))
+		return
+	}
+	defer releaseCH()
 
 	s.logger.Info("Starting CDC polling",
 		zap.String("table", tableConfig.Name),
@@ -643,57 +908,92 @@ func (s *Server) startTablePolling(ctx context.Context, cfg *config.Config, tabl
 			zap.Error(err))
 	}
 
-	// Get MAX value of delta column to start from
-	var lastSeenValue string
-	query := fmt.Sprintf("SELECT MAX(%s) FROM %s", tableConfig.Polling.DeltaCol, tableConfig.Name)
-	var maxValue any
-	if err := pgConn.QueryRow(ctx, query).Scan(&maxValue); err != nil {
-		s.logger.Warn("Could not determine max delta value, starting from epoch",
-			zap.String("table", tableConfig.Name),
-			zap.Error(err))
-		lastSeenValue = "1970-01-01 00:00:00"
-	} else if maxValue != nil {
-		switch v := maxValue.(type) {
-		case time.Time:
-			lastSeenValue = v.Format("2006-01-02 15:04:05.999999")
-		case string:
-			lastSeenValue = v
-		case int, int64, int32, int16, int8:
-			lastSeenValue = fmt.Sprintf("%d", v)
-		case float64, float32:
-			lastSeenValue = fmt.Sprintf("%f", v)
-		default:
-			if t, ok := v.(time.Time); ok {
-				lastSeenValue = t.Format("2006-01-02 15:04:05.999999")
-			} else {
-				lastSeenValue = fmt.Sprintf("%v", v)
+	// Resume from the poller's last checkpoint, otherwise from the MAX value
+	// of the delta column, which the initial load has just copied
+	lastSeenValue := s.checkpoint(jobID, tableConfig.Name)
+	if lastSeenValue == "" {
+		query := fmt.Sprintf("SELECT MAX(%s) FROM %s", tableConfig.Polling.DeltaCol, tableConfig.Name)
+		var maxValue any
+		if err := pgConn.QueryRow(ctx, query).Scan(&maxValue); err != nil {
+			s.logger.Warn("Could not determine max delta value, starting from epoch",
+				zap.String("table", tableConfig.Name),
+				zap.Error(err))
+			lastSeenValue = "1970-01-01 00:00:00"
+		} else if maxValue != nil {
+			switch v := maxValue.(type) {
+			case time.Time:
+				lastSeenValue = v.Format("2006-01-02 15:04:05.999999")
+			case string:
+				lastSeenValue = v
+			case int, int64, int32, int16, int8:
+				lastSeenValue = fmt.Sprintf("%d", v)
+			case float64, float32:
+				lastSeenValue = fmt.Sprintf("%f", v)
+			default:
+				if t, ok := v.(time.Time); ok {
+					lastSeenValue = t.Format("2006-01-02 15:04:05.999999")
+				} else {
+					lastSeenValue = fmt.Sprintf("%v", v)
+				}
 			}
+		} else {
+			lastSeenValue = "1970-01-01 00:00:00"
 		}
-	} else {
-		lastSeenValue = "1970-01-01 00:00:00"
 	}
 
 	s.logger.Info("Starting poller",
 		zap.String("table", tableConfig.Name),
 		zap.String("last_seen", lastSeenValue))
 
+	dlq, err := etl.NewDeadLetterQueue(cfg.ClickHouseURL, tableConfig.Name, tableConfig.ErrorPolicy)
+	if err != nil {
+		s.logger.Error("Dead-letter queue setup failed",
+			zap.String("table", tableConfig.Name),
+			zap.Error(err))
+		return
+	}
+	if dlq != nil {
+		defer dlq.Close()
+	}
+	retry := etl.RetryConfigFromPolicy(tableConfig.Retry)
+	tableMetrics := metrics.ForTable(jobID, tableConfig.Name)
+	insertOpts := &etl.InsertOptions{
+		Retry:     &retry,
+		DLQ:       dlq,
+		MaxErrors: tableConfig.ErrorPolicy.MaxErrors,
+		Metrics:   tableMetrics,
+		Memory:    s.memory,
+		Workers:   s.workers,
+	}
+
 	// Create poller config
-	processNewData := func(data *etl.TableData) error {
-		if len(data.Rows) > 0 {
-			s.logger.Info("CDC: Processing new data batch",
+	processNewData := func(ctx context.Context, stream *etl.StreamResult) error {
+		stats, err := etl.InsertRowsStreaming(ctx, cfg.ClickHouseURL, tableConfig.Name, etl.GetColumnNames(stream.Columns), stream.RowChan, tableConfig.BatchSize, insertOpts)
+		if stats.Inserted > 0 {
+			s.logger.Info("CDC: Synced new rows",
 				zap.String("table", tableConfig.Name),
-				zap.Int("rows", len(data.Rows)))
+				zap.Int64("rows", stats.Inserted))
 
 			s.sendUpdate(ProgressUpdate{
 				JobID:     jobID,
 				Table:     tableConfig.Name,
 				Event:     "cdc_update",
-				Message:   fmt.Sprintf("CDC: Syncing %d new rows", len(data.Rows)),
-				RowCount:  int64(len(data.Rows)),
+				Message:   fmt.Sprintf("CDC: Synced %d new rows", stats.Inserted),
+				RowCount:  stats.Inserted,
 				Timestamp: time.Now(),
 			})
 		}
-		return etl.InsertRows(cfg.ClickHouseURL, tableConfig.Name, etl.GetColumnNames(data.Columns), data.Rows, tableConfig.BatchSize)
+		if stats.DeadLettered > 0 {
+			s.sendUpdate(ProgressUpdate{
+				JobID:        jobID,
+				Table:        tableConfig.Name,
+				Event:        "dead_letter",
+				Message:      fmt.Sprintf("CDC: %d rows written to dead-letter queue", stats.DeadLettered),
+				DeadLettered: stats.DeadLettered,
+				Timestamp:    time.Now(),
+			})
+		}
+		return err
 	}
 
 	limit := tableConfig.Limit
@@ -704,14 +1004,38 @@ func (s *Server) startTablePolling(ctx context.Context, cfg *config.Config, tabl
 		Limit:     &limit,
 		StartFrom: lastSeenValue,
 		OnData:    processNewData,
+		Source:    db.PostgresBreaker(cfg.PostgresURL),
+		Target:    db.ClickHouseBreaker(cfg.ClickHouseURL),
+		Control:   s.tableControl(jobID, tableConfig.Name),
+		Metrics:   tableMetrics,
+		Memory:    s.memory,
+		OnCheckpoint: func(lastSeen string) {
+			s.setCheckpoint(jobID, tableConfig.Name, lastSeen)
+		},
 	}
 
 	p := poller.NewPoller(pgConn, pollConfig)
 
+	s.setPolling(jobID, tableConfig.Name, true)
+
 	// Start poller in background
-	if err := p.Start(ctx); err != nil && err != context.Canceled {
+	err = p.Start(ctx)
+	// A poller stopped by shutdown matches no case and stays recorded, so it
+	// is re-attached on restart
+	switch {
+	case errors.Is(context.Cause(ctx), errJobCancelled):
+		s.setPolling(jobID, tableConfig.Name, false)
+	case err != nil && err != context.Canceled:
 		s.logger.Error("CDC poller stopped with error",
 			zap.String("table", tableConfig.Name),
 			zap.Error(err))
+		s.sendUpdate(ProgressUpdate{
+			JobID:     jobID,
+			Table:     tableConfig.Name,
+			Event:     "error",
+			Message:   fmt.Sprintf("CDC polling stopped: %v", err),
+			Timestamp: time.Now(),
+		})
+		s.setPolling(jobID, tableConfig.Name, false)
 	}
 }
@@ -0,0 +1,389 @@
+package api
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pixperk/chug/api/types"
+	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/db"
+	"go.uber.org/zap"
+)
+
+// JobRecord is the persisted form of an ingestion job
+type JobRecord struct {
+	Job      *types.IngestionJob `json:"job"`
+	Request  IngestRequest       `json:"request"`            // original request, used to re-attach CDC pollers
+	Redacted bool                `json:"redacted,omitempty"` // passwords were removed from the request URLs
+}
+
+// ScheduleRecord is the persisted form of a schedule created through the API.
+// Its runs are not kept, they are recovered from the jobs it started.
+type ScheduleRecord struct {
+	Schedule *types.Schedule `json:"schedule"`
+	Request  IngestRequest   `json:"request"`
+	Redacted bool            `json:"redacted,omitempty"` // passwords were removed from the request URLs
+}
+
+// JobStore persists jobs so history and CDC pollers survive a restart of chug
+// serve, and the schedules created through the API so they keep running
+type JobStore interface {
+	Save(record *JobRecord) error
+	List() ([]*JobRecord, error)
+	Delete(id string) error
+	SaveSchedule(record *ScheduleRecord) error
+	ListSchedules() ([]*ScheduleRecord, error)
+	DeleteSchedule(id string) error
+	Close() error
+}
+
+// NewJobStore opens the job store described by cfg. pgURL is used by the
+// postgres store when cfg.URL is empty.
+func NewJobStore(cfg config.JobStoreConfig, pgURL string) (JobStore, error) {
+	switch cfg.Type {
+	case "", config.JobStoreFile:
+		path := cfg.Path
+		if path == "" {
+			path = ".chug/jobs"
+		}
+		return NewFileJobStore(path)
+	case config.JobStorePostgres:
+		url := cfg.URL
+		if url == "" {
+			url = pgURL
+		}
+		if url == "" {
+			return nil, fmt.Errorf("postgres job store needs job_store.url or pg_url")
+		}
+		return NewPostgresJobStore(url)
+	case config.JobStoreMemory:
+		return NewMemoryJobStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown job store type %q (want file, postgres or memory)", cfg.Type)
+	}
+}
+
+// MemoryJobStore keeps jobs and schedules in memory only
+type MemoryJobStore struct {
+	mu        sync.Mutex
+	records   map[string]*JobRecord
+	schedules map[string]*ScheduleRecord
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		records:   make(map[string]*JobRecord),
+		schedules: make(map[string]*ScheduleRecord),
+	}
+}
+
+func (m *MemoryJobStore) Save(record *JobRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[record.Job.ID] = record
+	return nil
+}
+
+func (m *MemoryJobStore) List() ([]*JobRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	records := make([]*JobRecord, 0, len(m.records))
+	for _, record := range m.records {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (m *MemoryJobStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, id)
+	return nil
+}
+
+func (m *MemoryJobStore) SaveSchedule(record *ScheduleRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.schedules[record.Schedule.ID] = record
+	return nil
+}
+
+func (m *MemoryJobStore) ListSchedules() ([]*ScheduleRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Collect(maps.Values(m.schedules)), nil
+}
+
+func (m *MemoryJobStore) DeleteSchedule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.schedules, id)
+	return nil
+}
+
+func (m *MemoryJobStore) Close() error {
+	return nil
+}
+
+// jobFlushInterval is how often progress of running jobs is written to the store
+const jobFlushInterval = 2 * time.Second
+
+// snapshot copies the job under its lock so it can be encoded safely
+func (j *IngestionJob) snapshot() *types.IngestionJob {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return &types.IngestionJob{
+		ID:            j.ID,
+		Status:        j.Status,
+		Tables:        j.Tables,
+		TableConfigs:  j.TableConfigs,
+		Results:       j.Results,
+		Progress:      j.Progress,
+		StartTime:     j.StartTime,
+		EndTime:       j.EndTime,
+		Error:         j.Error,
+		PollingTables: append([]string(nil), j.PollingTables...),
+		Queued:        j.Queued,
+		RetryOf:       j.RetryOf,
+		Retries:       append([]string(nil), j.Retries...),
+		TraceID:       j.TraceID,
+		ScheduleID:    j.ScheduleID,
+		Checkpoints:   maps.Clone(j.Checkpoints),
+	}
+}
+
+func (s *Server) saveJob(job *IngestionJob) {
+	if s.store == nil {
+		return
+	}
+	job.saveMu.Lock()
+	defer job.saveMu.Unlock()
+	s.dirty.Delete(job.ID)
+	req, redacted := redactRequest(job.request)
+	record := &JobRecord{Job: job.snapshot(), Request: req, Redacted: redacted || job.redacted}
+	if err := s.store.Save(record); err != nil {
+		s.logger.Warn("Failed to persist job", zap.String("job_id", job.ID), zap.Error(err))
+	}
+}
+
+// redactRequest removes passwords from the raw URLs of a request before it is
+// persisted. Requests that name connection profiles carry no secrets.
+func redactRequest(req IngestRequest) (IngestRequest, bool) {
+	pgURL, chURL := db.RedactDSN(req.PgURL), db.RedactDSN(req.ChURL)
+	redacted := pgURL != req.PgURL || chURL != req.ChURL
+	req.PgURL, req.ChURL = pgURL, chURL
+	return req, redacted
+}
+
+// flushJobs periodically persists jobs whose progress changed
+func (s *Server) flushJobs() {
+	ticker := time.NewTicker(jobFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.dirty.Range(func(key, _ interface{}) bool {
+			if jobValue, ok := s.jobs.Load(key); ok {
+				s.saveJob(jobValue.(*IngestionJob))
+			}
+			return true
+		})
+	}
+}
+
+// checkpoint returns the last delta value synced by the poller of a table, "" if none
+func (s *Server) checkpoint(jobID, table string) string {
+	jobValue, ok := s.jobs.Load(jobID)
+	if !ok {
+		return ""
+	}
+	job := jobValue.(*IngestionJob)
+	job.mu.RLock()
+	defer job.mu.RUnlock()
+	return job.Checkpoints[table]
+}
+
+// setCheckpoint records the last delta value synced by the poller of a table.
+// It is persisted with the job's next flush, and on shutdown.
+func (s *Server) setCheckpoint(jobID, table, lastSeen string) {
+	jobValue, ok := s.jobs.Load(jobID)
+	if !ok {
+		return
+	}
+	job := jobValue.(*IngestionJob)
+	job.mu.Lock()
+	if job.Checkpoints == nil {
+		job.Checkpoints = make(map[string]string)
+	}
+	job.Checkpoints[table] = lastSeen
+	job.mu.Unlock()
+	s.dirty.Store(jobID, struct{}{})
+}
+
+// setPolling records whether a CDC poller is running for a table of a job
+func (s *Server) setPolling(jobID, table string, active bool) {
+	jobValue, ok := s.jobs.Load(jobID)
+	if !ok {
+		return
+	}
+	job := jobValue.(*IngestionJob)
+
+	job.mu.Lock()
+	tables := make([]string, 0, len(job.PollingTables)+1)
+	for _, t := range job.PollingTables {
+		if t != table {
+			tables = append(tables, t)
+		}
+	}
+	if active {
+		tables = append(tables, table)
+	}
+	job.PollingTables = tables
+	job.mu.Unlock()
+
+	s.saveJob(job)
+}
+
+// setQueued records the tables of a job waiting to start and announces
+// the ones that just joined the queue
+func (s *Server) setQueued(jobID string, queued []string) {
+	jobValue, ok := s.jobs.Load(jobID)
+	if !ok {
+		return
+	}
+	job := jobValue.(*IngestionJob)
+
+	job.mu.Lock()
+	joined := make(map[string]int)
+	for i, table := range queued {
+		if !slices.Contains(job.Queued, table) {
+			joined[table] = i + 1
+		}
+	}
+	job.Queued = queued
+	job.mu.Unlock()
+
+	for _, table := range queued {
+		position, ok := joined[table]
+		if !ok {
+			continue
+		}
+		s.sendUpdate(ProgressUpdate{
+			JobID:         jobID,
+			Table:         table,
+			Event:         "queued",
+			Message:       fmt.Sprintf("Waiting to start (position %d)", position),
+			Phase:         "queued",
+			QueuePosition: position,
+			Timestamp:     time.Now(),
+		})
+	}
+	s.saveJob(job)
+}
+
+// restoreJobs loads jobs from the store. Jobs cut off mid-run are marked
+// failed, and CDC pollers that were running are started again (tables that
+// finished their initial load keep polling even if the job was cut off).
+func (s *Server) restoreJobs() error {
+	if s.store == nil {
+		return nil
+	}
+
+	records, err := s.store.List()
+	if err != nil {
+		return fmt.Errorf("failed to load jobs: %w", err)
+	}
+
+	// Keep sequence numbers increasing across restarts so clients can resume
+	var lastSeq int64
+	for _, record := range records {
+		for _, update := range record.Job.Progress {
+			lastSeq = max(lastSeq, update.Seq)
+		}
+	}
+	s.events.setSeq(lastSeq)
+
+	for _, record := range records {
+		job := &IngestionJob{IngestionJob: *record.Job, request: record.Request, redacted: record.Redacted}
+		if len(job.Progress) > progressHistoryLimit {
+			job.Progress = compactProgress(job.Progress)
+		}
+
+		switch {
+		case job.Status == "cancelling":
+			job.Status = "cancelled"
+			job.PollingTables = nil
+		case job.Status == "cancelled":
+			job.PollingTables = nil
+		case job.EndTime == nil:
+			// pending, running, or paused during the initial load
+			endTime := time.Now()
+			job.Status = "failed"
+			job.Error = "interrupted by server restart"
+			job.EndTime = &endTime
+		}
+		// Queued tables only start within the run that queued them
+		job.Queued = nil
+		if job.redacted && len(job.PollingTables) > 0 {
+			s.logger.Warn("Not re-attaching CDC pollers, the job's connection URLs were not persisted; use named connections",
+				zap.String("job_id", job.ID),
+				zap.Strings("tables", job.PollingTables))
+			job.PollingTables = nil
+		}
+		s.jobs.Store(job.ID, job)
+		s.saveJob(job)
+
+		if len(job.PollingTables) > 0 {
+			s.resumePolling(job)
+		}
+	}
+
+	if len(records) > 0 {
+		s.logger.Info("Restored jobs from store", zap.Int("jobs", len(records)))
+	}
+	s.pruneJobs()
+	return nil
+}
+
+func (s *Server) resumePolling(job *IngestionJob) {
+	polling := job.snapshot().PollingTables
+	cfg, err := s.buildConfig(job.request)
+	if err != nil {
+		s.logger.Warn("Not re-attaching CDC pollers", zap.String("job_id", job.ID), zap.Error(err))
+		job.mu.Lock()
+		job.PollingTables = nil
+		job.mu.Unlock()
+		s.saveJob(job)
+		return
+	}
+
+	job.mu.Lock()
+	ctx := job.contextLocked()
+	job.mu.Unlock()
+
+	for _, tc := range cfg.Tables {
+		if !slices.Contains(polling, tc.Name) {
+			continue
+		}
+		resolved := cfg.ResolveTableConfig(tc)
+
+		s.logger.Info("Re-attaching CDC poller",
+			zap.String("job_id", job.ID),
+			zap.String("table", tc.Name))
+		s.sendUpdate(ProgressUpdate{
+			JobID:     job.ID,
+			Table:     tc.Name,
+			Event:     "cdc_resumed",
+			Message:   "CDC polling resumed after server restart",
+			Timestamp: time.Now(),
+		})
+
+		tableCtx, _ := s.tableContext(job, ctx, tc.Name)
+		s.running.Add(1)
+		go func() {
+			defer s.running.Done()
+			s.startTablePolling(tableCtx, cfg, resolved, job.ID)
+		}()
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pixperk/chug/internal/logx"
+	"go.uber.org/zap"
+)
+
+// FileJobStore keeps one JSON file per job in a directory, and one per API
+// schedule in its schedules subdirectory
+type FileJobStore struct {
+	dir string
+}
+
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "schedules"), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory: %w", err)
+	}
+	return &FileJobStore{dir: dir}, nil
+}
+
+func (f *FileJobStore) Save(record *JobRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", record.Job.ID, err)
+	}
+	if err := writeFileAtomic(f.dir, record.Job.ID, data); err != nil {
+		return fmt.Errorf("failed to write job %s: %w", record.Job.ID, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes dir/name.json through a temp file of its own and a
+// rename, so a crash never leaves a half-written file and concurrent writes
+// never share one
+func writeFileAtomic(dir, name string, data []byte) error {
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name+".json"))
+}
+
+func (f *FileJobStore) List() ([]*JobRecord, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job store directory: %w", err)
+	}
+
+	records := make([]*JobRecord, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(f.dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logx.Logger.Warn("Skipping unreadable job file", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		var record JobRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			f.quarantine(path, err)
+			continue
+		}
+		if record.Job == nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+// quarantine renames a file that cannot be decoded out of the way, so one
+// damaged file does not stop the server from starting
+func (f *FileJobStore) quarantine(path string, cause error) {
+	corrupt := path + ".corrupt"
+	if err := os.Rename(path, corrupt); err != nil {
+		logx.Logger.Warn("Skipping undecodable file", zap.String("path", path), zap.NamedError("cause", cause), zap.Error(err))
+		return
+	}
+	logx.Logger.Warn("Moved undecodable file aside", zap.String("path", corrupt), zap.Error(cause))
+}
+
+func (f *FileJobStore) Delete(id string) error {
+	if err := os.Remove(filepath.Join(f.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete job %s: %w", id, err)
+	}
+	return nil
+}
+
+func (f *FileJobStore) SaveSchedule(record *ScheduleRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule %s: %w", record.Schedule.ID, err)
+	}
+	if err := writeFileAtomic(filepath.Join(f.dir, "schedules"), record.Schedule.ID, data); err != nil {
+		return fmt.Errorf("failed to write schedule %s: %w", record.Schedule.ID, err)
+	}
+	return nil
+}
+
+func (f *FileJobStore) ListSchedules() ([]*ScheduleRecord, error) {
+	dir := filepath.Join(f.dir, "schedules")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule directory: %w", err)
+	}
+
+	records := make([]*ScheduleRecord, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logx.Logger.Warn("Skipping unreadable schedule file", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		var record ScheduleRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			f.quarantine(path, err)
+			continue
+		}
+		if record.Schedule == nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, nil
+}
+
+func (f *FileJobStore) DeleteSchedule(id string) error {
+	if err := os.Remove(filepath.Join(f.dir, "schedules", id+".json")); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete schedule %s: %w", id, err)
+	}
+	return nil
+}
+
+func (f *FileJobStore) Close() error {
+	return nil
+}
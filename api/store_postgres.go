@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/internal/db"
+	"github.com/pixperk/chug/internal/logx"
+	"go.uber.org/zap"
+)
+
+const (
+	jobsTableName      = "_chug_jobs"
+	schedulesTableName = "_chug_schedules"
+)
+
+// PostgresJobStore keeps jobs in the _chug_jobs table and API schedules in
+// the _chug_schedules table
+type PostgresJobStore struct {
+	pool    *pgxpool.Pool
+	release func()
+}
+
+func NewPostgresJobStore(pgURL string) (*PostgresJobStore, error) {
+	pool, release, err := db.Pools.AcquirePostgres(pgURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to job store: %w", err)
+	}
+
+	ddl := `CREATE TABLE IF NOT EXISTS ` + jobsTableName + ` (
+		id         TEXT PRIMARY KEY,
+		status     TEXT NOT NULL,
+		record     JSONB NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`
+	if _, err := pool.Exec(context.Background(), ddl); err != nil {
+		release()
+		return nil, fmt.Errorf("failed to create %s table: %w", jobsTableName, err)
+	}
+
+	ddl = `CREATE TABLE IF NOT EXISTS ` + schedulesTableName + ` (
+		id         TEXT PRIMARY KEY,
+		record     JSONB NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`
+	if _, err := pool.Exec(context.Background(), ddl); err != nil {
+		release()
+		return nil, fmt.Errorf("failed to create %s table: %w", schedulesTableName, err)
+	}
+
+	return &PostgresJobStore{pool: pool, release: release}, nil
+}
+
+func (p *PostgresJobStore) Save(record *JobRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode job %s: %w", record.Job.ID, err)
+	}
+
+	_, err = p.pool.Exec(context.Background(), `
+		INSERT INTO `+jobsTableName+` (id, status, record, updated_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (id) DO UPDATE
+		SET status = EXCLUDED.status, record = EXCLUDED.record, updated_at = now()`,
+		record.Job.ID, record.Job.Status, data)
+	if err != nil {
+		return fmt.Errorf("failed to save job %s: %w", record.Job.ID, err)
+	}
+	return nil
+}
+
+func (p *PostgresJobStore) List() ([]*JobRecord, error) {
+	rows, err := p.pool.Query(context.Background(), `SELECT record FROM `+jobsTableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*JobRecord
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read job: %w", err)
+		}
+		var record JobRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			logx.Logger.Warn("Skipping undecodable job", zap.Error(err))
+			continue
+		}
+		if record.Job == nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
+
+func (p *PostgresJobStore) Delete(id string) error {
+	if _, err := p.pool.Exec(context.Background(), `DELETE FROM `+jobsTableName+` WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete job %s: %w", id, err)
+	}
+	return nil
+}
+
+func (p *PostgresJobStore) SaveSchedule(record *ScheduleRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule %s: %w", record.Schedule.ID, err)
+	}
+
+	_, err = p.pool.Exec(context.Background(), `
+		INSERT INTO `+schedulesTableName+` (id, record, updated_at)
+		VALUES ($1, $2, now())
+		ON CONFLICT (id) DO UPDATE
+		SET record = EXCLUDED.record, updated_at = now()`,
+		record.Schedule.ID, data)
+	if err != nil {
+		return fmt.Errorf("failed to save schedule %s: %w", record.Schedule.ID, err)
+	}
+	return nil
+}
+
+func (p *PostgresJobStore) ListSchedules() ([]*ScheduleRecord, error) {
+	rows, err := p.pool.Query(context.Background(), `SELECT record FROM `+schedulesTableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var records []*ScheduleRecord
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to read schedule: %w", err)
+		}
+		var record ScheduleRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			logx.Logger.Warn("Skipping undecodable schedule", zap.Error(err))
+			continue
+		}
+		if record.Schedule == nil {
+			continue
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
+
+func (p *PostgresJobStore) DeleteSchedule(id string) error {
+	if _, err := p.pool.Exec(context.Background(), `DELETE FROM `+schedulesTableName+` WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete schedule %s: %w", id, err)
+	}
+	return nil
+}
+
+func (p *PostgresJobStore) Close() error {
+	p.release()
+	return nil
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pixperk/chug/api/types"
+	"go.uber.org/zap"
+)
+
+const (
+	sseHeartbeat = 15 * time.Second // comment lines keep proxies from closing idle streams
+
+	longPollDefault = 30 * time.Second
+	longPollMax     = 60 * time.Second
+)
+
+type PollEventsResponse = types.PollEventsResponse
+
+// handleEvents serves GET /api/v1/events (SSE) and /api/v1/events/poll (long-poll) for every job
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if r.URL.Path == "/api/v1/events/poll" {
+		s.pollEvents(w, r, "")
+		return
+	}
+	s.streamEvents(w, r, "")
+}
+
+// handleJobEvents serves GET /api/v1/jobs/{id}/events (SSE) and /api/v1/jobs/{id}/events/poll (long-poll)
+func (s *Server) handleJobEvents(w http.ResponseWriter, r *http.Request, jobID, action string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if _, ok := s.jobs.Load(jobID); !ok {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Job not found")
+		return
+	}
+	if action == "events/poll" {
+		s.pollEvents(w, r, jobID)
+		return
+	}
+	s.streamEvents(w, r, jobID)
+}
+
+// jobDone reports whether a job has finished and has no running pollers.
+// The feed of every job ("") never ends.
+func (s *Server) jobDone(jobID string) bool {
+	if jobID == "" {
+		return false
+	}
+	jobValue, ok := s.jobs.Load(jobID)
+	if !ok {
+		return true
+	}
+	job := jobValue.(*IngestionJob)
+	job.mu.RLock()
+	defer job.mu.RUnlock()
+	return !job.activeLocked()
+}
+
+// eventsSince reads the cursor from ?since= or, for reconnecting EventSource
+// clients, the Last-Event-ID header
+func eventsSince(r *http.Request, jobID string) (int64, error) {
+	if id := r.Header.Get("Last-Event-ID"); id != "" && r.URL.Query().Get("since") == "" {
+		since, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || since < 0 {
+			return 0, fmt.Errorf("invalid Last-Event-ID: %q", id)
+		}
+		return since, nil
+	}
+	return parseSince(r, jobID)
+}
+
+// streamEvents sends updates as Server-Sent Events until the client goes away
+// or the job is done. The id of each event is its seq.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, jobID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, CodeInternal, "Streaming not supported")
+		return
+	}
+	since, err := eventsSince(r, jobID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	sub, missed := s.subscribe(jobID, since)
+	defer s.events.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable nginx response buffering
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	var lastSeq int64
+	send := func(update ProgressUpdate) error {
+		data, err := json.Marshal(update)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", update.Seq, data); err != nil {
+			return err
+		}
+		lastSeq = update.Seq
+		return nil
+	}
+
+	for _, update := range missed {
+		if err := send(update); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	doneCheck := time.NewTicker(time.Second)
+	defer doneCheck.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case update, ok := <-sub.queue:
+			if !ok {
+				// Dropped for falling behind, or the server is shutting down;
+				// EventSource reconnects with Last-Event-ID
+				if s.events.isLagged(sub) {
+					s.logger.Warn("Dropping slow event stream client", zap.String("job_id", jobID))
+				}
+				return
+			}
+			if update.Seq <= lastSeq {
+				continue
+			}
+			if err := send(update); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-doneCheck.C:
+			if len(sub.queue) == 0 && s.jobDone(jobID) {
+				fmt.Fprint(w, "event: done\ndata: {}\n\n")
+				flusher.Flush()
+				return
+			}
+		}
+	}
+}
+
+// pollEvents returns the updates after ?since= at once, or waits up to
+// ?timeout= seconds for the next ones
+func (s *Server) pollEvents(w http.ResponseWriter, r *http.Request, jobID string) {
+	since, err := parseSince(r, jobID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	timeout := longPollDefault
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		secs, err := strconv.Atoi(value)
+		if err != nil || secs < 0 {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid timeout: %q", value))
+			return
+		}
+		timeout = min(time.Duration(secs)*time.Second, longPollMax)
+	}
+
+	sub, updates := s.subscribe(jobID, since)
+	defer s.events.unsubscribe(sub)
+
+	if len(updates) == 0 && !s.jobDone(jobID) {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case update, ok := <-sub.queue:
+			if ok {
+				updates = append(updates, update)
+			}
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	cursor := s.events.lastSeq()
+	// Pick up anything published together with the first update
+drain:
+	for {
+		select {
+		case update, ok := <-sub.queue:
+			if !ok {
+				break drain
+			}
+			updates = append(updates, update)
+		default:
+			break drain
+		}
+	}
+
+	response := PollEventsResponse{Updates: updates, NextSince: since, Done: s.jobDone(jobID)}
+	if response.Updates == nil {
+		response.Updates = []ProgressUpdate{}
+	}
+	if len(updates) > 0 {
+		response.NextSince = updates[len(updates)-1].Seq
+	} else if since < 0 {
+		// First poll of the feed of every job: continue from the current position
+		response.NextSince = cursor
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
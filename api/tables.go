@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/api/types"
+	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/db"
+	"github.com/pixperk/chug/internal/etl"
+)
+
+type (
+	PreviewResponse = types.PreviewResponse
+	VerifyResponse  = types.VerifyResponse
+)
+
+// handleTableAction serves /api/v1/tables/{name}/{action}
+func (s *Server) handleTableAction(w http.ResponseWriter, r *http.Request) {
+	name, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v1/tables/"), "/")
+	if !ok || name == "" || (action != "preview" && action != "verify") {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Not found")
+		return
+	}
+	if r.Method != http.MethodGet && (action != "verify" || r.Method != http.MethodPost) {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !etl.IsValidIdentifier(name) {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid table name: %q", name))
+		return
+	}
+
+	pgURL, chURL, ok := s.tableConnections(w, r)
+	if !ok {
+		return
+	}
+	pgConn, release, err := db.Pools.AcquirePostgres(pgURL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeDatabaseError, fmt.Sprintf("Failed to connect to PostgreSQL: %v", err))
+		return
+	}
+	defer release()
+
+	if action == "verify" {
+		s.handleTableVerify(w, r, pgConn, chURL, name)
+	} else {
+		s.handleTablePreview(w, r, pgConn, chURL, name)
+	}
+}
+
+// tableConnections resolves the PostgreSQL and ClickHouse URLs of a table
+// request, writing the error response when they are not usable
+func (s *Server) tableConnections(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	query := r.URL.Query()
+	pgURL, err := s.resolveConnection(query.Get("connection"), query.Get("pg_url"), config.ConnectionPostgres)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidConnection, err.Error())
+		return "", "", false
+	}
+	if pgURL == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidConnection, "PostgreSQL URL not configured")
+		return "", "", false
+	}
+	chURL, err := s.resolveConnection(query.Get("ch_connection"), query.Get("ch_url"), config.ConnectionClickHouse)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidConnection, err.Error())
+		return "", "", false
+	}
+	return pgURL, chURL, true
+}
+
+// handleTablePreview serves GET /api/v1/tables/{name}/preview: the DDL, type
+// mapping and row estimate of a table, and how it differs from the existing
+// ClickHouse table, without creating anything
+func (s *Server) handleTablePreview(w http.ResponseWriter, r *http.Request, pgConn *pgxpool.Pool, chURL, name string) {
+	query := r.URL.Query()
+
+	// The DDL depends on whether the table will be polled
+	deltaCol := query.Get("delta_column")
+	tableConfig := config.ResolvedTableConfig{
+		Name:    name,
+		Polling: config.PollingConfig{Enabled: deltaCol != "", DeltaCol: deltaCol},
+	}
+	plan, err := etl.PlanTable(r.Context(), pgConn, chURL, tableConfig)
+	if errors.Is(err, etl.ErrTableNotFound) {
+		writeError(w, http.StatusNotFound, CodeNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeDatabaseError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, PreviewResponse{Preview: plan})
+}
+
+// handleTableVerify serves /api/v1/tables/{name}/verify: GET compares the
+// table in PostgreSQL and ClickHouse, POST also re-ingests the primary key
+// ranges that differ
+func (s *Server) handleTableVerify(w http.ResponseWriter, r *http.Request, pgConn *pgxpool.Pool, chURL, name string) {
+	if chURL == "" {
+		writeError(w, http.StatusBadRequest, CodeInvalidConnection, "ClickHouse URL not configured")
+		return
+	}
+
+	opts := etl.VerifyOptions{Repair: r.Method == http.MethodPost}
+	if value := r.URL.Query().Get("chunk_size"); value != "" {
+		chunkRows, err := strconv.Atoi(value)
+		if err != nil || chunkRows < 1 {
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("invalid chunk_size: %q", value))
+			return
+		}
+		opts.ChunkRows = chunkRows
+	}
+
+	// Repairs insert with the batch size and retry policy of the table's config
+	tc := config.TableConfig{Name: name}
+	for _, configured := range s.config.Tables {
+		if configured.Name == name {
+			tc = configured
+		}
+	}
+	tableConfig := s.config.ResolveTableConfig(tc)
+	retry := etl.RetryConfigFromPolicy(tableConfig.Retry)
+	opts.BatchSize = tableConfig.BatchSize
+	opts.Insert = &etl.InsertOptions{Retry: &retry}
+
+	report, err := etl.VerifyTable(r.Context(), pgConn, chURL, tableConfig, opts)
+	if errors.Is(err, etl.ErrTableNotFound) {
+		writeError(w, http.StatusNotFound, CodeNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeDatabaseError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, VerifyResponse{Verification: report})
+}
@@ -0,0 +1,32 @@
+package types
+
+// PollingConfig enables CDC polling of a table on a delta column
+type PollingConfig struct {
+	Enabled  bool   `yaml:"enabled" json:"enabled"`
+	DeltaCol string `yaml:"delta_column" json:"delta_column"`
+	Interval int    `yaml:"interval_seconds" json:"interval_seconds"`
+}
+
+// ErrorPolicy controls what happens to rows that ClickHouse rejects
+type ErrorPolicy struct {
+	Mode      string `yaml:"mode" json:"mode"`
+	DLQ       string `yaml:"dlq" json:"dlq,omitempty"`
+	DLQPath   string `yaml:"dlq_path" json:"dlq_path,omitempty"`
+	MaxErrors int    `yaml:"max_errors" json:"max_errors,omitempty"` // 0 = unlimited
+}
+
+// RetryPolicy controls how transient insert failures are retried.
+// Zero values fall back to the defaults (4 attempts, 250ms base, 2s max).
+type RetryPolicy struct {
+	MaxAttempts     int   `yaml:"max_attempts" json:"max_attempts,omitempty"`
+	BaseDelayMs     int   `yaml:"base_delay_ms" json:"base_delay_ms,omitempty"`
+	MaxDelayMs      int   `yaml:"max_delay_ms" json:"max_delay_ms,omitempty"`
+	ThrottleDelayMs int   `yaml:"throttle_delay_ms" json:"throttle_delay_ms,omitempty"` // min wait on "too many parts" and similar
+	Jitter          *bool `yaml:"jitter" json:"jitter,omitempty"`
+}
+
+// SQLHooks are statements run around a table's load, on each database
+type SQLHooks struct {
+	Postgres   []string `yaml:"postgres" json:"postgres,omitempty"`
+	ClickHouse []string `yaml:"clickhouse" json:"clickhouse,omitempty"`
+}
@@ -0,0 +1,37 @@
+package types
+
+// Error codes of ErrorResponse. Clients should branch on the code, the
+// message is for humans and may change.
+const (
+	CodeInvalidRequest    = "invalid_request"    // malformed JSON or query parameter
+	CodeValidationFailed  = "validation_failed"  // request does not match the OpenAPI schema, see details
+	CodeInvalidConnection = "invalid_connection" // unknown connection name, or raw URLs not allowed
+	CodeUnauthorized      = "unauthorized"
+	CodeForbidden         = "forbidden"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeConflict          = "conflict"       // the job is not in a state that allows the action
+	CodeDatabaseError     = "database_error" // PostgreSQL could not be reached or queried
+	CodeInternal          = "internal_error"
+)
+
+// ErrorResponse is the body of every non-2xx JSON response
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+type APIError struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// FieldError locates a validation failure in the request
+type FieldError struct {
+	Field   string `json:"field"` // JSON pointer into the body, or the query parameter name
+	Message string `json:"message"`
+}
@@ -0,0 +1,124 @@
+package types
+
+import "time"
+
+// Views of GET /api/v1/jobs
+const (
+	JobsViewSummary  = "summary"  // progress reduced to the latest update per table
+	JobsViewDetailed = "detailed" // full progress history
+)
+
+type IngestionJob struct {
+	ID            string               `json:"id"`
+	Status        string               `json:"status"` // pending, running, paused, cancelling, cancelled, completed, failed
+	Tables        []string             `json:"tables"`
+	TableConfigs  []TableConfigRequest `json:"table_configs,omitempty"` // Store table configurations for UI display
+	Results       []TableResult        `json:"results"`
+	Progress      []ProgressUpdate     `json:"progress"`
+	StartTime     time.Time            `json:"start_time"`
+	EndTime       *time.Time           `json:"end_time,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	PollingTables []string             `json:"polling_tables,omitempty"` // Tables with an active CDC poller
+	Queued        []string             `json:"queued,omitempty"`         // Tables not started yet, waiting for a slot or their dependencies
+	RetryOf       string               `json:"retry_of,omitempty"`       // Job this job retries
+	Retries       []string             `json:"retries,omitempty"`        // Jobs that retried this job
+	TraceID       string               `json:"trace_id,omitempty"`       // Trace of the job span, linked from each table's trace
+	ScheduleID    string               `json:"schedule_id,omitempty"`    // Schedule that started this job
+	Checkpoints   map[string]string    `json:"checkpoints,omitempty"`    // Last delta value synced by each table's poller
+}
+
+type ProgressUpdate struct {
+	Seq            int64     `json:"seq"` // Increases with every update across all jobs
+	JobID          string    `json:"job_id"`
+	Table          string    `json:"table"`
+	Event          string    `json:"event"` // started, extracting, inserting, completed, error
+	Message        string    `json:"message"`
+	RowCount       int64     `json:"row_count,omitempty"`       // Total rows processed for this table
+	CurrentRows    int64     `json:"current_rows,omitempty"`    // Rows committed to ClickHouse so far
+	ExtractedRows  int64     `json:"extracted_rows,omitempty"`  // Rows read from PostgreSQL so far
+	TotalRows      int64     `json:"total_rows,omitempty"`      // Expected total, from COUNT(*), the planner estimate or the limit
+	TotalEstimated bool      `json:"total_estimated,omitempty"` // TotalRows is an estimate
+	Percentage     float64   `json:"percentage,omitempty"`      // Completion percentage
+	RowsPerSec     float64   `json:"rows_per_sec,omitempty"`    // Rows inserted per second
+	BytesPerSec    float64   `json:"bytes_per_sec,omitempty"`   // Approximate uncompressed bytes inserted per second
+	ETASeconds     float64   `json:"eta_seconds,omitempty"`     // Estimated time left, absent when unknown
+	Phase          string    `json:"phase,omitempty"`           // queued, extracting, inserting, completed
+	QueuePosition  int       `json:"queue_position,omitempty"`  // Position of a queued table, 1 = first in line
+	DeadLettered   int64     `json:"dead_lettered,omitempty"`   // Rows written to the dead-letter queue
+	Duration       string    `json:"duration,omitempty"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+type TableConfigRequest struct {
+	Name        string         `json:"name"`
+	Limit       *int           `json:"limit,omitempty"`
+	BatchSize   *int           `json:"batch_size,omitempty"`
+	ExactCount  *bool          `json:"exact_count,omitempty"` // Progress totals from COUNT(*) instead of the planner estimate
+	Priority    *int           `json:"priority,omitempty"`    // Higher starts first, default 0
+	LoadMode    string         `json:"load_mode,omitempty"`   // append, truncate or replace
+	DependsOn   []string       `json:"depends_on,omitempty"`  // Tables of the request that must load first
+	PreSQL      *SQLHooks      `json:"pre_sql,omitempty"`     // Needs server.allow_sql_hooks
+	PostSQL     *SQLHooks      `json:"post_sql,omitempty"`    // Needs server.allow_sql_hooks
+	Polling     *PollingConfig `json:"polling,omitempty"`
+	ErrorPolicy *ErrorPolicy   `json:"error_policy,omitempty"`
+	Retry       *RetryPolicy   `json:"retry,omitempty"`
+}
+
+type IngestRequest struct {
+	Tables       []TableConfigRequest `json:"tables"`
+	PgConnection string               `json:"pg_connection,omitempty"` // Name of a server-side connection profile
+	ChConnection string               `json:"ch_connection,omitempty"`
+	PgURL        string               `json:"pg_url,omitempty"` // Raw connection strings, when the server allows them
+	ChURL        string               `json:"ch_url,omitempty"`
+	Limit        *int                 `json:"limit,omitempty"`        // Default limit for tables without specific config
+	BatchSize    *int                 `json:"batch_size,omitempty"`   // Default batch size
+	ExactCount   *bool                `json:"exact_count,omitempty"`  // Default for tables without exact_count
+	LoadMode     string               `json:"load_mode,omitempty"`    // Default for tables without load_mode, append if empty
+	Polling      *PollingConfig       `json:"polling,omitempty"`      // Default polling config
+	ErrorPolicy  *ErrorPolicy         `json:"error_policy,omitempty"` // Default error policy
+	Retry        *RetryPolicy         `json:"retry,omitempty"`        // Default retry policy
+
+	// Tables of the job loading at once, default the server's max_parallel_tables
+	MaxParallelTables *int `json:"max_parallel_tables,omitempty"`
+}
+
+// IngestResponse is returned when a job has been accepted
+type IngestResponse struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"` // always "accepted"
+}
+
+type JobStatusResponse struct {
+	Job *IngestionJob `json:"job"`
+}
+
+type JobsResponse struct {
+	Jobs       []*IngestionJob `json:"jobs"`
+	NextCursor string          `json:"next_cursor,omitempty"` // Pass as ?cursor= for the next page, empty on the last page
+}
+
+type JobActionResponse struct {
+	JobID  string `json:"job_id"`
+	Table  string `json:"table,omitempty"`
+	Status string `json:"status"`
+}
+
+// RetryJobRequest is the optional body of POST /api/v1/jobs/{id}/retry
+type RetryJobRequest struct {
+	Tables    []string             `json:"tables,omitempty"`    // Failed tables to retry, default all failed tables
+	Overrides []TableConfigRequest `json:"overrides,omitempty"` // Settings replacing those of the table with the same name
+}
+
+type RetryJobResponse struct {
+	JobID   string   `json:"job_id"`
+	Status  string   `json:"status"`
+	RetryOf string   `json:"retry_of"`
+	Tables  []string `json:"tables"`
+}
+
+// PollEventsResponse is the response of the long-poll endpoints
+type PollEventsResponse struct {
+	Updates   []ProgressUpdate `json:"updates"`
+	NextSince int64            `json:"next_since"`     // pass as since on the next poll
+	Done      bool             `json:"done,omitempty"` // the job has finished and no more updates will follow
+}
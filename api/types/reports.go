@@ -0,0 +1,114 @@
+package types
+
+import (
+	"strconv"
+	"time"
+)
+
+// TableResult represents the result of ingesting a single table
+type TableResult struct {
+	TableName     string        `json:"name"`
+	Success       bool          `json:"success"`
+	Error         string        `json:"error,omitempty"`
+	RowCount      int64         `json:"rows"`                     // rows committed to ClickHouse
+	ExtractedRows int64         `json:"extracted_rows,omitempty"` // rows read from PostgreSQL
+	DeadLettered  int64         `json:"dead_lettered,omitempty"`
+	Duration      time.Duration `json:"duration"`
+}
+
+// ColumnPlan is how one PostgreSQL column maps to ClickHouse
+type ColumnPlan struct {
+	Name           string `json:"name"`
+	PostgresType   string `json:"postgres_type"`
+	ClickHouseType string `json:"clickhouse_type,omitempty"` // empty when the type is not supported
+	Warning        string `json:"warning,omitempty"`         // the conversion may lose data or fail
+}
+
+// ColumnDiff is a difference between the planned and an existing ClickHouse
+// table. Change is missing, extra or mismatch.
+type ColumnDiff struct {
+	Name     string `json:"name"`
+	Change   string `json:"change"`
+	Planned  string `json:"planned,omitempty"`
+	Existing string `json:"existing,omitempty"`
+}
+
+// TablePlan is what ingesting a table would do, worked out without changing
+// anything. EstimatedRows comes from pg_class.reltuples and is -1 when the
+// table has never been vacuumed or analyzed.
+type TablePlan struct {
+	Table          string       `json:"table"`
+	DDL            string       `json:"ddl,omitempty"`
+	Engine         string       `json:"engine"`
+	PrimaryKey     []string     `json:"primary_key,omitempty"`
+	Columns        []ColumnPlan `json:"columns"`
+	EstimatedRows  int64        `json:"estimated_rows"`
+	Exists         bool         `json:"exists"` // the ClickHouse table already exists, the DDL is a no-op
+	ExistingEngine string       `json:"existing_engine,omitempty"`
+	Diff           []ColumnDiff `json:"diff,omitempty"`
+	Warnings       []string     `json:"warnings,omitempty"`
+}
+
+// AggregateCheck compares one aggregate of one column. Values are compared the
+// way chug stores them: NULLs count as the ClickHouse default of the column.
+type AggregateCheck struct {
+	Column     string `json:"column"`
+	Aggregate  string `json:"aggregate"` // null_or_default, min, max, sum
+	Postgres   string `json:"postgres"`
+	ClickHouse string `json:"clickhouse"`
+	Match      bool   `json:"match"`
+}
+
+// RangeCheck is a primary key range, (From, To], whose checksums differ. A
+// nil bound is the start or end of the table.
+type RangeCheck struct {
+	From           *int64 `json:"from,omitempty"`
+	To             *int64 `json:"to,omitempty"`
+	PostgresRows   int64  `json:"postgres_rows"`
+	ClickHouseRows int64  `json:"clickhouse_rows"`
+	Repaired       bool   `json:"repaired,omitempty"`
+	RepairError    string `json:"repair_error,omitempty"`
+}
+
+func (r RangeCheck) String() string {
+	from, to := "start", "end"
+	if r.From != nil {
+		from = strconv.FormatInt(*r.From, 10)
+	}
+	if r.To != nil {
+		to = strconv.FormatInt(*r.To, 10)
+	}
+	return "(" + from + ", " + to + "]"
+}
+
+// VerifyReport is the result of comparing a table in PostgreSQL and ClickHouse
+type VerifyReport struct {
+	Table          string           `json:"table"`
+	Final          bool             `json:"final"` // ClickHouse was read with FINAL (ReplacingMergeTree)
+	PostgresRows   int64            `json:"postgres_rows"`
+	ClickHouseRows int64            `json:"clickhouse_rows"`
+	Aggregates     []AggregateCheck `json:"aggregates,omitempty"`
+	PrimaryKey     string           `json:"primary_key,omitempty"` // checksums need a single integer primary key
+	Ranges         int              `json:"ranges"`                // checksum ranges compared
+	Mismatches     []RangeCheck     `json:"mismatches,omitempty"`
+	Match          bool             `json:"match"` // counts, aggregates and checksums agree, after any repair
+	Warnings       []string         `json:"warnings,omitempty"`
+	Duration       string           `json:"duration"`
+}
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // target healthy, calls flow
+	BreakerOpen     BreakerState = "open"      // target down, callers wait
+	BreakerHalfOpen BreakerState = "half_open" // probing the target
+)
+
+// BreakerStatus is a point-in-time view of a database's circuit breaker
+type BreakerStatus struct {
+	Name      string       `json:"name"`
+	State     BreakerState `json:"state"`
+	Failures  int          `json:"failures"`
+	LastError string       `json:"last_error,omitempty"`
+	Since     time.Time    `json:"since"`
+}
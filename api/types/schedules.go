@@ -0,0 +1,44 @@
+package types
+
+import "time"
+
+// Schedule sources
+const (
+	ScheduleFromConfig = "config" // schedule or tables[].schedule in the serve config
+	ScheduleFromAPI    = "api"    // created with POST /api/v1/schedules, kept in the job store
+)
+
+// Schedule re-runs an ingest request on a cron schedule. A run that is due
+// while the previous run's job is still active is skipped.
+type Schedule struct {
+	ID        string        `json:"id"`
+	Name      string        `json:"name,omitempty"`
+	Cron      string        `json:"schedule"`
+	Source    string        `json:"source"` // config | api
+	Tables    []string      `json:"tables"`
+	NextRun   *time.Time    `json:"next_run,omitempty"`
+	ActiveJob string        `json:"active_job,omitempty"` // job of the run in progress
+	Runs      []ScheduleRun `json:"runs"`                 // most recent last
+}
+
+// ScheduleRun is one due time of a schedule
+type ScheduleRun struct {
+	Time   time.Time `json:"time"`
+	Status string    `json:"status"` // started | skipped
+	JobID  string    `json:"job_id"` // job started, or the job still active when the run was skipped
+}
+
+// CreateScheduleRequest is the body of POST /api/v1/schedules
+type CreateScheduleRequest struct {
+	Name     string        `json:"name,omitempty"`
+	Schedule string        `json:"schedule"` // cron expression, e.g. "0 */6 * * *"
+	Request  IngestRequest `json:"request"`
+}
+
+type SchedulesResponse struct {
+	Schedules []*Schedule `json:"schedules"`
+}
+
+type ScheduleResponse struct {
+	Schedule *Schedule `json:"schedule"`
+}
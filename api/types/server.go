@@ -0,0 +1,49 @@
+// Package types holds the requests and responses of the chug HTTP API, as
+// described by api/openapi.yaml. It depends only on the standard library so
+// that clients can use it without pulling in the server.
+package types
+
+import "time"
+
+type HealthResponse struct {
+	Status    string          `json:"status"` // healthy, degraded
+	Timestamp time.Time       `json:"timestamp"`
+	Version   string          `json:"version"`
+	Databases []BreakerStatus `json:"databases"`
+}
+
+// ConnectionInfo describes a connection profile without its URL
+type ConnectionInfo struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`    // postgres | clickhouse
+	Default bool   `json:"default"` // used when a request names no connection
+}
+
+type ConnectionsResponse struct {
+	Connections    []ConnectionInfo `json:"connections"`
+	RawURLsAllowed bool             `json:"raw_urls_allowed"` // whether requests may pass pg_url/ch_url
+}
+
+type TablesResponse struct {
+	Tables []string `json:"tables"`
+}
+
+// ColumnInfo is a PostgreSQL column as reported by information_schema
+type ColumnInfo struct {
+	Name     string `json:"name"`
+	DataType string `json:"data_type"`
+}
+
+type ColumnsResponse struct {
+	Columns []ColumnInfo `json:"columns"`
+}
+
+// PreviewResponse is returned by GET /api/v1/tables/{name}/preview
+type PreviewResponse struct {
+	Preview *TablePlan `json:"preview"`
+}
+
+// VerifyResponse is returned by GET and POST /api/v1/tables/{name}/verify
+type VerifyResponse struct {
+	Verification *VerifyReport `json:"verification"`
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second    // time allowed to write a message
+	wsPongWait   = 60 * time.Second    // time allowed between pongs
+	wsPingPeriod = wsPongWait * 9 / 10 // must be shorter than wsPongWait
+
+	// wsCloseLagging tells a client it was dropped for reading too slowly and
+	// should reconnect with since set to the last seq it received
+	wsCloseLagging = 4000
+)
+
+// parseSince reads the ?since= cursor. Without one, job subscriptions replay
+// the whole job history and subscriptions to every job only get new updates.
+func parseSince(r *http.Request, jobID string) (int64, error) {
+	value := r.URL.Query().Get("since")
+	if value == "" {
+		if jobID != "" {
+			return 0, nil
+		}
+		return -1, nil
+	}
+	since, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || since < 0 {
+		return 0, fmt.Errorf("invalid since: %q", value)
+	}
+	return since, nil
+}
+
+// handleWebSocket serves /ws?job_id=&since=. Updates after since are replayed
+// first, then new updates are streamed as they happen.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	jobID := r.URL.Query().Get("job_id")
+	if jobID != "" {
+		if _, ok := s.jobs.Load(jobID); !ok {
+			writeError(w, http.StatusNotFound, CodeNotFound, "Job not found")
+			return
+		}
+	}
+	since, err := parseSince(r, jobID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error("WebSocket upgrade failed", zap.Error(err))
+		return
+	}
+
+	clientID := fmt.Sprintf("client_%d", time.Now().UnixNano())
+	sub, missed := s.subscribe(jobID, since)
+
+	s.logger.Info("WebSocket client connected",
+		zap.String("client_id", clientID),
+		zap.String("job_id", jobID),
+		zap.Int("replayed", len(missed)))
+
+	go s.readWebSocket(conn, sub)
+	go s.writeWebSocket(conn, sub, missed, clientID)
+}
+
+// readWebSocket handles pongs and notices when the client goes away
+func (s *Server) readWebSocket(conn *websocket.Conn, sub *subscription) {
+	defer s.events.unsubscribe(sub)
+
+	conn.SetReadLimit(4096)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// writeWebSocket is the only writer of conn. It replays missed updates, then
+// drains the subscription queue and pings the client to keep it alive.
+func (s *Server) writeWebSocket(conn *websocket.Conn, sub *subscription, missed []ProgressUpdate, clientID string) {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		s.events.unsubscribe(sub)
+		conn.Close()
+		s.logger.Info("WebSocket client disconnected", zap.String("client_id", clientID))
+	}()
+
+	var lastSeq int64
+	write := func(update ProgressUpdate) bool {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(update); err != nil {
+			s.logger.Warn("Failed to send update to client",
+				zap.String("client_id", clientID),
+				zap.Error(err))
+			return false
+		}
+		lastSeq = update.Seq
+		return true
+	}
+
+	for _, update := range missed {
+		if !write(update) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case update, ok := <-sub.queue:
+			if !ok {
+				if s.events.isLagged(sub) {
+					s.logger.Warn("Dropping slow WebSocket client", zap.String("client_id", clientID))
+					msg := websocket.FormatCloseMessage(wsCloseLagging, fmt.Sprintf("too slow, reconnect with since=%d", lastSeq))
+					conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+				} else if s.closing.Load() {
+					msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+					conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+				}
+				return
+			}
+			if update.Seq <= lastSeq {
+				// Already sent during replay
+				continue
+			}
+			if !write(update) {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -121,7 +121,7 @@ func (b *Benchmarker) BenchmarkExtraction(tableName string, limit int) *Benchmar
 
 	// Warmup
 	for i := 0; i < b.Warmup; i++ {
-		stream, _ := etl.ExtractTableDataStreaming(b.Ctx, b.PgPool, tableName, &limit)
+		stream, _ := etl.ExtractTableDataStreaming(b.Ctx, b.PgPool, tableName, &limit, nil)
 		for range stream.RowChan {
 		}
 	}
@@ -130,7 +130,7 @@ func (b *Benchmarker) BenchmarkExtraction(tableName string, limit int) *Benchmar
 	for i := 0; i < b.Iterations; i++ {
 		start := time.Now()
 
-		stream, err := etl.ExtractTableDataStreaming(b.Ctx, b.PgPool, tableName, &limit)
+		stream, err := etl.ExtractTableDataStreaming(b.Ctx, b.PgPool, tableName, &limit, nil)
 		if err != nil {
 			continue
 		}
@@ -172,7 +172,7 @@ func (b *Benchmarker) BenchmarkInsertion(tableName string, rowCount, batchSize i
 			rowChan <- []any{j, "test", 123.45, "2024-01-01 00:00:00"}
 		}
 		close(rowChan)
-		etl.InsertRowsStreaming(b.Ctx, b.ChURL, tableName, columns, rowChan, batchSize)
+		etl.InsertRowsStreaming(b.Ctx, b.ChURL, tableName, columns, rowChan, batchSize, nil)
 	}
 
 	// Actual benchmark
@@ -186,7 +186,7 @@ func (b *Benchmarker) BenchmarkInsertion(tableName string, rowCount, batchSize i
 		close(rowChan)
 
 		start := time.Now()
-		err := etl.InsertRowsStreaming(b.Ctx, b.ChURL, tableName, columns, rowChan, batchSize)
+		_, err := etl.InsertRowsStreaming(b.Ctx, b.ChURL, tableName, columns, rowChan, batchSize, nil)
 		duration := time.Since(start)
 
 		if err != nil {
@@ -0,0 +1,379 @@
+// Package client is a Go client for the chug HTTP API. Requests and
+// responses use the types of the api/types package, which are described by
+// the OpenAPI document served at /api/v1/opentypes.yaml.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pixperk/chug/api/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Client talks to a chug server started with `chug serve`
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+type Option func(*Client)
+
+// WithToken authenticates every request with a bearer token
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient replaces http.DefaultClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// New returns a client for the server at baseURL, e.g. http://localhost:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error is a non-2xx response. Code is one of the types.Code* constants, or
+// empty when the server did not send a JSON error.
+type Error struct {
+	StatusCode int
+	types.APIError
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("chug: HTTP %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("chug: HTTP %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (c *Client) Health(ctx context.Context) (*types.HealthResponse, error) {
+	var resp types.HealthResponse
+	if err := c.do(ctx, http.MethodGet, "/health", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Connections(ctx context.Context) (*types.ConnectionsResponse, error) {
+	var resp types.ConnectionsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/connections", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Tables lists the PostgreSQL tables of a connection profile, the server's
+// default connection when connection is empty
+func (c *Client) Tables(ctx context.Context, connection string) ([]string, error) {
+	query := url.Values{}
+	if connection != "" {
+		query.Set("connection", connection)
+	}
+	var resp types.TablesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tables", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tables, nil
+}
+
+func (c *Client) Columns(ctx context.Context, table, connection string) ([]types.ColumnInfo, error) {
+	query := url.Values{"table": {table}}
+	if connection != "" {
+		query.Set("connection", connection)
+	}
+	var resp types.ColumnsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tables/columns", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Columns, nil
+}
+
+// PreviewQuery selects the connections of a table preview and whether it is
+// planned for CDC. Empty connections use the server's defaults.
+type PreviewQuery struct {
+	Connection   string // postgres profile
+	ChConnection string // clickhouse profile
+	DeltaColumn  string // plan the CDC layout polled on this column
+}
+
+// PreviewTable returns the DDL chug would run for table, its type mapping and
+// its differences with the existing ClickHouse table, without creating anything
+func (c *Client) PreviewTable(ctx context.Context, table string, q PreviewQuery) (*types.TablePlan, error) {
+	query := url.Values{}
+	if q.Connection != "" {
+		query.Set("connection", q.Connection)
+	}
+	if q.ChConnection != "" {
+		query.Set("ch_connection", q.ChConnection)
+	}
+	if q.DeltaColumn != "" {
+		query.Set("delta_column", q.DeltaColumn)
+	}
+	var resp types.PreviewResponse
+	path := "/api/v1/tables/" + url.PathEscape(table) + "/preview"
+	if err := c.do(ctx, http.MethodGet, path, query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Preview, nil
+}
+
+// VerifyQuery selects the connections and checksum ranges of a table
+// verification. Empty connections use the server's defaults.
+type VerifyQuery struct {
+	Connection   string // postgres profile
+	ChConnection string // clickhouse profile
+	ChunkSize    int    // PostgreSQL rows per checksum range, 0 = server default
+	Repair       bool   // re-ingest the ranges that differ, needs the operator role
+}
+
+// VerifyTable compares table in PostgreSQL and ClickHouse and, with q.Repair,
+// re-ingests the primary key ranges that differ
+func (c *Client) VerifyTable(ctx context.Context, table string, q VerifyQuery) (*types.VerifyReport, error) {
+	query := url.Values{}
+	if q.Connection != "" {
+		query.Set("connection", q.Connection)
+	}
+	if q.ChConnection != "" {
+		query.Set("ch_connection", q.ChConnection)
+	}
+	if q.ChunkSize > 0 {
+		query.Set("chunk_size", strconv.Itoa(q.ChunkSize))
+	}
+	method := http.MethodGet
+	if q.Repair {
+		method = http.MethodPost
+	}
+	var resp types.VerifyResponse
+	path := "/api/v1/tables/" + url.PathEscape(table) + "/verify"
+	if err := c.do(ctx, method, path, query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Verification, nil
+}
+
+// Ingest starts a job and returns its ID without waiting for it
+func (c *Client) Ingest(ctx context.Context, req types.IngestRequest) (string, error) {
+	var resp types.IngestResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/ingest", nil, req, &resp); err != nil {
+		return "", err
+	}
+	return resp.JobID, nil
+}
+
+// JobsQuery filters and pages GET /api/v1/jobs. The zero value lists the
+// newest jobs in the summary view.
+type JobsQuery struct {
+	Status   []string  // any of these statuses
+	Table    string    // jobs that include this table
+	Since    time.Time // jobs started at or after this time
+	Limit    int       // page size, server default 50, at most 500
+	Cursor   string    // NextCursor of the previous page
+	Detailed bool      // full progress history instead of the latest update per table
+}
+
+// Jobs lists one page of jobs, newest first. Pass resp.NextCursor as
+// q.Cursor for the next page; it is empty on the last one.
+func (c *Client) Jobs(ctx context.Context, q JobsQuery) (*types.JobsResponse, error) {
+	query := url.Values{}
+	if len(q.Status) > 0 {
+		query.Set("status", strings.Join(q.Status, ","))
+	}
+	if q.Table != "" {
+		query.Set("table", q.Table)
+	}
+	if !q.Since.IsZero() {
+		query.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Cursor != "" {
+		query.Set("cursor", q.Cursor)
+	}
+	if q.Detailed {
+		query.Set("view", types.JobsViewDetailed)
+	}
+	var resp types.JobsResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/jobs", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Job(ctx context.Context, id string) (*types.IngestionJob, error) {
+	var resp types.JobStatusResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/jobs/"+url.PathEscape(id), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Job, nil
+}
+
+// CancelJob cancels a job, or only one of its tables when table is set
+func (c *Client) CancelJob(ctx context.Context, id, table string) (*types.JobActionResponse, error) {
+	return c.jobAction(ctx, id, "cancel", table)
+}
+
+func (c *Client) PauseJob(ctx context.Context, id, table string) (*types.JobActionResponse, error) {
+	return c.jobAction(ctx, id, "pause", table)
+}
+
+func (c *Client) ResumeJob(ctx context.Context, id, table string) (*types.JobActionResponse, error) {
+	return c.jobAction(ctx, id, "resume", table)
+}
+
+func (c *Client) jobAction(ctx context.Context, id, action, table string) (*types.JobActionResponse, error) {
+	query := url.Values{}
+	if table != "" {
+		query.Set("table", table)
+	}
+	var resp types.JobActionResponse
+	path := "/api/v1/jobs/" + url.PathEscape(id) + "/" + action
+	if err := c.do(ctx, http.MethodPost, path, query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RetryJob starts a new job re-running the failed tables of job id
+func (c *Client) RetryJob(ctx context.Context, id string, req types.RetryJobRequest) (*types.RetryJobResponse, error) {
+	var resp types.RetryJobResponse
+	path := "/api/v1/jobs/" + url.PathEscape(id) + "/retry"
+	if err := c.do(ctx, http.MethodPost, path, nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (c *Client) Schedules(ctx context.Context) ([]*types.Schedule, error) {
+	var resp types.SchedulesResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/schedules", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Schedules, nil
+}
+
+func (c *Client) Schedule(ctx context.Context, id string) (*types.Schedule, error) {
+	var resp types.ScheduleResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/schedules/"+url.PathEscape(id), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Schedule, nil
+}
+
+// CreateSchedule re-runs req.Request on the cron schedule req.Schedule
+func (c *Client) CreateSchedule(ctx context.Context, req types.CreateScheduleRequest) (*types.Schedule, error) {
+	var resp types.ScheduleResponse
+	if err := c.do(ctx, http.MethodPost, "/api/v1/schedules", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Schedule, nil
+}
+
+// DeleteSchedule stops a schedule created through the API
+func (c *Client) DeleteSchedule(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/schedules/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// PollEvents long-polls the progress updates after since, of one job or of
+// every job when jobID is empty. The server waits up to timeout, capped at
+// one minute, for the next update; pass resp.NextSince as since on the next call.
+func (c *Client) PollEvents(ctx context.Context, jobID string, since int64, timeout time.Duration) (*types.PollEventsResponse, error) {
+	path := "/api/v1/events/poll"
+	if jobID != "" {
+		path = "/api/v1/jobs/" + url.PathEscape(jobID) + "/events/poll"
+	}
+	query := url.Values{
+		"since":   {strconv.FormatInt(since, 10)},
+		"timeout": {strconv.Itoa(int(timeout / time.Second))},
+	}
+	var resp types.PollEventsResponse
+	if err := c.do(ctx, http.MethodGet, path, query, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// do sends a request with body encoded as JSON, if not nil, and decodes the
+// response into out
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	// Continue the caller's trace in the server's job spans
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s %s response: %w", method, path, err)
+	}
+	return nil
+}
+
+// decodeError reads the types.ErrorResponse of a failed request, falling back
+// to the raw body for errors not sent by chug, e.g. from a proxy
+func decodeError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var errResp types.ErrorResponse
+	if err := json.Unmarshal(data, &errResp); err == nil && errResp.Error.Code != "" {
+		return &Error{StatusCode: resp.StatusCode, APIError: errResp.Error}
+	}
+
+	message := strings.TrimSpace(string(data))
+	if message == "" {
+		message = http.StatusText(resp.StatusCode)
+	}
+	return &Error{StatusCode: resp.StatusCode, APIError: types.APIError{Message: message}}
+}
@@ -28,6 +28,7 @@ var connectCmd = &cobra.Command{
 			log.Error("Failed to load config", zap.Error(err))
 			return
 		}
+		db.Pools.RegisterProfiles(cfg.Connections)
 
 		// Use config values
 		pgURL := cfg.PostgresURL
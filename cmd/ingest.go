@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -12,6 +15,7 @@ import (
 	"github.com/pixperk/chug/internal/db"
 	"github.com/pixperk/chug/internal/etl"
 	"github.com/pixperk/chug/internal/logx"
+	"github.com/pixperk/chug/internal/metrics"
 	"github.com/pixperk/chug/internal/ui"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -24,11 +28,20 @@ var (
 	ingestTables     string
 	ingestLimit      int
 	ingestBatch      int
+	ingestExactCount bool
+	ingestLoadMode   string
 	ingestConfigPath string
+	// Concurrency limits
+	ingestMaxParallel   int
+	ingestInsertWorkers int
 	// Polling options
 	ingestPoll      bool
 	ingestPollDelta string
 	ingestPollInt   int
+	// Observability
+	ingestMetricsAddr   string
+	ingestTraceExporter string
+	ingestTraceEndpoint string
 )
 
 // TableResult is now defined in internal/etl package
@@ -41,31 +54,63 @@ var ingestCmd = &cobra.Command{
 		ui.PrintTitle("Data Ingestion")
 		ui.PrintSubtitle("Transferring data from PostgreSQL to ClickHouse")
 
-		ctx := context.Background()
+		// Ctrl+C or SIGTERM cancels ctx: batches being inserted are flushed,
+		// queued ones abandoned, and pollers commit their last cycle
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 		log := logx.StyledLog
 		log.Info("Starting ingestion process...")
 
 		cfg := loadConfig(cmd)
 
+		applyTracingFlags(cfg, ingestTraceExporter, ingestTraceEndpoint)
+		flushTraces := setupTracing(ctx, cfg.Tracing)
+		defer flushTraces()
+		defer db.CloseAllPools()
+
+		exit := func(code int) {
+			db.CloseAllPools()
+			flushTraces()
+			os.Exit(code)
+		}
+		var pollers sync.WaitGroup
+
 		if cfg.PostgresURL == "" || cfg.ClickHouseURL == "" {
 			log.Error("Missing required config values",
-				zap.String("pg_url", cfg.PostgresURL),
-				zap.String("ch_url", cfg.ClickHouseURL))
+				zap.String("pg_url", db.RedactDSN(cfg.PostgresURL)),
+				zap.String("ch_url", db.RedactDSN(cfg.ClickHouseURL)))
 			return
 		}
 
+		db.Pools.RegisterProfiles(cfg.Connections)
+
 		pgConn, err := db.GetPostgresPool(cfg.PostgresURL)
 		if err != nil {
 			log.Error("Failed to connect to PostgreSQL", zap.Error(err))
 			return
 		}
 
+		db.OnBreakerStateChange(reportBreakerState)
+
+		if ingestMetricsAddr != "" {
+			go func() {
+				if err := metrics.Serve(ingestMetricsAddr); err != nil {
+					log.Error("Metrics server failed", zap.Error(err))
+				}
+			}()
+			log.Info("Serving Prometheus metrics on http://" + ingestMetricsAddr + "/metrics")
+		}
+
 		tableConfigs := cfg.GetEffectiveTableConfigs()
 
 		if len(tableConfigs) == 0 {
 			log.Error("No tables specified. Use --table, --tables flag, or configure tables in YAML")
 			return
 		}
+		if err := config.ValidateDependencies(tableConfigs); err != nil {
+			log.Error("Invalid table dependencies", zap.Error(err))
+			return
+		}
 
 		if len(tableConfigs) == 1 {
 			ui.PrintSubtitle("Single Table Ingestion")
@@ -77,25 +122,33 @@ var ingestCmd = &cobra.Command{
 					"ClickHouse: Connected\n"+
 					"Target Table: %s\n"+
 					"Batch Size: %s rows\n"+
-					"Limit: %s rows",
+					"Limit: %s rows\n"+
+					"Load Mode: %s",
 					resolved.Name,
 					ui.HighlightStyle.Render(UI_itoa(resolved.BatchSize)),
-					ui.HighlightStyle.Render(UI_itoa(resolved.Limit))))
+					ui.HighlightStyle.Render(UI_itoa(resolved.Limit)),
+					resolved.LoadMode))
 
-			result := ingestSingleTable(ctx, cfg, resolved, pgConn)
+			result := ingestSingleTable(ctx, cfg, resolved, pgConn, &pollers)
 
 			if result.Success {
 				log.Success("Ingestion completed successfully",
 					zap.String("table", result.TableName),
 					zap.Int64("rows", result.RowCount))
+				if result.DeadLettered > 0 {
+					log.Warn(fmt.Sprintf("%d rows written to dead-letter queue", result.DeadLettered))
+				}
 
 				if resolved.Polling.Enabled {
 					ui.PrintSubtitle("Polling Mode Active")
-					select {}
+					waitForPollers(ctx, stop, &pollers)
 				}
 			} else {
+				if ctx.Err() != nil {
+					log.Warn("Ingestion interrupted, in-flight batches were flushed")
+				}
 				log.Error("Ingestion failed", zap.String("error", result.Error))
-				os.Exit(1)
+				exit(1)
 			}
 		} else {
 			ui.PrintSubtitle(fmt.Sprintf("Multi-Table Ingestion (%d tables)", len(tableConfigs)))
@@ -109,12 +162,21 @@ var ingestCmd = &cobra.Command{
 				fmt.Sprintf("PostgreSQL: Connected\n"+
 					"ClickHouse: Connected\n"+
 					"Tables: %s\n"+
-					"Count: %d",
+					"Count: %d\n"+
+					"Parallel Tables: %d\n"+
+					"Insert Workers: %d",
 					strings.Join(tableNames, ", "),
-					len(tableConfigs)))
-
-			results := ingestMultipleTables(ctx, cfg, pgConn)
-			printResultsSummary(results)
+					len(tableConfigs),
+					cfg.ParallelTables(),
+					cfg.InsertWorkerLimit()))
+
+			results := ingestMultipleTables(ctx, cfg, pgConn, &pollers)
+			if !printResultsSummary(results) {
+				if ctx.Err() != nil {
+					log.Warn("Ingestion interrupted, in-flight batches were flushed")
+				}
+				exit(1)
+			}
 
 			hasPolling := false
 			for _, tc := range tableConfigs {
@@ -128,7 +190,7 @@ var ingestCmd = &cobra.Command{
 			if hasPolling {
 				ui.PrintSubtitle("Polling Mode Active for Some Tables")
 				log.Highlight("Running indefinitely - press Ctrl+C to stop")
-				select {}
+				waitForPollers(ctx, stop, &pollers)
 			}
 		}
 	},
@@ -142,11 +204,15 @@ func loadConfig(cmd *cobra.Command) *config.Config {
 	if err != nil {
 		log.Warn("Could not load config from file, falling back to flags", zap.Error(err))
 		cfg = &config.Config{
-			PostgresURL:   ingestPgURL,
-			ClickHouseURL: ingestChURL,
-			Table:         ingestTable,
-			Limit:         &ingestLimit,
-			BatchSize:     &ingestBatch,
+			PostgresURL:       ingestPgURL,
+			ClickHouseURL:     ingestChURL,
+			Table:             ingestTable,
+			Limit:             &ingestLimit,
+			BatchSize:         &ingestBatch,
+			ExactCount:        &ingestExactCount,
+			LoadMode:          ingestLoadMode,
+			MaxParallelTables: ingestMaxParallel,
+			InsertWorkers:     ingestInsertWorkers,
 			Polling: config.PollingConfig{
 				Enabled:  ingestPoll,
 				DeltaCol: ingestPollDelta,
@@ -170,6 +236,18 @@ func loadConfig(cmd *cobra.Command) *config.Config {
 		if cmd.Flags().Changed("batch-size") {
 			cfg.BatchSize = &ingestBatch
 		}
+		if cmd.Flags().Changed("exact-count") {
+			cfg.ExactCount = &ingestExactCount
+		}
+		if ingestLoadMode != "" {
+			cfg.LoadMode = ingestLoadMode
+		}
+		if ingestMaxParallel > 0 {
+			cfg.MaxParallelTables = ingestMaxParallel
+		}
+		if ingestInsertWorkers > 0 {
+			cfg.InsertWorkers = ingestInsertWorkers
+		}
 
 		if ingestPoll {
 			cfg.Polling.Enabled = true
@@ -198,16 +276,33 @@ func loadConfig(cmd *cobra.Command) *config.Config {
 		cfg.Tables = append(cfg.Tables, config.TableConfig{Name: ingestTable})
 	}
 
+	if hasSchedule(cfg) {
+		log.Warn("Schedules are only run by chug serve, ingesting once")
+	}
+
 	return cfg
 }
 
+// hasSchedule reports whether the config or any of its tables has a cron schedule
+func hasSchedule(cfg *config.Config) bool {
+	if cfg.Schedule != "" {
+		return true
+	}
+	for _, tc := range cfg.Tables {
+		if tc.Schedule != "" {
+			return true
+		}
+	}
+	return false
+}
+
 func validateConfig(cfg *config.Config) bool {
 	log := logx.StyledLog
 
 	if cfg.PostgresURL == "" || cfg.ClickHouseURL == "" || cfg.Table == "" {
 		log.Error("Missing required config values. Provide them in YAML or as flags.",
-			zap.String("pg_url", cfg.PostgresURL),
-			zap.String("ch_url", cfg.ClickHouseURL),
+			zap.String("pg_url", db.RedactDSN(cfg.PostgresURL)),
+			zap.String("ch_url", db.RedactDSN(cfg.ClickHouseURL)),
 			zap.String("table", cfg.Table),
 		)
 		return false
@@ -226,7 +321,17 @@ func validateConfig(cfg *config.Config) bool {
 	return true
 }
 
-func ingestSingleTable(ctx context.Context, cfg *config.Config, tableConfig config.ResolvedTableConfig, pgConn *pgxpool.Pool) TableResult {
+// waitForPollers blocks until Ctrl+C or SIGTERM, then waits for the pollers
+// to finish their current cycle. A second signal exits at once.
+func waitForPollers(ctx context.Context, stop context.CancelFunc, pollers *sync.WaitGroup) {
+	<-ctx.Done()
+	stop()
+	logx.StyledLog.Info("Stopping pollers, finishing in-flight batches (Ctrl+C again to force)...")
+	pollers.Wait()
+	logx.StyledLog.Success("Pollers stopped")
+}
+
+func ingestSingleTable(ctx context.Context, cfg *config.Config, tableConfig config.ResolvedTableConfig, pgConn *pgxpool.Pool, pollers *sync.WaitGroup) TableResult {
 	// Create logging callbacks
 	opts := &etl.IngestOptions{
 		OnTableStart: func(tableName string) {
@@ -243,6 +348,7 @@ func ingestSingleTable(ctx context.Context, cfg *config.Config, tableConfig conf
 			log := logx.StyledLog.With(zap.String("table", tableName))
 			log.Info("Inserting data into ClickHouse (streaming)...")
 		},
+		OnProgress: logProgress,
 		OnTableComplete: func(tableName string, rowCount int64, duration time.Duration) {
 			log := logx.StyledLog.With(zap.String("table", tableName))
 			log.Success("Ingestion completed", zap.Int64("rows", rowCount), zap.Duration("duration", duration))
@@ -254,12 +360,15 @@ func ingestSingleTable(ctx context.Context, cfg *config.Config, tableConfig conf
 		StartPolling: func(ctx context.Context, tableConfig config.ResolvedTableConfig) {
 			startTablePolling(ctx, cfg, tableConfig, pgConn)
 		},
+		Pollers: pollers,
+		Memory:  memoryBudget(cfg),
+		Workers: workerBudget(cfg),
 	}
 
 	return etl.IngestSingleTable(ctx, pgConn, cfg.ClickHouseURL, tableConfig, opts)
 }
 
-func ingestMultipleTables(ctx context.Context, cfg *config.Config, pgConn *pgxpool.Pool) []TableResult {
+func ingestMultipleTables(ctx context.Context, cfg *config.Config, pgConn *pgxpool.Pool, pollers *sync.WaitGroup) []TableResult {
 	// Create logging callbacks
 	opts := &etl.IngestOptions{
 		OnTableStart: func(tableName string) {
@@ -276,6 +385,7 @@ func ingestMultipleTables(ctx context.Context, cfg *config.Config, pgConn *pgxpo
 			log := logx.StyledLog.With(zap.String("table", tableName))
 			log.Info("Inserting data into ClickHouse (streaming)...")
 		},
+		OnProgress: logProgress,
 		OnTableComplete: func(tableName string, rowCount int64, duration time.Duration) {
 			log := logx.StyledLog.With(zap.String("table", tableName))
 			log.Success("Ingestion completed", zap.Int64("rows", rowCount), zap.Duration("duration", duration))
@@ -287,27 +397,82 @@ func ingestMultipleTables(ctx context.Context, cfg *config.Config, pgConn *pgxpo
 		StartPolling: func(ctx context.Context, tableConfig config.ResolvedTableConfig) {
 			startTablePolling(ctx, cfg, tableConfig, pgConn)
 		},
+		OnQueue: func(queued []string) {
+			if len(queued) > 0 {
+				logx.StyledLog.Info(fmt.Sprintf("%d tables queued: %s", len(queued), strings.Join(queued, ", ")))
+			}
+		},
+		Pollers: pollers,
+		Memory:  memoryBudget(cfg),
+		Workers: workerBudget(cfg),
 	}
 
 	return etl.IngestMultipleTables(ctx, cfg, pgConn, opts)
 }
 
-func printResultsSummary(results []TableResult) {
+var (
+	memoryOnce    sync.Once
+	sharedMemory  *etl.MemoryBudget
+	workersOnce   sync.Once
+	sharedWorkers *etl.WorkerBudget
+)
+
+// memoryBudget returns the budget shared by every table and poller of the run
+func memoryBudget(cfg *config.Config) *etl.MemoryBudget {
+	memoryOnce.Do(func() {
+		sharedMemory = etl.NewMemoryBudget(cfg.MemoryLimit())
+	})
+	return sharedMemory
+}
+
+// workerBudget returns the insert slots shared by every table and poller of the run
+func workerBudget(cfg *config.Config) *etl.WorkerBudget {
+	workersOnce.Do(func() {
+		sharedWorkers = etl.NewWorkerBudget(cfg.InsertWorkerLimit())
+	})
+	return sharedWorkers
+}
+
+// logProgress prints a table's progress with its rate and time left
+func logProgress(tableName string, p etl.TableProgress) {
+	total := "?"
+	if p.Total > 0 {
+		total = fmt.Sprint(p.Total)
+		if p.TotalEstimated {
+			total = "~" + total
+		}
+	}
+	eta := "unknown"
+	if p.ETA > 0 {
+		eta = p.ETA.Round(time.Second).String()
+	}
+	logx.StyledLog.Info(
+		fmt.Sprintf("%d/%s rows inserted (%.1f%%), %.0f rows/s, %.1f MB/s, ETA %s",
+			p.Inserted, total, p.Percentage, p.RowsPerSec, p.BytesPerSec/1e6, eta),
+		zap.String("table", tableName),
+		zap.Int64("extracted", p.Extracted))
+}
+
+// printResultsSummary reports each table and returns whether all succeeded
+func printResultsSummary(results []TableResult) bool {
 	log := logx.StyledLog
 
 	successCount := 0
 	failCount := 0
 	totalRows := int64(0)
+	totalDead := int64(0)
 
 	ui.PrintSubtitle("Ingestion Results")
 
 	for _, r := range results {
+		totalDead += r.DeadLettered
 		if r.Success {
 			successCount++
 			totalRows += r.RowCount
 			log.Success(
 				fmt.Sprintf("Table '%s' completed", r.TableName),
 				zap.Int64("rows", r.RowCount),
+				zap.Int64("dead_lettered", r.DeadLettered),
 				zap.Duration("duration", r.Duration),
 			)
 		} else {
@@ -323,11 +488,10 @@ func printResultsSummary(results []TableResult) {
 		fmt.Sprintf("Total Tables: %d\n", len(results))+
 			fmt.Sprintf("Succeeded: %d\n", successCount)+
 			fmt.Sprintf("Failed: %d\n", failCount)+
-			fmt.Sprintf("Total Rows: %d", totalRows))
+			fmt.Sprintf("Total Rows: %d\n", totalRows)+
+			fmt.Sprintf("Dead-Lettered Rows: %d", totalDead))
 
-	if failCount > 0 {
-		os.Exit(1)
-	}
+	return failCount == 0
 }
 
 func startTablePolling(ctx context.Context, cfg *config.Config, tableConfig config.ResolvedTableConfig, pgConn *pgxpool.Pool) {
@@ -384,6 +548,8 @@ func startTablePolling(ctx context.Context, cfg *config.Config, tableConfig conf
 		BatchSize:     &tableConfig.BatchSize,
 		Limit:         &tableConfig.Limit,
 		Polling:       tableConfig.Polling,
+		ErrorPolicy:   tableConfig.ErrorPolicy,
+		Retry:         tableConfig.Retry,
 	}
 
 	log.Highlight(fmt.Sprintf("Calling startPolling with interval: %d seconds", tableConfig.Polling.Interval))
@@ -394,6 +560,19 @@ func startTablePolling(ctx context.Context, cfg *config.Config, tableConfig conf
 	}
 }
 
+// reportBreakerState tells the user when a database goes down or comes back
+func reportBreakerState(status db.BreakerStatus) {
+	log := logx.StyledLog.With(zap.String("database", status.Name))
+
+	switch status.State {
+	case db.BreakerOpen:
+		log.Warn(fmt.Sprintf("Lost connection to %s, pausing and reconnecting...", status.Name),
+			zap.String("error", status.LastError))
+	case db.BreakerClosed:
+		log.Success(fmt.Sprintf("Reconnected to %s, resuming", status.Name))
+	}
+}
+
 // Helper function to convert int to string for UI
 func UI_itoa(n int) string {
 	if n == 0 {
@@ -410,9 +589,16 @@ func init() {
 	ingestCmd.Flags().StringVar(&ingestTables, "tables", "", "Comma-separated list of tables (e.g., users,orders,products)")
 	ingestCmd.Flags().IntVar(&ingestLimit, "limit", 1000, "Limit rows to fetch from PG")
 	ingestCmd.Flags().IntVar(&ingestBatch, "batch-size", 500, "Rows per ClickHouse insert")
+	ingestCmd.Flags().BoolVar(&ingestExactCount, "exact-count", false, "Count rows with COUNT(*) for progress totals instead of using the planner estimate")
+	ingestCmd.Flags().StringVar(&ingestLoadMode, "load-mode", "", "What to do with rows already in ClickHouse: append, truncate or replace (default: load_mode or append)")
+	ingestCmd.Flags().IntVar(&ingestMaxParallel, "max-parallel-tables", 0, "Tables loading at once (default: max_parallel_tables or 4)")
+	ingestCmd.Flags().IntVar(&ingestInsertWorkers, "insert-workers", 0, "Batch inserts running at once across all tables (default: insert_workers or 16)")
 	// Polling flags
 	ingestCmd.Flags().BoolVar(&ingestPoll, "poll", false, "Continue polling for changes after initial ingest")
 	ingestCmd.Flags().StringVar(&ingestPollDelta, "poll-delta", "", "Column name to track changes (usually a timestamp)")
 	ingestCmd.Flags().IntVar(&ingestPollInt, "poll-interval", 0, "Polling interval in seconds")
+	ingestCmd.Flags().StringVar(&ingestMetricsAddr, "metrics-addr", "", "Serve Prometheus metrics on this address (e.g. :9090)")
+	ingestCmd.Flags().StringVar(&ingestTraceExporter, "trace-exporter", "", "Export traces: otlp or stdout (overrides tracing.exporter)")
+	ingestCmd.Flags().StringVar(&ingestTraceEndpoint, "trace-endpoint", "", "OTLP/HTTP collector host:port (overrides tracing.endpoint)")
 	rootCmd.AddCommand(ingestCmd)
 }
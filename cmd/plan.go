@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pixperk/chug/internal/db"
+	"github.com/pixperk/chug/internal/etl"
+	"github.com/pixperk/chug/internal/logx"
+	"github.com/pixperk/chug/internal/ui"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var planJSON bool
+
+var planCmd = &cobra.Command{
+	Use:   "plan",
+	Short: "Show the ClickHouse tables an ingest would create, without creating them",
+	Long: "Builds the DDL of each configured table, maps its column types with warnings\n" +
+		"for lossy conversions, estimates its rows and compares it with any existing\n" +
+		"ClickHouse table. Nothing is created or copied.",
+	Run: func(cmd *cobra.Command, args []string) {
+		log := logx.StyledLog
+		cfg := loadConfig(cmd)
+		defer db.CloseAllPools()
+
+		if cfg.PostgresURL == "" {
+			log.Error("PostgreSQL URL not provided (set pg_url in .chug.yaml or --pg-url)")
+			os.Exit(1)
+		}
+		db.Pools.RegisterProfiles(cfg.Connections)
+
+		tableConfigs := cfg.GetEffectiveTableConfigs()
+		if len(tableConfigs) == 0 {
+			log.Error("No tables specified. Use --table, --tables flag, or configure tables in YAML")
+			os.Exit(1)
+		}
+
+		pgConn, err := db.GetPostgresPool(cfg.PostgresURL)
+		if err != nil {
+			log.Error("Failed to connect to PostgreSQL", zap.Error(err))
+			os.Exit(1)
+		}
+
+		ctx := context.Background()
+		var plans []*etl.TablePlan
+		failed := false
+		for _, tc := range tableConfigs {
+			plan, err := etl.PlanTable(ctx, pgConn, cfg.ClickHouseURL, cfg.ResolveTableConfig(tc))
+			if err != nil {
+				log.Error("Failed to plan table", zap.String("table", tc.Name), zap.Error(err))
+				failed = true
+				continue
+			}
+			plans = append(plans, plan)
+		}
+
+		if planJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(plans)
+		} else {
+			for _, plan := range plans {
+				printPlan(plan)
+			}
+		}
+		if failed {
+			db.CloseAllPools()
+			os.Exit(1)
+		}
+	},
+}
+
+func printPlan(plan *etl.TablePlan) {
+	ui.PrintTitle("Table: " + plan.Table)
+
+	estimate := "unknown (table never analyzed)"
+	if plan.EstimatedRows >= 0 {
+		estimate = fmt.Sprintf("~%d rows", plan.EstimatedRows)
+	}
+	target := "will be created"
+	if plan.Exists {
+		target = "exists (" + plan.ExistingEngine + "), DDL is a no-op"
+	}
+	pk := "none"
+	if len(plan.PrimaryKey) > 0 {
+		pk = strings.Join(plan.PrimaryKey, ", ")
+	}
+	ui.PrintBox("Plan",
+		fmt.Sprintf("Engine: %s\nPrimary key: %s\nEstimated size: %s\nClickHouse table: %s",
+			plan.Engine, pk, estimate, target))
+
+	rows := make([][]string, len(plan.Columns))
+	for i, col := range plan.Columns {
+		chType := col.ClickHouseType
+		if chType == "" {
+			chType = "-"
+		}
+		rows[i] = []string{col.Name, col.PostgresType, chType, col.Warning}
+	}
+	ui.DisplayTable([]string{"Column", "PostgreSQL", "ClickHouse", "Warning"}, rows)
+
+	if len(plan.Diff) > 0 {
+		fmt.Println()
+		rows := make([][]string, len(plan.Diff))
+		for i, d := range plan.Diff {
+			rows[i] = []string{d.Name, d.Change, d.Planned, d.Existing}
+		}
+		ui.DisplayTable([]string{"Column", "Change", "Planned", "Existing"}, rows)
+	}
+
+	if plan.DDL != "" {
+		fmt.Println()
+		ui.PrintHighlight(plan.DDL)
+	}
+	for _, warning := range plan.Warnings {
+		ui.PrintWarning(warning)
+	}
+	fmt.Println()
+}
+
+func init() {
+	// Shares its flags with ingest so both read the same tables
+	planCmd.Flags().StringVar(&ingestConfigPath, "config", "", "Path to YAML config file (default: .chug.yaml)")
+	planCmd.Flags().StringVar(&ingestPgURL, "pg-url", "", "PostgreSQL connection URL")
+	planCmd.Flags().StringVar(&ingestChURL, "ch-url", "", "ClickHouse connection URL")
+	planCmd.Flags().StringVar(&ingestTable, "table", "", "Table name to plan")
+	planCmd.Flags().StringVar(&ingestTables, "tables", "", "Comma-separated list of tables (e.g., users,orders,products)")
+	planCmd.Flags().BoolVar(&ingestPoll, "poll", false, "Plan the CDC table layout (ReplacingMergeTree)")
+	planCmd.Flags().StringVar(&ingestPollDelta, "poll-delta", "", "Column name to track changes (usually a timestamp)")
+	planCmd.Flags().BoolVar(&planJSON, "json", false, "Print the plans as JSON")
+	rootCmd.AddCommand(planCmd)
+}
@@ -7,8 +7,10 @@ import (
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/db"
 	"github.com/pixperk/chug/internal/etl"
 	"github.com/pixperk/chug/internal/logx"
+	"github.com/pixperk/chug/internal/metrics"
 	"github.com/pixperk/chug/internal/poller"
 	"github.com/pixperk/chug/internal/ui"
 	"go.uber.org/zap"
@@ -37,19 +39,32 @@ func startPolling(ctx context.Context, cfg *config.Config, lastSeen string, pgCo
 		log.Success("Index ready on delta column", zap.String("column", cfg.Polling.DeltaCol))
 	}
 
+	dlq, err := etl.NewDeadLetterQueue(cfg.ClickHouseURL, cfg.Table, cfg.ErrorPolicy)
+	if err != nil {
+		return fmt.Errorf("dead-letter queue setup failed: %w", err)
+	}
+	if dlq != nil {
+		defer dlq.Close()
+	}
+	retry := etl.RetryConfigFromPolicy(cfg.Retry)
+	tableMetrics := metrics.ForTable(metrics.CLIJob, cfg.Table)
+	insertOpts := &etl.InsertOptions{
+		Retry:     &retry,
+		DLQ:       dlq,
+		MaxErrors: cfg.ErrorPolicy.MaxErrors,
+		Metrics:   tableMetrics,
+		Memory:    memoryBudget(cfg),
+		Workers:   workerBudget(cfg),
+	}
+
 	// Define how to handle new data
-	processNewData := func(data *etl.TableData) error {
-		if len(data.Rows) > 0 {
-			log.Info(fmt.Sprintf("Processing new data batch: %d rows", len(data.Rows)),
-				zap.Int("rows", len(data.Rows)),
-				zap.String("table", cfg.Table),
-			)
-		} else {
-			log.Info("No new data found in this polling cycle")
+	processNewData := func(ctx context.Context, stream *etl.StreamResult) error {
+		stats, err := etl.InsertRowsStreaming(ctx, cfg.ClickHouseURL, cfg.Table, etl.GetColumnNames(stream.Columns), stream.RowChan, *cfg.BatchSize, insertOpts)
+		if stats.DeadLettered > 0 {
+			log.Warn(fmt.Sprintf("%d rows written to dead-letter queue", stats.DeadLettered),
+				zap.String("table", cfg.Table))
 		}
-
-		// Insert the new rows
-		return etl.InsertRows(cfg.ClickHouseURL, cfg.Table, etl.GetColumnNames(data.Columns), data.Rows, *cfg.BatchSize)
+		return err
 	}
 
 	pollConfig := poller.PollConfig{
@@ -59,6 +74,10 @@ func startPolling(ctx context.Context, cfg *config.Config, lastSeen string, pgCo
 		Limit:     cfg.Limit,
 		StartFrom: lastSeen,
 		OnData:    processNewData,
+		Source:    db.PostgresBreaker(cfg.PostgresURL),
+		Target:    db.ClickHouseBreaker(cfg.ClickHouseURL),
+		Metrics:   tableMetrics,
+		Memory:    insertOpts.Memory,
 	}
 
 	p := poller.NewPoller(pgConn, pollConfig)
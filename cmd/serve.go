@@ -1,8 +1,18 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
 	"github.com/pixperk/chug/api"
 	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/db"
 	"github.com/pixperk/chug/internal/logx"
 	"github.com/pixperk/chug/internal/ui"
 	"github.com/spf13/cobra"
@@ -14,6 +24,9 @@ var (
 	serveConfigPath string
 	servePgURL      string
 	serveChURL      string
+	// Observability
+	serveTraceExporter string
+	serveTraceEndpoint string
 )
 
 var serveCmd = &cobra.Command{
@@ -31,6 +44,11 @@ var serveCmd = &cobra.Command{
 		if err != nil {
 			log.Warn("Could not load config from file, using flags", zap.Error(err))
 			cfg = &config.Config{}
+			// Connection profiles can still come from CHUG_CONNECTION_* variables
+			if err := cfg.ResolveConnections(); err != nil {
+				log.Error("Invalid connection profiles", zap.Error(err))
+				return
+			}
 		}
 
 		// Override with flags if provided
@@ -40,22 +58,47 @@ var serveCmd = &cobra.Command{
 		if serveChURL != "" {
 			cfg.ClickHouseURL = serveChURL
 		}
+		db.Pools.RegisterProfiles(cfg.Connections)
+
+		applyTracingFlags(cfg, serveTraceExporter, serveTraceEndpoint)
+		flushTraces := setupTracing(context.Background(), cfg.Tracing)
+		defer flushTraces()
 
 		// Display configuration
 		var configInfo string
 		if cfg.PostgresURL != "" && cfg.ClickHouseURL != "" {
-			configInfo = "PostgreSQL: " + cfg.PostgresURL + "\n" +
-				"ClickHouse: " + cfg.ClickHouseURL + "\n" +
+			configInfo = "PostgreSQL: " + db.RedactDSN(cfg.PostgresURL) + "\n" +
+				"ClickHouse: " + db.RedactDSN(cfg.ClickHouseURL) + "\n" +
 				"Server Port: " + servePort
 		} else {
 			configInfo = "Server Port: " + servePort + "\n" +
 				"Note: Database URLs can be provided per-request via the web UI"
 		}
 
+		if len(cfg.Connections) > 0 {
+			names := make([]string, 0, len(cfg.Connections))
+			for name := range cfg.Connections {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			configInfo += "\nConnections: " + strings.Join(names, ", ")
+		}
+
 		ui.PrintBox("Configuration", configInfo)
 
 		// Create and start server
-		server := api.NewServer(cfg, log.GetZapLogger())
+		store, err := api.NewJobStore(cfg.Server.JobStore, cfg.PostgresURL)
+		if err != nil {
+			log.Error("Failed to open job store", zap.Error(err))
+			return
+		}
+		defer store.Close()
+
+		server, err := api.NewServer(cfg, log.GetZapLogger(), store)
+		if err != nil {
+			log.Error("Failed to create server", zap.Error(err))
+			return
+		}
 
 		log.Highlight("Starting API server on http://localhost:" + servePort)
 		log.Info("")
@@ -63,17 +106,63 @@ var serveCmd = &cobra.Command{
 		log.Info("")
 		log.Info("API Endpoints:")
 		log.Info("  GET  /health                - Health check")
+		log.Info("  GET  /api/v1/openapi.yaml   - OpenAPI document")
+		log.Info("  GET  /api/v1/connections    - List named connection profiles")
 		log.Info("  GET  /api/v1/tables         - List available PostgreSQL tables")
+		log.Info("  GET  /api/v1/tables/{name}/preview - DDL dry-run and type mapping")
+		log.Info("  GET  /api/v1/tables/{name}/verify  - Compare PostgreSQL and ClickHouse (POST repairs)")
 		log.Info("  POST /api/v1/ingest         - Start ingestion job")
-		log.Info("  GET  /api/v1/jobs           - List all jobs")
+		log.Info("  GET  /api/v1/jobs           - List jobs (?status=&table=&since=&limit=&cursor=)")
 		log.Info("  GET  /api/v1/jobs/{id}      - Get job status")
-		log.Info("  WS   /ws                    - WebSocket for real-time updates")
+		log.Info("  POST /api/v1/jobs/{id}/cancel - Cancel a job (or ?table=)")
+		log.Info("  POST /api/v1/jobs/{id}/pause  - Pause a job (or ?table=)")
+		log.Info("  POST /api/v1/jobs/{id}/resume - Resume a paused job (or ?table=)")
+		log.Info("  POST /api/v1/jobs/{id}/retry  - Re-run the failed tables of a job")
+		log.Info("  GET  /api/v1/jobs/{id}/events      - Server-Sent Events for a job")
+		log.Info("  GET  /api/v1/jobs/{id}/events/poll - Long-poll for job updates")
+		log.Info("  GET  /api/v1/schedules      - List cron schedules (POST to add one)")
+		log.Info("  GET  /api/v1/events         - Server-Sent Events for every job")
+		log.Info("  WS   /ws                    - WebSocket for real-time updates (?job_id=&since=)")
+		if cfg.Server.MetricsAddr != "" {
+			log.Info("  GET  /metrics               - Prometheus metrics on http://" + cfg.Server.MetricsAddr + " (no auth)")
+		} else {
+			log.Info("  GET  /metrics               - Prometheus metrics")
+		}
 		log.Info("")
 		log.Highlight("Press Ctrl+C to stop")
 
-		if err := server.Start(":" + servePort); err != nil {
+		defer db.CloseAllPools()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- server.Start(":" + servePort)
+		}()
+
+		select {
+		case err := <-errCh:
+			log.Error("Server failed", zap.Error(err))
+			return
+		case <-ctx.Done():
+		}
+		// A second signal kills the process
+		stop()
+
+		timeout := cfg.Server.ShutdownTimeout()
+		log.Warn("Shutting down, waiting for running jobs to flush", zap.Duration("timeout", timeout))
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error("Shutdown incomplete", zap.Error(err))
+			return
+		}
+		if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Error("Server failed", zap.Error(err))
+			return
 		}
+		log.Success("Server stopped")
 	},
 }
 
@@ -82,5 +171,7 @@ func init() {
 	serveCmd.Flags().StringVar(&serveConfigPath, "config", "", "Path to YAML config file")
 	serveCmd.Flags().StringVar(&servePgURL, "pg-url", "", "PostgreSQL connection URL")
 	serveCmd.Flags().StringVar(&serveChURL, "ch-url", "", "ClickHouse connection URL")
+	serveCmd.Flags().StringVar(&serveTraceExporter, "trace-exporter", "", "Export traces: otlp or stdout (overrides tracing.exporter)")
+	serveCmd.Flags().StringVar(&serveTraceEndpoint, "trace-endpoint", "", "OTLP/HTTP collector host:port (overrides tracing.endpoint)")
 	rootCmd.AddCommand(serveCmd)
 }
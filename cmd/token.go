@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/pixperk/chug/api"
+	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/logx"
+	"github.com/pixperk/chug/internal/ui"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	tokenName string
+	tokenRole string
+)
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Generate an API token for chug serve",
+	Long:  `Generates a random API token and the hashed config entry to add under server.auth.tokens`,
+	Run: func(cmd *cobra.Command, args []string) {
+		ui.PrintTitle("API Token")
+
+		log := logx.StyledLog
+
+		if tokenRole != config.RoleReadOnly && tokenRole != config.RoleOperator {
+			log.Error("Role must be read_only or operator", zap.String("role", tokenRole))
+			return
+		}
+
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			log.Error("Failed to generate token", zap.Error(err))
+			return
+		}
+		token := "chug_" + base64.RawURLEncoding.EncodeToString(raw)
+
+		ui.PrintBox("Token (shown once)", token)
+		ui.PrintBox("Add to .chug.yaml", fmt.Sprintf(
+			"server:\n  auth:\n    tokens:\n      - name: %s\n        hash: \"%s\"\n        role: %s",
+			tokenName, api.HashToken(token), tokenRole))
+	},
+}
+
+func init() {
+	tokenCmd.Flags().StringVar(&tokenName, "name", "default", "Name recorded in the audit log for this token")
+	tokenCmd.Flags().StringVar(&tokenRole, "role", config.RoleReadOnly, "Token role: read_only or operator")
+	rootCmd.AddCommand(tokenCmd)
+}
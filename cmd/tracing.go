@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/logx"
+	"github.com/pixperk/chug/internal/tracing"
+	"go.uber.org/zap"
+)
+
+// applyTracingFlags overrides the tracing config with --trace-exporter and --trace-endpoint
+func applyTracingFlags(cfg *config.Config, exporter, endpoint string) {
+	if exporter != "" {
+		cfg.Tracing.Exporter = exporter
+	}
+	if endpoint != "" {
+		cfg.Tracing.Endpoint = endpoint
+	}
+}
+
+// setupTracing starts exporting spans and returns the function flushing them.
+// Tracing failures are logged and never stop the command.
+func setupTracing(ctx context.Context, cfg config.TracingConfig) func() {
+	log := logx.StyledLog
+	shutdown, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		log.Warn("Tracing disabled", zap.Error(err))
+		return func() {}
+	}
+	if cfg.Exporter != "" && cfg.Exporter != config.TracingNone {
+		log.Info("Tracing enabled", zap.String("exporter", cfg.Exporter))
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Warn("Failed to flush traces", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pixperk/chug/internal/db"
+	"github.com/pixperk/chug/internal/etl"
+	"github.com/pixperk/chug/internal/logx"
+	"github.com/pixperk/chug/internal/ui"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	verifyChunkSize int
+	verifyRepair    bool
+	verifyJSON      bool
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check that ClickHouse tables match their PostgreSQL source",
+	Long: "Compares row counts, per-column aggregates and, for tables with a single\n" +
+		"integer primary key, checksums of primary key ranges. ReplacingMergeTree\n" +
+		"tables are read with FINAL. With --repair, ranges that differ are deleted\n" +
+		"from ClickHouse and copied again. Exits with status 1 on any mismatch.",
+	Run: func(cmd *cobra.Command, args []string) {
+		log := logx.StyledLog
+		cfg := loadConfig(cmd)
+		defer db.CloseAllPools()
+
+		if cfg.PostgresURL == "" || cfg.ClickHouseURL == "" {
+			log.Error("PostgreSQL and ClickHouse URLs are required (set them in .chug.yaml or with --pg-url and --ch-url)")
+			os.Exit(1)
+		}
+		db.Pools.RegisterProfiles(cfg.Connections)
+
+		tableConfigs := cfg.GetEffectiveTableConfigs()
+		if len(tableConfigs) == 0 {
+			log.Error("No tables specified. Use --table, --tables flag, or configure tables in YAML")
+			os.Exit(1)
+		}
+
+		pgConn, err := db.GetPostgresPool(cfg.PostgresURL)
+		if err != nil {
+			log.Error("Failed to connect to PostgreSQL", zap.Error(err))
+			os.Exit(1)
+		}
+
+		ctx := context.Background()
+		var reports []*etl.VerifyReport
+		failed := false
+		for _, tc := range tableConfigs {
+			resolved := cfg.ResolveTableConfig(tc)
+			retry := etl.RetryConfigFromPolicy(resolved.Retry)
+			report, err := etl.VerifyTable(ctx, pgConn, cfg.ClickHouseURL, resolved, etl.VerifyOptions{
+				ChunkRows: verifyChunkSize,
+				Repair:    verifyRepair,
+				BatchSize: resolved.BatchSize,
+				Insert:    &etl.InsertOptions{Retry: &retry},
+			})
+			if err != nil {
+				log.Error("Failed to verify table", zap.String("table", tc.Name), zap.Error(err))
+				failed = true
+				continue
+			}
+			reports = append(reports, report)
+			failed = failed || !report.Match
+		}
+
+		if verifyJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(reports)
+		} else {
+			for _, report := range reports {
+				printVerifyReport(report)
+			}
+		}
+		if failed {
+			db.CloseAllPools()
+			os.Exit(1)
+		}
+	},
+}
+
+func printVerifyReport(report *etl.VerifyReport) {
+	ui.PrintTitle("Table: " + report.Table)
+
+	checksums := "skipped"
+	if report.PrimaryKey != "" {
+		checksums = fmt.Sprintf("%d ranges of %s, %d differ", report.Ranges, report.PrimaryKey, len(report.Mismatches))
+	}
+	final := ""
+	if report.Final {
+		final = " (FINAL)"
+	}
+	ui.PrintBox("Verification",
+		fmt.Sprintf("PostgreSQL rows: %d\nClickHouse rows: %d%s\nChecksums: %s\nDuration: %s",
+			report.PostgresRows, report.ClickHouseRows, final, checksums, report.Duration))
+
+	var rows [][]string
+	for _, check := range report.Aggregates {
+		if !check.Match {
+			rows = append(rows, []string{check.Column, check.Aggregate, check.Postgres, check.ClickHouse})
+		}
+	}
+	if len(rows) > 0 {
+		ui.DisplayTable([]string{"Column", "Aggregate", "PostgreSQL", "ClickHouse"}, rows)
+		fmt.Println()
+	}
+
+	if len(report.Mismatches) > 0 {
+		rows = make([][]string, len(report.Mismatches))
+		for i, mismatch := range report.Mismatches {
+			status := "differs"
+			if mismatch.Repaired {
+				status = "repaired"
+			} else if mismatch.RepairError != "" {
+				status = "repair failed: " + mismatch.RepairError
+			}
+			rows[i] = []string{mismatch.String(), fmt.Sprint(mismatch.PostgresRows), fmt.Sprint(mismatch.ClickHouseRows), status}
+		}
+		ui.DisplayTable([]string{"Range", "PostgreSQL", "ClickHouse", "Status"}, rows)
+		fmt.Println()
+	}
+
+	for _, warning := range report.Warnings {
+		ui.PrintWarning(warning)
+	}
+	if report.Match {
+		ui.PrintSuccess("Table matches")
+	} else {
+		ui.PrintError("Table does not match")
+	}
+	fmt.Println()
+}
+
+func init() {
+	// Shares its flags with ingest so both read the same tables
+	verifyCmd.Flags().StringVar(&ingestConfigPath, "config", "", "Path to YAML config file (default: .chug.yaml)")
+	verifyCmd.Flags().StringVar(&ingestPgURL, "pg-url", "", "PostgreSQL connection URL")
+	verifyCmd.Flags().StringVar(&ingestChURL, "ch-url", "", "ClickHouse connection URL")
+	verifyCmd.Flags().StringVar(&ingestTable, "table", "", "Table name to verify")
+	verifyCmd.Flags().StringVar(&ingestTables, "tables", "", "Comma-separated list of tables (e.g., users,orders,products)")
+	verifyCmd.Flags().IntVar(&verifyChunkSize, "chunk-size", etl.DefaultVerifyChunkRows, "PostgreSQL rows per checksum range")
+	verifyCmd.Flags().BoolVar(&verifyRepair, "repair", false, "Delete and re-ingest the ranges that differ")
+	verifyCmd.Flags().BoolVar(&verifyJSON, "json", false, "Print the reports as JSON")
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -2,39 +2,303 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"time"
 
+	"github.com/pixperk/chug/api/types"
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	PostgresURL   string        `yaml:"pg_url"`
-	ClickHouseURL string        `yaml:"ch_url"`
-	Table         string        `yaml:"table"`
-	Limit         *int          `yaml:"limit"`
-	BatchSize     *int          `yaml:"batch_size"`
-	Polling       PollingConfig `yaml:"polling"`
-	Tables        []TableConfig `yaml:"tables"`
+	PostgresURL          string                       `yaml:"pg_url"`
+	ClickHouseURL        string                       `yaml:"ch_url"`
+	PostgresConnection   string                       `yaml:"pg_connection"` // name of a profile in connections, overrides pg_url
+	ClickHouseConnection string                       `yaml:"ch_connection"` // name of a profile in connections, overrides ch_url
+	Connections          map[string]ConnectionProfile `yaml:"connections"`
+	Table                string                       `yaml:"table"`
+	Limit                *int                         `yaml:"limit"`
+	BatchSize            *int                         `yaml:"batch_size"`
+	ExactCount           *bool                        `yaml:"exact_count"`         // progress totals from COUNT(*) instead of the planner estimate
+	MemoryLimitMB        int                          `yaml:"memory_limit_mb"`     // rows buffered across all tables, default 512
+	MaxParallelTables    int                          `yaml:"max_parallel_tables"` // tables loading at once, default 4
+	InsertWorkers        int                          `yaml:"insert_workers"`      // batch inserts running at once across all tables, default 16
+	LoadMode             string                       `yaml:"load_mode"`           // append (default), truncate or replace
+	Polling              PollingConfig                `yaml:"polling"`
+	ErrorPolicy          ErrorPolicy                  `yaml:"error_policy"`
+	Retry                RetryPolicy                  `yaml:"retry"`
+	Tables               []TableConfig                `yaml:"tables"`
+	Schedule             string                       `yaml:"schedule"` // cron expression, chug serve re-runs the tables without their own schedule
+	Server               ServerConfig                 `yaml:"server"`
+	Tracing              TracingConfig                `yaml:"tracing"`
 }
 
-type TableConfig struct {
-	Name      string         `yaml:"name"`
-	Limit     *int           `yaml:"limit"`
-	BatchSize *int           `yaml:"batch_size"`
-	Polling   *PollingConfig `yaml:"polling"`
+// ServerConfig holds settings used only by chug serve
+type ServerConfig struct {
+	JobStore      JobStoreConfig `yaml:"job_store"`
+	Auth          AuthConfig     `yaml:"auth"`
+	AllowRawURLs  *bool          `yaml:"allow_raw_urls"`  // accept pg_url/ch_url in requests, default: only when no connections are configured
+	AllowSQLHooks bool           `yaml:"allow_sql_hooks"` // accept pre_sql/post_sql in API requests, default false since hooks run any SQL as chug
+	MetricsAddr   string         `yaml:"metrics_addr"`    // serve /metrics here without auth instead of on the API address
+
+	ShutdownTimeoutSecs int `yaml:"shutdown_timeout_seconds"` // how long running jobs get to flush on SIGINT/SIGTERM, default 30
+}
+
+// ShutdownTimeout returns how long chug serve waits for running jobs on shutdown
+func (c ServerConfig) ShutdownTimeout() time.Duration {
+	if c.ShutdownTimeoutSecs > 0 {
+		return time.Duration(c.ShutdownTimeoutSecs) * time.Second
+	}
+	return 30 * time.Second
+}
+
+// DefaultMemoryLimitMB is the default bound on rows buffered between
+// extraction and insertion, shared by all tables
+const DefaultMemoryLimitMB = 512
+
+// MemoryLimit returns the bytes of rows that may be buffered at once
+func (c *Config) MemoryLimit() int64 {
+	if c.MemoryLimitMB > 0 {
+		return int64(c.MemoryLimitMB) << 20
+	}
+	return DefaultMemoryLimitMB << 20
+}
+
+// Defaults for the concurrency limits of multi-table ingestion
+const (
+	DefaultMaxParallelTables = 4
+	DefaultInsertWorkers     = 16
+)
+
+// ParallelTables returns how many tables load at once
+func (c *Config) ParallelTables() int {
+	if c.MaxParallelTables > 0 {
+		return c.MaxParallelTables
+	}
+	return DefaultMaxParallelTables
+}
+
+// InsertWorkerLimit returns how many batch inserts run at once across all tables
+func (c *Config) InsertWorkerLimit() int {
+	if c.InsertWorkers > 0 {
+		return c.InsertWorkers
+	}
+	return DefaultInsertWorkers
+}
+
+// RawURLsAllowed reports whether API requests may carry connection strings
+// instead of connection names
+func (c *Config) RawURLsAllowed() bool {
+	if c.Server.AllowRawURLs != nil {
+		return *c.Server.AllowRawURLs
+	}
+	return len(c.Connections) == 0
+}
+
+// API roles
+const (
+	RoleReadOnly = "read_only" // list tables and jobs, watch progress
+	RoleOperator = "operator"  // also start, cancel, pause, resume and retry jobs
+)
+
+// AuthConfig protects the API. Auth is on as soon as a token or a JWKS file
+// is configured.
+type AuthConfig struct {
+	Tokens         []TokenConfig `yaml:"tokens"`
+	JWT            *JWTConfig    `yaml:"jwt"`
+	AllowedOrigins []string      `yaml:"allowed_origins"` // origins allowed to open /ws, "*" = any
+	AuditLog       string        `yaml:"audit_log"`       // file for audit entries, default: server log
+}
+
+// TokenConfig is a static API token. Only its SHA-256 hash is stored.
+type TokenConfig struct {
+	Name string `yaml:"name"`
+	Hash string `yaml:"hash"` // "sha256:<hex>", see chug token
+	Role string `yaml:"role"` // read_only | operator
+}
+
+// JWTConfig verifies bearer JWTs against keys from a local JWKS file
+type JWTConfig struct {
+	JWKSFile    string `yaml:"jwks_file"`
+	Issuer      string `yaml:"issuer"`       // required iss, empty = not checked
+	Audience    string `yaml:"audience"`     // required aud, empty = not checked
+	RoleClaim   string `yaml:"role_claim"`   // claim holding the role, default "role"
+	DefaultRole string `yaml:"default_role"` // role when the claim is missing, default read_only
+}
+
+// Enabled reports whether the API requires authentication
+func (a AuthConfig) Enabled() bool {
+	return len(a.Tokens) > 0 || a.JWT != nil
+}
+
+// Job store types
+const (
+	JobStoreFile     = "file"     // one JSON file per job under Path (default)
+	JobStorePostgres = "postgres" // _chug_jobs table in PostgreSQL
+	JobStoreMemory   = "memory"   // no persistence, jobs are lost on restart
+)
+
+// JobStoreConfig controls where chug serve keeps job history
+type JobStoreConfig struct {
+	Type string `yaml:"type"` // file | postgres | memory
+	Path string `yaml:"path"` // file store directory, default .chug/jobs
+	URL  string `yaml:"url"`  // postgres store DSN, defaults to pg_url
+
+	Retention JobRetentionConfig `yaml:"retention"`
+}
+
+// JobRetentionConfig bounds the job history. Running jobs and jobs with
+// active CDC pollers are never pruned.
+type JobRetentionConfig struct {
+	MaxAgeDays int `yaml:"max_age_days"` // prune jobs that finished longer ago, 0 = no age limit
+	MaxJobs    int `yaml:"max_jobs"`     // keep the newest finished jobs, default 1000, -1 = no limit
+}
+
+// JobLimit returns how many finished jobs are kept, -1 for no limit
+func (r JobRetentionConfig) JobLimit() int {
+	switch {
+	case r.MaxJobs < 0:
+		return -1
+	case r.MaxJobs == 0:
+		return 1000
+	default:
+		return r.MaxJobs
+	}
+}
+
+// Tracing exporters
+const (
+	TracingNone   = "none"
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+)
+
+// TracingConfig controls OpenTelemetry tracing of ingestion and polling
+type TracingConfig struct {
+	Exporter    string            `yaml:"exporter"`     // none | otlp | stdout, default none
+	Endpoint    string            `yaml:"endpoint"`     // OTLP/HTTP collector host:port, default from OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318
+	Insecure    bool              `yaml:"insecure"`     // send OTLP over plain HTTP
+	Headers     map[string]string `yaml:"headers"`      // extra OTLP headers, e.g. an API key
+	ServiceName string            `yaml:"service_name"` // default chug
+	SampleRatio *float64          `yaml:"sample_ratio"` // fraction of new traces recorded, default 1
+}
+
+// Connection profile types
+const (
+	ConnectionPostgres   = "postgres"
+	ConnectionClickHouse = "clickhouse"
+)
+
+// ClickHouse compression methods
+const (
+	CompressionNone = "none"
+	CompressionLZ4  = "lz4"
+	CompressionZSTD = "zstd"
+)
+
+// ConnectionProfile is a named database connection with its own pool sizing,
+// timeouts and TLS settings
+type ConnectionProfile struct {
+	Type         string         `yaml:"type"` // postgres | clickhouse
+	URL          string         `yaml:"url"`
+	URLEnv       string         `yaml:"url_env"`       // environment variable holding the URL
+	URLFile      string         `yaml:"url_file"`      // file holding the URL, e.g. a mounted secret
+	PasswordFile string         `yaml:"password_file"` // file holding the password, replaces the one in the URL
+	Pool         PoolConfig     `yaml:"pool"`
+	Timeouts     TimeoutConfig  `yaml:"timeouts"`
+	TLS          *TLSConfig     `yaml:"tls"`
+	Compression  string         `yaml:"compression"` // ClickHouse only: none | lz4 | zstd
+	Settings     map[string]any `yaml:"settings"`    // ClickHouse only, sent with every query
+}
+
+// TimeoutConfig bounds connecting and query execution. Zero values fall back to the defaults.
+type TimeoutConfig struct {
+	DialSecs      int `yaml:"dial_seconds"`      // connect and ping, default 10
+	StatementSecs int `yaml:"statement_seconds"` // per statement, 0 = no limit
+}
+
+// TLSConfig configures TLS for a connection. For PostgreSQL it replaces the
+// TLS settings derived from sslmode; for ClickHouse TLS is otherwise only
+// used for https:// URLs.
+type TLSConfig struct {
+	Enabled            *bool  `yaml:"enabled"` // default true when the tls block is present
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"` // client certificate
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// IsEnabled reports whether TLS should be used
+func (t *TLSConfig) IsEnabled() bool {
+	return t != nil && (t.Enabled == nil || *t.Enabled)
+}
+
+// PoolConfig sizes a connection pool. Zero values fall back to the defaults.
+type PoolConfig struct {
+	MaxConns            int `yaml:"max_conns"`
+	MinConns            int `yaml:"min_conns"`      // PostgreSQL only
+	MaxIdleConns        int `yaml:"max_idle_conns"` // ClickHouse only
+	MaxConnLifetimeSecs int `yaml:"max_conn_lifetime_seconds"`
+	MaxConnIdleSecs     int `yaml:"max_conn_idle_seconds"`
 }
 
-type PollingConfig struct {
-	Enabled  bool   `yaml:"enabled" json:"enabled"`
-	DeltaCol string `yaml:"delta_column" json:"delta_column"`
-	Interval int    `yaml:"interval_seconds" json:"interval_seconds"`
+type TableConfig struct {
+	Name        string         `yaml:"name"`
+	Limit       *int           `yaml:"limit"`
+	BatchSize   *int           `yaml:"batch_size"`
+	ExactCount  *bool          `yaml:"exact_count"`
+	Priority    int            `yaml:"priority"` // higher loads first, ties keep config order
+	LoadMode    string         `yaml:"load_mode"`
+	Polling     *PollingConfig `yaml:"polling"`
+	ErrorPolicy *ErrorPolicy   `yaml:"error_policy"`
+	Retry       *RetryPolicy   `yaml:"retry"`
+	Schedule    string         `yaml:"schedule"`   // cron expression, chug serve re-runs this table on its own
+	DependsOn   []string       `yaml:"depends_on"` // tables that must load successfully before this one starts
+	PreSQL      *SQLHooks      `yaml:"pre_sql"`    // run before the load: PostgreSQL before extraction, ClickHouse once the table exists
+	PostSQL     *SQLHooks      `yaml:"post_sql"`   // run after the last batch is committed
 }
 
+// Load modes, deciding what happens to the rows already in the ClickHouse table
+const (
+	LoadModeAppend   = "append"   // insert next to the existing rows (default)
+	LoadModeTruncate = "truncate" // empty the table before inserting
+	LoadModeReplace  = "replace"  // load a staging table and swap it in once complete
+)
+
+// The table settings accepted by the API are defined with its wire types
+type (
+	PollingConfig = types.PollingConfig
+	ErrorPolicy   = types.ErrorPolicy
+	RetryPolicy   = types.RetryPolicy
+	SQLHooks      = types.SQLHooks
+)
+
+// Error policy modes
+const (
+	ErrorModeFail = "fail" // a failed batch fails the whole table (default)
+	ErrorModeDLQ  = "dlq"  // bad rows are isolated and written to a dead-letter queue
+)
+
+// Dead-letter queue targets
+const (
+	DLQTargetFile       = "file"       // NDJSON file per table under DLQPath
+	DLQTargetClickHouse = "clickhouse" // _chug_dlq table in ClickHouse
+)
+
 type ResolvedTableConfig struct {
-	Name      string
-	Limit     int
-	BatchSize int
-	Polling   PollingConfig
+	Name        string
+	Limit       int
+	BatchSize   int
+	ExactCount  bool
+	Priority    int
+	LoadMode    string
+	Polling     PollingConfig
+	ErrorPolicy ErrorPolicy
+	Retry       RetryPolicy
+	DependsOn   []string
+	PreSQL      SQLHooks
+	PostSQL     SQLHooks
 }
 
 func Load(path string) (*Config, error) {
@@ -52,9 +316,84 @@ func Load(path string) (*Config, error) {
 		return nil, errors.New("failed to parse config file: " + err.Error())
 	}
 
+	if err := config.ResolveConnections(); err != nil {
+		return nil, err
+	}
+	if err := ValidateDependencies(config.Tables); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
+// ResolveConnections validates the connection profiles and replaces pg_url and
+// ch_url with the URLs of the profiles named by pg_connection and ch_connection
+func (c *Config) ResolveConnections() error {
+	if err := c.loadConnectionSecrets(); err != nil {
+		return err
+	}
+
+	for name, profile := range c.Connections {
+		if profile.Type != ConnectionPostgres && profile.Type != ConnectionClickHouse {
+			return fmt.Errorf("connection %q: unknown type %q (want postgres or clickhouse)", name, profile.Type)
+		}
+		if profile.URL == "" {
+			return fmt.Errorf("connection %q: url, url_env or url_file is required", name)
+		}
+		if err := profile.validate(); err != nil {
+			return fmt.Errorf("connection %q: %w", name, err)
+		}
+	}
+
+	if c.PostgresConnection != "" {
+		profile, err := c.Profile(c.PostgresConnection, ConnectionPostgres)
+		if err != nil {
+			return err
+		}
+		c.PostgresURL = profile.URL
+	}
+
+	if c.ClickHouseConnection != "" {
+		profile, err := c.Profile(c.ClickHouseConnection, ConnectionClickHouse)
+		if err != nil {
+			return err
+		}
+		c.ClickHouseURL = profile.URL
+	}
+
+	return nil
+}
+
+func (p ConnectionProfile) validate() error {
+	switch p.Compression {
+	case "", CompressionNone, CompressionLZ4, CompressionZSTD:
+	default:
+		return fmt.Errorf("unknown compression %q (want none, lz4 or zstd)", p.Compression)
+	}
+	if p.Type == ConnectionPostgres && (p.Compression != "" || len(p.Settings) > 0) {
+		return errors.New("compression and settings are only supported for clickhouse")
+	}
+	if p.TLS != nil && (p.TLS.CertFile == "") != (p.TLS.KeyFile == "") {
+		return errors.New("tls cert_file and key_file must be set together")
+	}
+	if p.Timeouts.DialSecs < 0 || p.Timeouts.StatementSecs < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	return nil
+}
+
+// Profile returns the connection profile called name, which must be of the given type
+func (c *Config) Profile(name, kind string) (ConnectionProfile, error) {
+	profile, ok := c.Connections[name]
+	if !ok {
+		return ConnectionProfile{}, fmt.Errorf("connection %q not found", name)
+	}
+	if profile.Type != kind {
+		return ConnectionProfile{}, fmt.Errorf("connection %q is %s, expected %s", name, profile.Type, kind)
+	}
+	return profile, nil
+}
+
 func (c *Config) GetEffectiveTableConfigs() []TableConfig {
 	if len(c.Tables) > 0 {
 		return c.Tables
@@ -71,7 +410,15 @@ func (c *Config) GetEffectiveTableConfigs() []TableConfig {
 
 func (c *Config) ResolveTableConfig(tc TableConfig) ResolvedTableConfig {
 	resolved := ResolvedTableConfig{
-		Name: tc.Name,
+		Name:      tc.Name,
+		Priority:  tc.Priority,
+		DependsOn: tc.DependsOn,
+	}
+	if tc.PreSQL != nil {
+		resolved.PreSQL = *tc.PreSQL
+	}
+	if tc.PostSQL != nil {
+		resolved.PostSQL = *tc.PostSQL
 	}
 
 	if tc.Limit != nil {
@@ -90,11 +437,53 @@ func (c *Config) ResolveTableConfig(tc TableConfig) ResolvedTableConfig {
 		resolved.BatchSize = 500
 	}
 
+	if tc.ExactCount != nil {
+		resolved.ExactCount = *tc.ExactCount
+	} else if c.ExactCount != nil {
+		resolved.ExactCount = *c.ExactCount
+	}
+
+	if tc.LoadMode != "" {
+		resolved.LoadMode = tc.LoadMode
+	} else if c.LoadMode != "" {
+		resolved.LoadMode = c.LoadMode
+	} else {
+		resolved.LoadMode = LoadModeAppend
+	}
+
 	if tc.Polling != nil {
 		resolved.Polling = *tc.Polling
 	} else {
 		resolved.Polling = c.Polling
 	}
 
+	if tc.ErrorPolicy != nil {
+		resolved.ErrorPolicy = *tc.ErrorPolicy
+	} else {
+		resolved.ErrorPolicy = c.ErrorPolicy
+	}
+	resolved.ErrorPolicy = errorPolicyWithDefaults(resolved.ErrorPolicy)
+
+	if tc.Retry != nil {
+		resolved.Retry = *tc.Retry
+	} else {
+		resolved.Retry = c.Retry
+	}
+
 	return resolved
 }
+
+func errorPolicyWithDefaults(p ErrorPolicy) ErrorPolicy {
+	if p.Mode == "" {
+		p.Mode = ErrorModeFail
+	}
+	if p.Mode == ErrorModeDLQ {
+		if p.DLQ == "" {
+			p.DLQ = DLQTargetFile
+		}
+		if p.DLQ == DLQTargetFile && p.DLQPath == "" {
+			p.DLQPath = "dlq"
+		}
+	}
+	return p
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateDependencies checks that the depends_on of every table names other
+// tables of tables and that the dependencies have no cycle
+func ValidateDependencies(tables []TableConfig) error {
+	deps := make(map[string][]string, len(tables))
+	for _, tc := range tables {
+		deps[tc.Name] = tc.DependsOn
+	}
+	for _, tc := range tables {
+		for _, dep := range tc.DependsOn {
+			if _, ok := deps[dep]; !ok {
+				return fmt.Errorf("table %s depends on %s, which is not loaded with it", tc.Name, dep)
+			}
+		}
+	}
+
+	// Depth-first search, a table met again while still on the path closes a cycle
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	state := make(map[string]int, len(tables))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case onPath:
+			start := 0
+			for path[start] != name {
+				start++
+			}
+			cycle := append(path[start:], name)
+			return fmt.Errorf("dependency cycle: %s", strings.Join(cycle, " -> "))
+		case done:
+			return nil
+		}
+		state[name] = onPath
+		path = append(path, name)
+		for _, dep := range deps[name] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+	for _, tc := range tables {
+		if err := visit(tc.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	table := func(name string, deps ...string) TableConfig {
+		return TableConfig{Name: name, DependsOn: deps}
+	}
+	tests := []struct {
+		name    string
+		tables  []TableConfig
+		wantErr string // "" for valid
+	}{
+		{name: "no tables"},
+		{name: "no dependencies", tables: []TableConfig{table("a"), table("b")}},
+		{
+			name:   "diamond",
+			tables: []TableConfig{table("d", "b", "c"), table("b", "a"), table("c", "a"), table("a")},
+		},
+		{
+			name:    "unknown dependency",
+			tables:  []TableConfig{table("orders", "users")},
+			wantErr: "table orders depends on users, which is not loaded with it",
+		},
+		{
+			name:    "self dependency",
+			tables:  []TableConfig{table("a", "a")},
+			wantErr: "dependency cycle: a -> a",
+		},
+		{
+			name:    "cycle",
+			tables:  []TableConfig{table("a", "b"), table("b", "c"), table("c", "a")},
+			wantErr: "dependency cycle: a -> b -> c -> a",
+		},
+		{
+			name:    "cycle reached through an acyclic table",
+			tables:  []TableConfig{table("root", "x"), table("x", "y"), table("y", "x")},
+			wantErr: "dependency cycle: x -> y -> x",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDependencies(tt.tables)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidateDependencies: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidateDependencies = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
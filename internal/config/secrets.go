@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ConnectionEnvPrefix defines or overrides connection profiles from the
+// environment: CHUG_CONNECTION_<NAME>=<url> or CHUG_CONNECTION_<NAME>_FILE=<path>.
+// Names are lowercased, so CHUG_CONNECTION_WAREHOUSE sets the URL of profile warehouse.
+const ConnectionEnvPrefix = "CHUG_CONNECTION_"
+
+var passwordParam = regexp.MustCompile(`(?i)(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// loadConnectionSecrets fills in profile URLs and passwords kept outside the
+// config file: url_env, url_file, CHUG_CONNECTION_* variables and password_file,
+// applied in that order
+func (c *Config) loadConnectionSecrets() error {
+	for name, profile := range c.Connections {
+		switch {
+		case profile.URLEnv != "":
+			profile.URL = os.Getenv(profile.URLEnv)
+			if profile.URL == "" {
+				return fmt.Errorf("connection %q: environment variable %s is not set", name, profile.URLEnv)
+			}
+		case profile.URLFile != "":
+			secret, err := readSecret(profile.URLFile)
+			if err != nil {
+				return fmt.Errorf("connection %q: %w", name, err)
+			}
+			profile.URL = secret
+		}
+		c.Connections[name] = profile
+	}
+
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		name, ok := strings.CutPrefix(key, ConnectionEnvPrefix)
+		if !ok || name == "" {
+			continue
+		}
+		if base, isFile := strings.CutSuffix(name, "_FILE"); isFile {
+			secret, err := readSecret(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			name, value = base, secret
+		}
+		name = strings.ToLower(name)
+
+		if c.Connections == nil {
+			c.Connections = make(map[string]ConnectionProfile)
+		}
+		profile := c.Connections[name]
+		profile.URL = value
+		if profile.Type == "" {
+			profile.Type = connectionType(value)
+		}
+		c.Connections[name] = profile
+	}
+
+	for name, profile := range c.Connections {
+		if profile.PasswordFile == "" {
+			continue
+		}
+		password, err := readSecret(profile.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("connection %q: %w", name, err)
+		}
+		dsn, err := withPassword(profile.URL, password)
+		if err != nil {
+			return fmt.Errorf("connection %q: %w", name, err)
+		}
+		profile.URL = dsn
+		c.Connections[name] = profile
+	}
+	return nil
+}
+
+// readSecret reads a secret from a file such as a mounted Docker or Kubernetes
+// secret, dropping the trailing newline
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// connectionType guesses the profile type of a DSN from its scheme
+func connectionType(dsn string) string {
+	scheme, _, ok := strings.Cut(dsn, "://")
+	if !ok {
+		// key=value DSNs are only supported by PostgreSQL
+		return ConnectionPostgres
+	}
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return ConnectionPostgres
+	case "clickhouse", "tcp", "http", "https":
+		return ConnectionClickHouse
+	}
+	return ""
+}
+
+// withPassword sets the password of a URL or key=value DSN
+func withPassword(dsn, password string) (string, error) {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", fmt.Errorf("invalid url: %w", err)
+		}
+		username := ""
+		if u.User != nil {
+			username = u.User.Username()
+		}
+		u.User = url.UserPassword(username, password)
+		return u.String(), nil
+	}
+
+	quoted := "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password) + "'"
+	if passwordParam.MatchString(dsn) {
+		return passwordParam.ReplaceAllLiteralString(dsn, "password="+quoted), nil
+	}
+	return strings.TrimSpace(dsn + " password=" + quoted), nil
+}
@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pixperk/chug/api/types"
+)
+
+type BreakerState = types.BreakerState
+
+const (
+	BreakerClosed   = types.BreakerClosed   // target healthy, calls flow
+	BreakerOpen     = types.BreakerOpen     // target down, callers wait
+	BreakerHalfOpen = types.BreakerHalfOpen // probing the target
+)
+
+// BreakerConfig controls when a breaker opens and how it probes for recovery
+type BreakerConfig struct {
+	FailureThreshold int           // consecutive failures before opening
+	MinBackoff       time.Duration // first reconnect attempt delay
+	MaxBackoff       time.Duration // cap for reconnect attempt delay
+	ProbeTimeout     time.Duration
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	FailureThreshold: 3,
+	MinBackoff:       1 * time.Second,
+	MaxBackoff:       30 * time.Second,
+	ProbeTimeout:     5 * time.Second,
+}
+
+// BreakerStatus is a point-in-time view of a breaker for health reporting
+type BreakerStatus = types.BreakerStatus
+
+// CircuitBreaker tracks the health of a database. Once it opens, callers
+// blocked in Wait are paused until a background probe reconnects.
+type CircuitBreaker struct {
+	name   string
+	config BreakerConfig
+	probe  func(ctx context.Context) error
+
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	lastErr   error
+	since     time.Time
+	recovered chan struct{} // closed when the breaker closes again
+	onChange  func(BreakerStatus)
+}
+
+func NewCircuitBreaker(name string, config BreakerConfig, probe func(ctx context.Context) error) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:   name,
+		config: config,
+		probe:  probe,
+		state:  BreakerClosed,
+		since:  time.Now(),
+	}
+}
+
+// OnStateChange registers a callback invoked when the breaker opens or closes
+func (b *CircuitBreaker) OnStateChange(fn func(BreakerStatus)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onChange = fn
+}
+
+// RecordSuccess reports a call that reached the database
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	b.failures = 0
+	if b.state == BreakerClosed {
+		b.mu.Unlock()
+		return
+	}
+	b.lastErr = nil
+	close(b.recovered)
+	status, notify := b.setStateLocked(BreakerClosed)
+	b.mu.Unlock()
+
+	notify(status)
+}
+
+// RecordFailure reports a call that failed because the database was unreachable
+func (b *CircuitBreaker) RecordFailure(err error) {
+	b.mu.Lock()
+	b.failures++
+	b.lastErr = err
+	if b.state != BreakerClosed || b.failures < b.config.FailureThreshold {
+		b.mu.Unlock()
+		return
+	}
+	b.recovered = make(chan struct{})
+	status, notify := b.setStateLocked(BreakerOpen)
+	b.mu.Unlock()
+
+	notify(status)
+	go b.reconnect()
+}
+
+// Wait blocks while the breaker is open and returns once the target recovers
+func (b *CircuitBreaker) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	if b.state == BreakerClosed {
+		b.mu.Unlock()
+		return nil
+	}
+	recovered := b.recovered
+	b.mu.Unlock()
+
+	select {
+	case <-recovered:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *CircuitBreaker) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != BreakerClosed
+}
+
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.statusLocked()
+}
+
+func (b *CircuitBreaker) statusLocked() BreakerStatus {
+	status := BreakerStatus{
+		Name:     b.name,
+		State:    b.state,
+		Failures: b.failures,
+		Since:    b.since,
+	}
+	if b.lastErr != nil {
+		status.LastError = b.lastErr.Error()
+	}
+	return status
+}
+
+func (b *CircuitBreaker) setStateLocked(state BreakerState) (BreakerStatus, func(BreakerStatus)) {
+	b.state = state
+	b.since = time.Now()
+
+	notify := b.onChange
+	if notify == nil {
+		notify = func(BreakerStatus) {}
+	}
+	return b.statusLocked(), notify
+}
+
+// reconnect probes the target with exponential backoff until it answers
+func (b *CircuitBreaker) reconnect() {
+	backoff := b.config.MinBackoff
+	for {
+		time.Sleep(backoff)
+
+		b.mu.Lock()
+		if b.state == BreakerClosed {
+			// A caller got through while we were sleeping
+			b.mu.Unlock()
+			return
+		}
+		// Probe cycles are not reported, only the open and close transitions
+		b.setStateLocked(BreakerHalfOpen)
+		b.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.config.ProbeTimeout)
+		err := b.probe(ctx)
+		cancel()
+
+		if err == nil {
+			b.RecordSuccess()
+			return
+		}
+
+		b.mu.Lock()
+		if b.state == BreakerClosed {
+			b.mu.Unlock()
+			return
+		}
+		b.lastErr = err
+		b.setStateLocked(BreakerOpen)
+		b.mu.Unlock()
+
+		backoff = min(backoff*2, b.config.MaxBackoff)
+	}
+}
@@ -3,13 +3,16 @@ package db
 import (
 	"crypto/tls"
 	"database/sql"
+	"net"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/pixperk/chug/internal/config"
 )
 
-func ConnectClickHouse(chURL string) (*sql.DB, error) {
+func ConnectClickHouse(chURL string, profile config.ConnectionProfile) (*sql.DB, error) {
 
 	var addr string
 	var username, password, database string
@@ -34,6 +37,14 @@ func ConnectClickHouse(chURL string) (*sql.DB, error) {
 		addr = chURL
 	}
 
+	settings := clickhouse.Settings{}
+	for k, v := range profile.Settings {
+		settings[k] = v
+	}
+	if _, ok := settings["max_execution_time"]; !ok && profile.Timeouts.StatementSecs > 0 {
+		settings["max_execution_time"] = profile.Timeouts.StatementSecs
+	}
+
 	opts := &clickhouse.Options{
 		Addr: []string{addr},
 		Auth: clickhouse.Auth{
@@ -41,15 +52,36 @@ func ConnectClickHouse(chURL string) (*sql.DB, error) {
 			Username: ifEmpty(username, "default"),
 			Password: password,
 		},
-		Settings: clickhouse.Settings{
-			"send_logs_level": "trace",
-		},
+		Settings:    settings,
+		DialTimeout: time.Duration(profile.Timeouts.DialSecs) * time.Second,
+	}
+
+	switch profile.Compression {
+	case config.CompressionLZ4:
+		opts.Compression = &clickhouse.Compression{Method: clickhouse.CompressionLZ4}
+	case config.CompressionZSTD:
+		opts.Compression = &clickhouse.Compression{Method: clickhouse.CompressionZSTD}
+	}
+
+	if profile.TLS != nil {
+		useTLS = profile.TLS.IsEnabled()
 	}
 
 	if useTLS {
-		opts.TLS = &tls.Config{
-			InsecureSkipVerify: false,
+		var tlsConfig *tls.Config
+		if profile.TLS != nil {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			tlsConfig, err = buildTLSConfig(profile.TLS, host)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			tlsConfig = &tls.Config{}
 		}
+		opts.TLS = tlsConfig
 	}
 
 	return clickhouse.OpenDB(opts), nil
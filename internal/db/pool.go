@@ -3,42 +3,417 @@ package db
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/internal/config"
 )
 
-var (
-	pgPool *pgxpool.Pool
-	chPool *sql.DB
-	pgMux  sync.Mutex
-	chMux  sync.Mutex
-)
+// DefaultIdleTimeout is how long an unreferenced pool stays open before eviction
+const DefaultIdleTimeout = 10 * time.Minute
 
-func GetPostgresPool(pgURL string) (*pgxpool.Pool, error) {
-	pgMux.Lock()
-	defer pgMux.Unlock()
+var defaultPoolConfig = config.PoolConfig{
+	MaxConns:            10,
+	MinConns:            2,
+	MaxIdleConns:        5,
+	MaxConnLifetimeSecs: 3600,
+	MaxConnIdleSecs:     1800,
+}
+
+var defaultTimeouts = config.TimeoutConfig{
+	DialSecs: 10,
+}
+
+type pgEntry struct {
+	pool     *pgxpool.Pool
+	refs     int
+	pinned   bool
+	lastUsed time.Time
+}
+
+type chEntry struct {
+	conn     *sql.DB
+	refs     int
+	pinned   bool
+	lastUsed time.Time
+}
+
+// Registry holds one connection pool per DSN. Pools are ref-counted and
+// closed once they have been unreferenced for longer than the idle timeout.
+type Registry struct {
+	mu          sync.Mutex
+	pg          map[string]*pgEntry
+	ch          map[string]*chEntry
+	pgInit      map[string]*sync.Mutex
+	chInit      map[string]*sync.Mutex
+	profiles    map[string]config.ConnectionProfile // DSN -> settings from connection profiles
+	breakers    map[string]*CircuitBreaker          // kind + DSN -> breaker
+	onChange    func(BreakerStatus)
+	idleTimeout time.Duration
+	evictOnce   sync.Once
+}
+
+func NewRegistry(idleTimeout time.Duration) *Registry {
+	return &Registry{
+		pg:          make(map[string]*pgEntry),
+		ch:          make(map[string]*chEntry),
+		pgInit:      make(map[string]*sync.Mutex),
+		chInit:      make(map[string]*sync.Mutex),
+		profiles:    make(map[string]config.ConnectionProfile),
+		breakers:    make(map[string]*CircuitBreaker),
+		idleTimeout: idleTimeout,
+	}
+}
+
+// Pools is the process-wide connection registry
+var Pools = NewRegistry(DefaultIdleTimeout)
+
+// RegisterProfiles applies the pool, timeout and TLS settings of each
+// connection profile to pools opened for its DSN
+func (r *Registry) RegisterProfiles(profiles map[string]config.ConnectionProfile) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, profile := range profiles {
+		r.profiles[profile.URL] = profile
+	}
+}
+
+// profile returns the settings for dsn with defaults filled in
+func (r *Registry) profile(dsn string) config.ConnectionProfile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	profile := r.profiles[dsn]
+	profile.URL = dsn
+	if profile.Timeouts.DialSecs <= 0 {
+		profile.Timeouts.DialSecs = defaultTimeouts.DialSecs
+	}
+
+	pc := &profile.Pool
+	if pc.MaxConns <= 0 {
+		pc.MaxConns = defaultPoolConfig.MaxConns
+	}
+	if pc.MinConns <= 0 {
+		pc.MinConns = min(defaultPoolConfig.MinConns, pc.MaxConns)
+	}
+	if pc.MaxIdleConns <= 0 {
+		pc.MaxIdleConns = min(defaultPoolConfig.MaxIdleConns, pc.MaxConns)
+	}
+	if pc.MaxConnLifetimeSecs <= 0 {
+		pc.MaxConnLifetimeSecs = defaultPoolConfig.MaxConnLifetimeSecs
+	}
+	if pc.MaxConnIdleSecs <= 0 {
+		pc.MaxConnIdleSecs = defaultPoolConfig.MaxConnIdleSecs
+	}
+	return profile
+}
+
+// initLock serialises pool creation per DSN so slow connects to one database
+// do not block callers of another
+func initLock(locks map[string]*sync.Mutex, dsn string) *sync.Mutex {
+	l, ok := locks[dsn]
+	if !ok {
+		l = &sync.Mutex{}
+		locks[dsn] = l
+	}
+	return l
+}
+
+// AcquirePostgres returns the pool for dsn, connecting if needed. Call release
+// once the pool is no longer used.
+func (r *Registry) AcquirePostgres(dsn string) (pool *pgxpool.Pool, release func(), err error) {
+	return r.acquirePostgres(context.Background(), dsn)
+}
+
+// acquirePostgres is AcquirePostgres giving up on connecting once ctx ends
+func (r *Registry) acquirePostgres(ctx context.Context, dsn string) (pool *pgxpool.Pool, release func(), err error) {
+	r.startEviction()
+
+	r.mu.Lock()
+	lock := initLock(r.pgInit, dsn)
+	r.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	r.mu.Lock()
+	entry, ok := r.pg[dsn]
+	if ok {
+		entry.refs++
+		r.mu.Unlock()
+		return entry.pool, r.releaser(dsn, false), nil
+	}
+	r.mu.Unlock()
+
+	pool, err = newPostgresPool(ctx, dsn, r.profile(dsn))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.mu.Lock()
+	r.pg[dsn] = &pgEntry{pool: pool, refs: 1, lastUsed: time.Now()}
+	r.mu.Unlock()
+
+	return pool, r.releaser(dsn, false), nil
+}
+
+// AcquireClickHouse returns the pool for dsn, connecting if needed. Call
+// release once the pool is no longer used.
+func (r *Registry) AcquireClickHouse(dsn string) (conn *sql.DB, release func(), err error) {
+	return r.acquireClickHouse(context.Background(), dsn)
+}
+
+// acquireClickHouse is AcquireClickHouse giving up on connecting once ctx ends
+func (r *Registry) acquireClickHouse(ctx context.Context, dsn string) (conn *sql.DB, release func(), err error) {
+	r.startEviction()
+
+	r.mu.Lock()
+	lock := initLock(r.chInit, dsn)
+	r.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	r.mu.Lock()
+	entry, ok := r.ch[dsn]
+	if ok {
+		entry.refs++
+		r.mu.Unlock()
+		return entry.conn, r.releaser(dsn, true), nil
+	}
+	r.mu.Unlock()
+
+	conn, err = newClickHousePool(ctx, dsn, r.profile(dsn))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.mu.Lock()
+	r.ch[dsn] = &chEntry{conn: conn, refs: 1, lastUsed: time.Now()}
+	r.mu.Unlock()
+
+	return conn, r.releaser(dsn, true), nil
+}
+
+func (r *Registry) releaser(dsn string, clickhouse bool) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if clickhouse {
+				if e, ok := r.ch[dsn]; ok {
+					e.refs--
+					e.lastUsed = time.Now()
+				}
+			} else if e, ok := r.pg[dsn]; ok {
+				e.refs--
+				e.lastUsed = time.Now()
+			}
+		})
+	}
+}
+
+// pin keeps a pool open for the lifetime of the process
+func (r *Registry) pin(dsn string, clickhouse bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if clickhouse {
+		if e, ok := r.ch[dsn]; ok {
+			e.pinned = true
+		}
+	} else if e, ok := r.pg[dsn]; ok {
+		e.pinned = true
+	}
+}
+
+func (r *Registry) startEviction() {
+	r.evictOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(time.Minute)
+			defer ticker.Stop()
+			for range ticker.C {
+				r.evictIdle()
+			}
+		}()
+	})
+}
+
+// evictIdle closes pools nobody has referenced for longer than the idle timeout
+func (r *Registry) evictIdle() {
+	cutoff := time.Now().Add(-r.idleTimeout)
+
+	r.mu.Lock()
+	var pgClose []*pgxpool.Pool
+	var chClose []*sql.DB
+	for dsn, e := range r.pg {
+		if !e.pinned && e.refs <= 0 && e.lastUsed.Before(cutoff) {
+			pgClose = append(pgClose, e.pool)
+			delete(r.pg, dsn)
+		}
+	}
+	for dsn, e := range r.ch {
+		if !e.pinned && e.refs <= 0 && e.lastUsed.Before(cutoff) {
+			chClose = append(chClose, e.conn)
+			delete(r.ch, dsn)
+		}
+	}
+	r.mu.Unlock()
 
-	if pgPool != nil {
-		return pgPool, nil
+	for _, pool := range pgClose {
+		pool.Close()
+	}
+	for _, conn := range chClose {
+		conn.Close()
 	}
+}
+
+// PostgresBreaker returns the circuit breaker guarding the PostgreSQL pool for
+// dsn. Its probe opens the pool when there is none, because the first connect
+// failed or the pool was evicted while idle, within the probe's timeout.
+func (r *Registry) PostgresBreaker(dsn string) *CircuitBreaker {
+	return r.breaker(config.ConnectionPostgres, dsn, func(ctx context.Context) error {
+		pool, release, err := r.acquirePostgres(ctx, dsn)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return pool.Ping(ctx)
+	})
+}
+
+// ClickHouseBreaker returns the circuit breaker guarding the ClickHouse pool
+// for dsn, opening the pool in its probe like PostgresBreaker
+func (r *Registry) ClickHouseBreaker(dsn string) *CircuitBreaker {
+	return r.breaker(config.ConnectionClickHouse, dsn, func(ctx context.Context) error {
+		conn, release, err := r.acquireClickHouse(ctx, dsn)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return conn.PingContext(ctx)
+	})
+}
+
+func (r *Registry) breaker(kind, dsn string, probe func(ctx context.Context) error) *CircuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := kind + "|" + dsn
+	b, ok := r.breakers[key]
+	if !ok {
+		b = NewCircuitBreaker(fmt.Sprintf("%s (%s)", kind, RedactDSN(dsn)), DefaultBreakerConfig, probe)
+		if r.onChange != nil {
+			b.OnStateChange(r.onChange)
+		}
+		r.breakers[key] = b
+	}
+	return b
+}
+
+// BreakerStatuses reports the state of every circuit breaker in the registry
+func (r *Registry) BreakerStatuses() []BreakerStatus {
+	r.mu.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		breakers = append(breakers, b)
+	}
+	r.mu.Unlock()
+
+	statuses := make([]BreakerStatus, 0, len(breakers))
+	for _, b := range breakers {
+		statuses = append(statuses, b.Status())
+	}
+	return statuses
+}
+
+// OnBreakerStateChange registers fn on every current and future circuit breaker
+func (r *Registry) OnBreakerStateChange(fn func(BreakerStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onChange = fn
+	for _, b := range r.breakers {
+		b.OnStateChange(fn)
+	}
+}
+
+// PoolStat is a snapshot of one pool. Exactly one of Postgres and ClickHouse is set.
+type PoolStat struct {
+	Name       string // redacted DSN
+	Postgres   *pgxpool.Stat
+	ClickHouse *sql.DBStats
+}
+
+// PoolStats reports the usage of every open pool
+func (r *Registry) PoolStats() []PoolStat {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	stats := make([]PoolStat, 0, len(r.pg)+len(r.ch))
+	for dsn, e := range r.pg {
+		stats = append(stats, PoolStat{Name: RedactDSN(dsn), Postgres: e.pool.Stat()})
+	}
+	for dsn, e := range r.ch {
+		dbStats := e.conn.Stats()
+		stats = append(stats, PoolStat{Name: RedactDSN(dsn), ClickHouse: &dbStats})
+	}
+	return stats
+}
+
+// CloseAll closes every pool regardless of references
+func (r *Registry) CloseAll() {
+	r.mu.Lock()
+	pg, ch := r.pg, r.ch
+	r.pg = make(map[string]*pgEntry)
+	r.ch = make(map[string]*chEntry)
+	r.mu.Unlock()
+
+	for _, e := range pg {
+		e.pool.Close()
+	}
+	for _, e := range ch {
+		e.conn.Close()
+	}
+}
+
+func newPostgresPool(ctx context.Context, pgURL string, profile config.ConnectionProfile) (*pgxpool.Pool, error) {
+	dialTimeout := time.Duration(profile.Timeouts.DialSecs) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
 	defer cancel()
 
-	config, err := pgxpool.ParseConfig(pgURL)
+	pgConfig, err := pgxpool.ParseConfig(pgURL)
 	if err != nil {
 		return nil, err
 	}
 
-	config.MaxConns = 10
-	config.MinConns = 2
-	config.MaxConnLifetime = 1 * time.Hour
-	config.MaxConnIdleTime = 30 * time.Minute
-	config.HealthCheckPeriod = 1 * time.Minute
+	pc := profile.Pool
+	pgConfig.MaxConns = int32(pc.MaxConns)
+	pgConfig.MinConns = int32(pc.MinConns)
+	pgConfig.MaxConnLifetime = time.Duration(pc.MaxConnLifetimeSecs) * time.Second
+	pgConfig.MaxConnIdleTime = time.Duration(pc.MaxConnIdleSecs) * time.Second
+	pgConfig.HealthCheckPeriod = 1 * time.Minute
+
+	connConfig := pgConfig.ConnConfig
+	connConfig.ConnectTimeout = dialTimeout
+	if profile.Timeouts.StatementSecs > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.Itoa(profile.Timeouts.StatementSecs * 1000)
+	}
+	if profile.TLS != nil {
+		// An explicit tls block wins over sslmode, including its plaintext fallbacks
+		connConfig.Fallbacks = nil
+		connConfig.TLSConfig = nil
+		if profile.TLS.IsEnabled() {
+			connConfig.TLSConfig, err = buildTLSConfig(profile.TLS, connConfig.Host)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	pool, err := pgxpool.NewWithConfig(ctx, config)
+	pool, err := pgxpool.NewWithConfig(ctx, pgConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -48,60 +423,73 @@ func GetPostgresPool(pgURL string) (*pgxpool.Pool, error) {
 		return nil, err
 	}
 
-	pgPool = pool
-	return pgPool, nil
+	return pool, nil
 }
 
-func GetClickHousePool(chURL string) (*sql.DB, error) {
-	chMux.Lock()
-	defer chMux.Unlock()
-
-	if chPool != nil {
-		return chPool, nil
-	}
-
-	conn, err := ConnectClickHouse(chURL)
+func newClickHousePool(ctx context.Context, chURL string, profile config.ConnectionProfile) (*sql.DB, error) {
+	conn, err := ConnectClickHouse(chURL, profile)
 	if err != nil {
 		return nil, err
 	}
 
-	conn.SetMaxOpenConns(10)
-	conn.SetMaxIdleConns(5)
-	conn.SetConnMaxLifetime(1 * time.Hour)
-	conn.SetConnMaxIdleTime(30 * time.Minute)
+	pc := profile.Pool
+	conn.SetMaxOpenConns(pc.MaxConns)
+	conn.SetMaxIdleConns(pc.MaxIdleConns)
+	conn.SetConnMaxLifetime(time.Duration(pc.MaxConnLifetimeSecs) * time.Second)
+	conn.SetConnMaxIdleTime(time.Duration(pc.MaxConnIdleSecs) * time.Second)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(profile.Timeouts.DialSecs)*time.Second)
 	defer cancel()
 	if err := conn.PingContext(ctx); err != nil {
 		conn.Close()
 		return nil, err
 	}
 
-	chPool = conn
-	return chPool, nil
+	return conn, nil
 }
 
-func ClosePostgresPool() {
-	pgMux.Lock()
-	defer pgMux.Unlock()
+// GetPostgresPool returns the pool for pgURL and keeps it open for the
+// lifetime of the process. Short-lived users should call Pools.AcquirePostgres.
+func GetPostgresPool(pgURL string) (*pgxpool.Pool, error) {
+	pool, _, err := Pools.AcquirePostgres(pgURL)
+	if err != nil {
+		return nil, err
+	}
+	Pools.pin(pgURL, false)
+	return pool, nil
+}
 
-	if pgPool != nil {
-		pgPool.Close()
-		pgPool = nil
+// GetClickHousePool returns the pool for chURL and keeps it open for the
+// lifetime of the process. Short-lived users should call Pools.AcquireClickHouse.
+func GetClickHousePool(chURL string) (*sql.DB, error) {
+	conn, _, err := Pools.AcquireClickHouse(chURL)
+	if err != nil {
+		return nil, err
 	}
+	Pools.pin(chURL, true)
+	return conn, nil
 }
 
-func CloseClickHousePool() {
-	chMux.Lock()
-	defer chMux.Unlock()
+// PostgresBreaker returns the circuit breaker for the PostgreSQL database at pgURL
+func PostgresBreaker(pgURL string) *CircuitBreaker {
+	return Pools.PostgresBreaker(pgURL)
+}
 
-	if chPool != nil {
-		chPool.Close()
-		chPool = nil
-	}
+// ClickHouseBreaker returns the circuit breaker for the ClickHouse database at chURL
+func ClickHouseBreaker(chURL string) *CircuitBreaker {
+	return Pools.ClickHouseBreaker(chURL)
+}
+
+// BreakerStatuses reports the state of every database circuit breaker
+func BreakerStatuses() []BreakerStatus {
+	return Pools.BreakerStatuses()
+}
+
+// OnBreakerStateChange registers fn on every database circuit breaker
+func OnBreakerStateChange(fn func(BreakerStatus)) {
+	Pools.OnBreakerStateChange(fn)
 }
 
 func CloseAllPools() {
-	ClosePostgresPool()
-	CloseClickHousePool()
+	Pools.CloseAll()
 }
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var passwordParam = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+// RedactDSN hides the password in a connection string so it can be logged.
+// Handles both URL DSNs and PostgreSQL key=value DSNs.
+func RedactDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "<invalid dsn>"
+		}
+		q := u.Query()
+		for key := range q {
+			if strings.EqualFold(key, "password") {
+				q.Set(key, "xxxxx")
+			}
+		}
+		u.RawQuery = q.Encode()
+		return u.Redacted()
+	}
+	return passwordParam.ReplaceAllString(dsn, "${1}xxxxx")
+}
@@ -0,0 +1,179 @@
+package etl
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/column"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pixperk/chug/internal/db"
+)
+
+// ErrorClass tells Retry whether an error is worth retrying
+type ErrorClass int
+
+const (
+	// ErrorFatal errors will fail the same way on every attempt (syntax, types, auth)
+	ErrorFatal ErrorClass = iota
+	// ErrorRetryable errors are transient (network, timeouts, server restarts)
+	ErrorRetryable
+	// ErrorThrottled errors are transient and the server asked us to slow down
+	ErrorThrottled
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrorRetryable:
+		return "retryable"
+	case ErrorThrottled:
+		return "throttled"
+	default:
+		return "fatal"
+	}
+}
+
+// ClickHouse exception codes that are worth retrying.
+// See https://github.com/ClickHouse/ClickHouse/blob/master/src/Common/ErrorCodes.cpp
+var retryableClickHouseCodes = map[int32]ErrorClass{
+	3:   ErrorRetryable, // UNEXPECTED_END_OF_FILE
+	159: ErrorRetryable, // TIMEOUT_EXCEEDED
+	160: ErrorThrottled, // TOO_SLOW
+	202: ErrorThrottled, // TOO_MANY_SIMULTANEOUS_QUERIES
+	203: ErrorRetryable, // NO_FREE_CONNECTION
+	209: ErrorRetryable, // SOCKET_TIMEOUT
+	210: ErrorRetryable, // NETWORK_ERROR
+	236: ErrorRetryable, // ABORTED
+	241: ErrorThrottled, // MEMORY_LIMIT_EXCEEDED
+	242: ErrorRetryable, // TABLE_IS_READ_ONLY
+	252: ErrorThrottled, // TOO_MANY_PARTS
+	285: ErrorRetryable, // TOO_FEW_LIVE_REPLICAS
+	319: ErrorRetryable, // UNKNOWN_STATUS_OF_INSERT
+	425: ErrorRetryable, // SYSTEM_ERROR
+	999: ErrorRetryable, // KEEPER_EXCEPTION
+}
+
+// ClassifyError decides whether an error from PostgreSQL or ClickHouse is
+// transient. Only errors known to be transient are retried: the retryable
+// codes of either database and connection failures. Anything else is fatal,
+// since retrying an error we do not understand only repeats it.
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ErrorFatal
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorFatal
+	}
+
+	// Replaying the rows would dead-letter them again
+	if errors.Is(err, ErrDeadLetterLimit) {
+		return ErrorFatal
+	}
+
+	var chErr *clickhouse.Exception
+	if errors.As(err, &chErr) {
+		if class, ok := retryableClickHouseCodes[chErr.Code]; ok {
+			return class
+		}
+		return ErrorFatal
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return classifySQLState(pgErr.Code)
+	}
+
+	// Client-side conversion errors never succeed on retry
+	var opErr *clickhouse.OpError
+	var convErr *column.ColumnConverterError
+	var colErr *column.Error
+	if errors.As(err, &opErr) || errors.As(err, &convErr) || errors.As(err, &colErr) ||
+		errors.Is(err, clickhouse.ErrBatchInvalid) {
+		return ErrorFatal
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ETIMEDOUT) || errors.Is(err, syscall.EHOSTUNREACH) || errors.Is(err, syscall.ENETUNREACH) ||
+		errors.Is(err, net.ErrClosed) || errors.Is(err, clickhouse.ErrAcquireConnTimeout) {
+		return ErrorRetryable
+	}
+
+	// pgx reports connection failures and timeouts that happened before the
+	// server saw the statement
+	if pgconn.SafeToRetry(err) || pgconn.Timeout(err) {
+		return ErrorRetryable
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrorRetryable
+	}
+
+	return ErrorFatal
+}
+
+// classifySQLState maps a PostgreSQL SQLSTATE to an error class.
+// See https://www.postgresql.org/docs/current/errcodes-appendix.html
+func classifySQLState(code string) ErrorClass {
+	switch code {
+	case "40001", // serialization_failure
+		"40P01", // deadlock_detected
+		"55P03", // lock_not_available
+		"57014", // query_canceled (statement_timeout)
+		"57P01", // admin_shutdown
+		"57P02", // crash_shutdown
+		"57P03": // cannot_connect_now
+		return ErrorRetryable
+	}
+
+	switch {
+	case strings.HasPrefix(code, "08"): // connection_exception
+		return ErrorRetryable
+	case strings.HasPrefix(code, "53"): // insufficient_resources
+		return ErrorThrottled
+	default:
+		return ErrorFatal
+	}
+}
+
+// RecordHealth feeds the outcome of a database call into its circuit breaker.
+// Data and schema errors still count as success: the server answered, the
+// request was bad. Every other error, recognised or not, counts as a failure.
+func RecordHealth(b *db.CircuitBreaker, err error) {
+	switch {
+	case err == nil:
+		b.RecordSuccess()
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// Our own cancellation says nothing about the database
+	case isDataError(err):
+		b.RecordSuccess()
+	default:
+		b.RecordFailure(err)
+	}
+}
+
+// isDataError reports whether err is a fatal error about the rows or the
+// statement rather than the connection: one the database answered with, or a
+// value the driver could not convert
+func isDataError(err error) bool {
+	if ClassifyError(err) != ErrorFatal {
+		return false
+	}
+	if errors.Is(err, ErrDeadLetterLimit) || errors.Is(err, clickhouse.ErrBatchInvalid) {
+		return true
+	}
+	var chErr *clickhouse.Exception
+	var pgErr *pgconn.PgError
+	var opErr *clickhouse.OpError
+	var convErr *column.ColumnConverterError
+	var colErr *column.Error
+	return errors.As(err, &chErr) || errors.As(err, &pgErr) ||
+		errors.As(err, &opErr) || errors.As(err, &convErr) || errors.As(err, &colErr)
+}
@@ -0,0 +1,98 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pixperk/chug/internal/db"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"nil", nil, ErrorFatal},
+		{"unknown", errors.New("something odd"), ErrorFatal},
+		{"cancelled", context.Canceled, ErrorFatal},
+		{"deadline", fmt.Errorf("insert: %w", context.DeadlineExceeded), ErrorFatal},
+		{"dead-letter limit", fmt.Errorf("%w: more than 10 rows", ErrDeadLetterLimit), ErrorFatal},
+		{"connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ErrorRetryable},
+		{"connection reset", fmt.Errorf("write: %w", syscall.ECONNRESET), ErrorRetryable},
+		{"unexpected eof", io.ErrUnexpectedEOF, ErrorRetryable},
+		{"closed connection", net.ErrClosed, ErrorRetryable},
+		{"acquire timeout", clickhouse.ErrAcquireConnTimeout, ErrorRetryable},
+		{"batch invalid", clickhouse.ErrBatchInvalid, ErrorFatal},
+		{"clickhouse too many parts", &clickhouse.Exception{Code: 252}, ErrorThrottled},
+		{"clickhouse network error", &clickhouse.Exception{Code: 210}, ErrorRetryable},
+		{"clickhouse syntax error", &clickhouse.Exception{Code: 62}, ErrorFatal},
+		{"pg serialization failure", &pgconn.PgError{Code: "40001"}, ErrorRetryable},
+		{"pg connection exception", &pgconn.PgError{Code: "08006"}, ErrorRetryable},
+		{"pg out of memory", &pgconn.PgError{Code: "53200"}, ErrorThrottled},
+		{"pg unique violation", &pgconn.PgError{Code: "23505"}, ErrorFatal},
+		{"pg undefined table", fmt.Errorf("query: %w", &pgconn.PgError{Code: "42P01"}), ErrorFatal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyError(tt.err); got != tt.want {
+				t.Errorf("ClassifyError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDataError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unknown", errors.New("something odd"), false},
+		{"connection refused", syscall.ECONNREFUSED, false},
+		{"retryable clickhouse code", &clickhouse.Exception{Code: 210}, false},
+		{"clickhouse syntax error", &clickhouse.Exception{Code: 62}, true},
+		{"pg unique violation", &pgconn.PgError{Code: "23505"}, true},
+		{"batch invalid", clickhouse.ErrBatchInvalid, true},
+		{"dead-letter limit", ErrDeadLetterLimit, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDataError(tt.err); got != tt.want {
+				t.Errorf("isDataError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantOpen bool
+	}{
+		{"success", nil, false},
+		{"data error", &pgconn.PgError{Code: "23505"}, false},
+		{"cancelled", context.Canceled, false},
+		{"unknown error", errors.New("something odd"), true},
+		{"connection refused", syscall.ECONNREFUSED, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := db.BreakerConfig{FailureThreshold: 1, MinBackoff: time.Hour, MaxBackoff: time.Hour, ProbeTimeout: time.Second}
+			b := db.NewCircuitBreaker("test", config, func(context.Context) error { return nil })
+			RecordHealth(b, tt.err)
+			if got := b.IsOpen(); got != tt.wantOpen {
+				t.Errorf("breaker open = %v, want %v", got, tt.wantOpen)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package etl
+
+import (
+	"context"
+	"sync"
+)
+
+// Control pauses and resumes a running ingestion or poller. A nil Control is
+// never paused.
+type Control struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{} // closed when the control is resumed
+}
+
+func NewControl() *Control {
+	return &Control{}
+}
+
+// Pause stops work at the next batch boundary. It returns false if already paused.
+func (c *Control) Pause() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused {
+		return false
+	}
+	c.paused = true
+	c.resumed = make(chan struct{})
+	return true
+}
+
+// Resume lets paused work continue. It returns false if not paused.
+func (c *Control) Resume() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		return false
+	}
+	c.paused = false
+	close(c.resumed)
+	return true
+}
+
+func (c *Control) Paused() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// Wait blocks while paused and returns once resumed or ctx is done
+func (c *Control) Wait(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if !c.paused {
+		c.mu.Unlock()
+		return nil
+	}
+	resumed := c.resumed
+	c.mu.Unlock()
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,189 @@
+package etl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/db"
+)
+
+// DLQTableName is the ClickHouse table used by the clickhouse dead-letter target
+const DLQTableName = "_chug_dlq"
+
+// ErrDeadLetterLimit is returned by inserts once more rows were dead-lettered
+// than the error policy's max_errors allows
+var ErrDeadLetterLimit = errors.New("dead-letter limit exceeded")
+
+// DeadLetterQueue receives rows that ClickHouse rejected together with the error
+type DeadLetterQueue interface {
+	Write(ctx context.Context, table string, columns []string, rows [][]any, cause error) error
+	Close() error
+}
+
+// DeadLetter is a single rejected row as stored in the dead-letter queue
+type DeadLetter struct {
+	Table    string          `json:"table"`
+	Error    string          `json:"error"`
+	Row      json.RawMessage `json:"row"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// NewDeadLetterQueue creates the dead-letter queue described by the policy.
+// It returns nil when the policy does not use a dead-letter queue.
+func NewDeadLetterQueue(chURL, table string, policy config.ErrorPolicy) (DeadLetterQueue, error) {
+	switch policy.Mode {
+	case "", config.ErrorModeFail:
+		return nil, nil
+	case config.ErrorModeDLQ:
+	default:
+		return nil, fmt.Errorf("unknown error policy mode: %s", policy.Mode)
+	}
+
+	switch policy.DLQ {
+	case "", config.DLQTargetFile:
+		dir := policy.DLQPath
+		if dir == "" {
+			dir = "dlq"
+		}
+		return newFileDLQ(filepath.Join(dir, table+".ndjson"))
+	case config.DLQTargetClickHouse:
+		return newClickHouseDLQ(chURL)
+	default:
+		return nil, fmt.Errorf("unknown dead-letter target: %s", policy.DLQ)
+	}
+}
+
+func newDeadLetters(table string, columns []string, rows [][]any, cause error) ([]DeadLetter, error) {
+	now := time.Now()
+	letters := make([]DeadLetter, len(rows))
+	for i, row := range rows {
+		values := make(map[string]any, len(columns))
+		for j, col := range columns {
+			if j < len(row) {
+				values[col] = row[j]
+			}
+		}
+		encoded, err := marshalRow(values)
+		if err != nil {
+			return nil, err
+		}
+		letters[i] = DeadLetter{
+			Table:    table,
+			Error:    cause.Error(),
+			Row:      encoded,
+			FailedAt: now,
+		}
+	}
+	return letters, nil
+}
+
+// marshalRow encodes a row as JSON, falling back to fmt formatting for values
+// that encoding/json does not understand
+func marshalRow(row map[string]any) ([]byte, error) {
+	data, err := json.Marshal(row)
+	if err == nil {
+		return data, nil
+	}
+
+	fallback := make(map[string]string, len(row))
+	for k, v := range row {
+		fallback[k] = fmt.Sprintf("%v", v)
+	}
+	return json.Marshal(fallback)
+}
+
+type fileDLQ struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func newFileDLQ(path string) (*fileDLQ, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+
+	return &fileDLQ{file: f}, nil
+}
+
+func (q *fileDLQ) Write(ctx context.Context, table string, columns []string, rows [][]any, cause error) error {
+	letters, err := newDeadLetters(table, columns, rows, cause)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, letter := range letters {
+		line, err := json.Marshal(letter)
+		if err != nil {
+			return err
+		}
+		if _, err := q.file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("failed to write dead letter: %w", err)
+		}
+	}
+	return nil
+}
+
+func (q *fileDLQ) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Close()
+}
+
+type clickHouseDLQ struct {
+	chURL string
+}
+
+func newClickHouseDLQ(chURL string) (*clickHouseDLQ, error) {
+	ddl := fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (table_name String, error String, row String, failed_at DateTime64(3)) ENGINE = MergeTree() ORDER BY (table_name, failed_at)",
+		QuoteIdentifier(DLQTableName),
+	)
+	if err := CreateTable(chURL, ddl); err != nil {
+		return nil, fmt.Errorf("failed to create dead-letter table: %w", err)
+	}
+	return &clickHouseDLQ{chURL: chURL}, nil
+}
+
+func (q *clickHouseDLQ) Write(ctx context.Context, table string, columns []string, rows [][]any, cause error) error {
+	conn, release, err := db.Pools.AcquireClickHouse(q.chURL)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	letters, err := newDeadLetters(table, columns, rows, cause)
+	if err != nil {
+		return err
+	}
+
+	args := make([]any, 0, len(letters)*4)
+	for _, letter := range letters {
+		args = append(args, letter.Table, letter.Error, string(letter.Row), letter.FailedAt)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (table_name, error, row, failed_at) VALUES ", QuoteIdentifier(DLQTableName)) +
+		buildValuesPlaceholders(len(letters), 4)
+	if _, err := conn.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to write dead letters: %w", err)
+	}
+	return nil
+}
+
+func (q *clickHouseDLQ) Close() error {
+	return nil
+}
@@ -6,8 +6,15 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/internal/metrics"
+	"github.com/pixperk/chug/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// extractPageRows is how many streamed rows one "extract page" span covers
+const extractPageRows = 10000
+
 type Column struct {
 	Name string
 	Type string
@@ -48,7 +55,13 @@ func GetPrimaryKeyColumns(ctx context.Context, conn *pgxpool.Pool, table string)
 	return pkCols, rows.Err()
 }
 
-func getColumns(ctx context.Context, conn *pgxpool.Pool, table string) ([]Column, error) {
+func getColumns(ctx context.Context, conn *pgxpool.Pool, table string) (cols []Column, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "discover columns", trace.WithAttributes(tracing.TableKey.String(table)))
+	defer func() {
+		span.SetAttributes(attribute.Int("chug.columns", len(cols)))
+		tracing.End(span, err)
+	}()
+
 	colQuery := `
 		SELECT column_name, data_type
 		FROM information_schema.columns
@@ -62,7 +75,6 @@ func getColumns(ctx context.Context, conn *pgxpool.Pool, table string) ([]Column
 	}
 	defer rows.Close()
 
-	var cols []Column
 	for rows.Next() {
 		var col Column
 		if err := rows.Scan(&col.Name, &col.Type); err != nil {
@@ -103,22 +115,7 @@ func ExtractTableData(ctx context.Context, conn *pgxpool.Pool, table string, lim
 		if err != nil {
 			return nil, fmt.Errorf("failed to get row values: %w", err)
 		}
-		for i, val := range values {
-			var uuidBytes []byte
-			switch v := val.(type) {
-			case [16]byte:
-				uuidBytes = v[:]
-			case []byte:
-				uuidBytes = v
-			}
-
-			if uuidBytes != nil && (cols[i].Type == "uuid" || cols[i].Type == "bytea") {
-				if len(uuidBytes) == 16 {
-					// Format byte slice as UUID string
-					values[i] = fmt.Sprintf("%x-%x-%x-%x-%x", uuidBytes[0:4], uuidBytes[4:6], uuidBytes[6:8], uuidBytes[8:10], uuidBytes[10:16])
-				}
-			}
-		}
+		convertValues(cols, values)
 		result = append(result, values)
 	}
 
@@ -133,12 +130,23 @@ func ExtractTableData(ctx context.Context, conn *pgxpool.Pool, table string, lim
 }
 
 // polling use case
-func ExtractTableDataSince(ctx context.Context, conn *pgxpool.Pool, table, deltaCol, lastSeen string, limit *int) (*TableData, error) {
+func ExtractTableDataSince(ctx context.Context, conn *pgxpool.Pool, table, deltaCol, lastSeen string, limit *int) (data *TableData, err error) {
 	cols, err := getColumns(ctx, conn, table)
 	if err != nil {
 		return nil, err
 	}
 
+	ctx, span := tracing.Tracer().Start(ctx, "extract page", trace.WithAttributes(
+		tracing.TableKey.String(table),
+		attribute.String("chug.last_seen", lastSeen),
+	))
+	defer func() {
+		if data != nil {
+			span.SetAttributes(tracing.RowsKey.Int(len(data.Rows)))
+		}
+		tracing.End(span, err)
+	}()
+
 	query := fmt.Sprintf(
 		"SELECT * FROM %s WHERE %s > $1 ORDER BY %s ASC",
 		pgx.Identifier{table}.Sanitize(),
@@ -164,22 +172,7 @@ func ExtractTableDataSince(ctx context.Context, conn *pgxpool.Pool, table, delta
 		if err != nil {
 			return nil, fmt.Errorf("failed to get delta row values: %w", err)
 		}
-		for i, val := range values {
-			var uuidBytes []byte
-			switch v := val.(type) {
-			case [16]byte:
-				uuidBytes = v[:]
-			case []byte:
-				uuidBytes = v
-			}
-
-			if uuidBytes != nil && (cols[i].Type == "uuid" || cols[i].Type == "bytea") {
-				if len(uuidBytes) == 16 {
-					// Format byte slice as UUID string
-					values[i] = fmt.Sprintf("%x-%x-%x-%x-%x", uuidBytes[0:4], uuidBytes[4:6], uuidBytes[6:8], uuidBytes[8:10], uuidBytes[10:16])
-				}
-			}
-		}
+		convertValues(cols, values)
 		result = append(result, values)
 	}
 	if err := rows.Err(); err != nil {
@@ -192,6 +185,26 @@ func ExtractTableDataSince(ctx context.Context, conn *pgxpool.Pool, table, delta
 	}, nil
 }
 
+// convertValues formats the 16-byte uuid and bytea values of a row as UUID
+// strings, the form ClickHouse's UUID columns accept
+func convertValues(cols []Column, values []any) {
+	for i, val := range values {
+		if cols[i].Type != "uuid" && cols[i].Type != "bytea" {
+			continue
+		}
+		var b []byte
+		switch v := val.(type) {
+		case [16]byte:
+			b = v[:]
+		case []byte:
+			b = v
+		}
+		if len(b) == 16 {
+			values[i] = fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+		}
+	}
+}
+
 func GetColumnNames(cols []Column) []string {
 	names := make([]string, len(cols))
 	for i, col := range cols {
@@ -241,84 +254,58 @@ type StreamResult struct {
 	ErrChan <-chan error
 }
 
-func ExtractTableDataStreaming(ctx context.Context, conn *pgxpool.Pool, table string, limit *int) (*StreamResult, error) {
-	cols, err := getColumns(ctx, conn, table)
-	if err != nil {
-		return nil, err
-	}
-
-	rowChan := make(chan []any, 100)
-	errChan := make(chan error, 1)
-
-	go func() {
-		defer close(rowChan)
-		defer close(errChan)
-
-		var query string
-		var rows pgx.Rows
-		var err error
-
-		if limit != nil && *limit > 0 {
-			query = "SELECT * FROM " + pgx.Identifier{table}.Sanitize() + " LIMIT $1"
-			rows, err = conn.Query(ctx, query, *limit)
-		} else {
-			query = "SELECT * FROM " + pgx.Identifier{table}.Sanitize()
-			rows, err = conn.Query(ctx, query)
-		}
-		if err != nil {
-			errChan <- fmt.Errorf("failed to query table data: %w", err)
-			return
-		}
-		defer rows.Close()
-
-		for rows.Next() {
-			values, err := rows.Values()
-			if err != nil {
-				errChan <- fmt.Errorf("failed to get row values: %w", err)
-				return
-			}
-
-			for i, val := range values {
-				var uuidBytes []byte
-				switch v := val.(type) {
-				case [16]byte:
-					uuidBytes = v[:]
-				case []byte:
-					uuidBytes = v
-				}
-
-				if uuidBytes != nil && (cols[i].Type == "uuid" || cols[i].Type == "bytea") {
-					if len(uuidBytes) == 16 {
-						values[i] = fmt.Sprintf("%x-%x-%x-%x-%x", uuidBytes[0:4], uuidBytes[4:6], uuidBytes[6:8], uuidBytes[8:10], uuidBytes[10:16])
-					}
-				}
-			}
+// StreamOptions controls a streamed extract. A nil *StreamOptions streams
+// without a memory budget and records nothing.
+type StreamOptions struct {
+	Memory  *MemoryBudget               // each row reserves its bytes before being handed on
+	Metrics *metrics.Table              // rows extracted and time blocked
+	OnRow   func(row []any, size int64) // called with each row handed on and its rowSize, from the extracting goroutine
+}
 
-			select {
-			case rowChan <- values:
-			case <-ctx.Done():
-				errChan <- ctx.Err()
-				return
-			}
-		}
+func ExtractTableDataStreaming(ctx context.Context, conn *pgxpool.Pool, table string, limit *int, opts *StreamOptions) (*StreamResult, error) {
+	query := "SELECT * FROM " + pgx.Identifier{table}.Sanitize()
+	var args []any
+	if limit != nil && *limit > 0 {
+		query += " LIMIT $1"
+		args = append(args, *limit)
+	}
+	return streamQuery(ctx, conn, table, query, args, opts)
+}
 
-		if err := rows.Err(); err != nil {
-			errChan <- fmt.Errorf("error iterating rows: %w", err)
-		}
-	}()
+func ExtractTableDataSinceStreaming(ctx context.Context, conn *pgxpool.Pool, table, deltaCol, lastSeen string, limit *int, opts *StreamOptions) (*StreamResult, error) {
+	query := fmt.Sprintf(
+		"SELECT * FROM %s WHERE %s > $1 ORDER BY %s ASC",
+		pgx.Identifier{table}.Sanitize(),
+		deltaCol,
+		deltaCol,
+	)
+	args := []any{lastSeen}
+	if limit != nil && *limit > 0 {
+		query += " LIMIT $2"
+		args = append(args, *limit)
+	}
+	return streamQuery(ctx, conn, table, query, args, opts)
+}
 
-	return &StreamResult{
-		Columns: cols,
-		RowChan: rowChan,
-		ErrChan: errChan,
-	}, nil
+// ExtractTableRangeStreaming streams the rows whose integer primary key pkCol
+// is in (from, to]. A nil bound leaves that side of the range open.
+func ExtractTableRangeStreaming(ctx context.Context, conn *pgxpool.Pool, table, pkCol string, from, to *int64, opts *StreamOptions) (*StreamResult, error) {
+	where, args := pgRangeCondition(pkCol, from, to)
+	query := "SELECT * FROM " + pgx.Identifier{table}.Sanitize() + where
+	return streamQuery(ctx, conn, table, query, args, opts)
 }
 
-func ExtractTableDataSinceStreaming(ctx context.Context, conn *pgxpool.Pool, table, deltaCol, lastSeen string, limit *int) (*StreamResult, error) {
+// streamQuery runs query in the background, handing its rows to RowChan.
+// Each row first reserves its bytes from opts.Memory; the reservation passes
+// with the row to whoever reads RowChan.
+func streamQuery(ctx context.Context, conn *pgxpool.Pool, table, query string, args []any, opts *StreamOptions) (*StreamResult, error) {
 	cols, err := getColumns(ctx, conn, table)
 	if err != nil {
 		return nil, err
 	}
+	if opts == nil {
+		opts = &StreamOptions{}
+	}
 
 	rowChan := make(chan []any, 100)
 	errChan := make(chan error, 1)
@@ -327,23 +314,16 @@ func ExtractTableDataSinceStreaming(ctx context.Context, conn *pgxpool.Pool, tab
 		defer close(rowChan)
 		defer close(errChan)
 
-		query := fmt.Sprintf(
-			"SELECT * FROM %s WHERE %s > $1 ORDER BY %s ASC",
-			pgx.Identifier{table}.Sanitize(),
-			deltaCol,
-			deltaCol,
-		)
-
-		var rows pgx.Rows
-		var err error
-		if limit != nil && *limit > 0 {
-			query += " LIMIT $2"
-			rows, err = conn.Query(ctx, query, lastSeen, *limit)
-		} else {
-			rows, err = conn.Query(ctx, query, lastSeen)
+		pages := &extractPages{ctx: ctx, table: table}
+		pages.start()
+		fail := func(err error) {
+			pages.end(err)
+			errChan <- err
 		}
+
+		rows, err := conn.Query(ctx, query, args...)
 		if err != nil {
-			errChan <- fmt.Errorf("failed to query delta rows: %w", err)
+			fail(fmt.Errorf("failed to query table data: %w", err))
 			return
 		}
 		defer rows.Close()
@@ -351,37 +331,35 @@ func ExtractTableDataSinceStreaming(ctx context.Context, conn *pgxpool.Pool, tab
 		for rows.Next() {
 			values, err := rows.Values()
 			if err != nil {
-				errChan <- fmt.Errorf("failed to get delta row values: %w", err)
+				fail(fmt.Errorf("failed to get row values: %w", err))
 				return
 			}
 
-			for i, val := range values {
-				var uuidBytes []byte
-				switch v := val.(type) {
-				case [16]byte:
-					uuidBytes = v[:]
-				case []byte:
-					uuidBytes = v
-				}
-
-				if uuidBytes != nil && (cols[i].Type == "uuid" || cols[i].Type == "bytea") {
-					if len(uuidBytes) == 16 {
-						values[i] = fmt.Sprintf("%x-%x-%x-%x-%x", uuidBytes[0:4], uuidBytes[4:6], uuidBytes[6:8], uuidBytes[8:10], uuidBytes[10:16])
-					}
-				}
-			}
+			convertValues(cols, values)
 
-			select {
-			case rowChan <- values:
-			case <-ctx.Done():
-				errChan <- ctx.Err()
+			size := rowSize(values)
+			reserved := opts.Memory.cost(size)
+			if err := opts.Memory.reserve(ctx, reserved, opts.Metrics); err != nil {
+				fail(err)
 				return
 			}
+			if err := send(ctx, rowChan, values, opts.Metrics, metrics.StageExtract); err != nil {
+				opts.Memory.release(reserved)
+				fail(err)
+				return
+			}
+			pages.row()
+			opts.Metrics.RowsExtracted(1)
+			if opts.OnRow != nil {
+				opts.OnRow(values, size)
+			}
 		}
 
 		if err := rows.Err(); err != nil {
-			errChan <- fmt.Errorf("error iterating delta rows: %w", err)
+			fail(fmt.Errorf("error iterating rows: %w", err))
+			return
 		}
+		pages.end(nil)
 	}()
 
 	return &StreamResult{
@@ -390,3 +368,40 @@ func ExtractTableDataSinceStreaming(ctx context.Context, conn *pgxpool.Pool, tab
 		ErrChan: errChan,
 	}, nil
 }
+
+// extractPages traces a streamed extract as a run of "extract page" spans of
+// extractPageRows rows each. The first page includes running the query.
+type extractPages struct {
+	ctx   context.Context
+	table string
+	page  int
+	rows  int
+	span  trace.Span
+}
+
+func (p *extractPages) start() {
+	p.page++
+	p.rows = 0
+	_, p.span = tracing.Tracer().Start(p.ctx, "extract page", trace.WithAttributes(
+		tracing.TableKey.String(p.table),
+		attribute.Int("chug.page", p.page),
+	))
+}
+
+// row counts a row handed downstream, rolling over to the next page when full
+func (p *extractPages) row() {
+	p.rows++
+	if p.rows >= extractPageRows {
+		p.end(nil)
+		p.start()
+	}
+}
+
+func (p *extractPages) end(err error) {
+	if p.span == nil {
+		return
+	}
+	p.span.SetAttributes(tracing.RowsKey.Int(p.rows))
+	tracing.End(p.span, err)
+	p.span = nil
+}
@@ -0,0 +1,70 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/internal/db"
+	"github.com/pixperk/chug/internal/logx"
+	"github.com/pixperk/chug/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// runPostgresHooks runs the PostgreSQL statements of a table's pre_sql or
+// post_sql in order, stopping at the first failure
+func runPostgresHooks(ctx context.Context, pgConn *pgxpool.Pool, table, hook string, statements []string) error {
+	for i, stmt := range statements {
+		err := runHook(ctx, table, hook, "postgres", stmt, func(ctx context.Context) error {
+			_, err := pgConn.Exec(ctx, stmt)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%s postgres statement %d: %w", hook, i+1, err)
+		}
+	}
+	return nil
+}
+
+// runClickHouseHooks runs the ClickHouse statements of a table's pre_sql or
+// post_sql in order, stopping at the first failure
+func runClickHouseHooks(ctx context.Context, chURL, table, hook string, statements []string) error {
+	if len(statements) == 0 {
+		return nil
+	}
+	conn, release, err := db.Pools.AcquireClickHouse(chURL)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	for i, stmt := range statements {
+		err := runHook(ctx, table, hook, "clickhouse", stmt, func(ctx context.Context) error {
+			_, err := conn.ExecContext(ctx, stmt)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%s clickhouse statement %d: %w", hook, i+1, err)
+		}
+	}
+	return nil
+}
+
+// runHook traces and logs one hook statement
+func runHook(ctx context.Context, table, hook, database, stmt string, exec func(ctx context.Context) error) error {
+	ctx, span := tracing.Tracer().Start(ctx, "sql hook")
+	span.SetAttributes(
+		tracing.TableKey.String(table),
+		attribute.String("chug.hook", hook),
+		attribute.String("chug.database", database),
+		attribute.String("chug.sql", stmt),
+	)
+	logx.Logger.Info("Running "+hook,
+		zap.String("table", table),
+		zap.String("database", database),
+		zap.String("statement", stmt))
+	err := exec(ctx)
+	tracing.End(span, err)
+	return err
+}
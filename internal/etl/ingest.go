@@ -2,33 +2,72 @@ package etl
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/api/types"
 	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/metrics"
+	"github.com/pixperk/chug/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // TableResult represents the result of ingesting a single table
-type TableResult struct {
-	TableName string        `json:"name"`
-	Success   bool          `json:"success"`
-	Error     string        `json:"error,omitempty"`
-	RowCount  int64         `json:"rows"`
-	Duration  time.Duration `json:"duration"`
-}
+type TableResult = types.TableResult
 
 // IngestOptions contains optional callbacks for logging/monitoring
 type IngestOptions struct {
 	OnTableStart    func(tableName string)
 	OnExtractStart  func(tableName string, columnCount int)
 	OnInsertStart   func(tableName string)
-	OnProgress      func(tableName string, currentRows int64, totalRows int64, percentage float64, phase string)
+	OnProgress      func(tableName string, progress TableProgress)
 	OnTableComplete func(tableName string, rowCount int64, duration time.Duration)
 	OnTableError    func(tableName string, err error)
 	StartPolling    func(ctx context.Context, tableConfig config.ResolvedTableConfig)
+	// Pollers, when set, counts the running StartPolling calls so the caller
+	// can wait for pollers to commit their last cycle on shutdown
+	Pollers *sync.WaitGroup
+	// TableContext derives the context and pause control used for one table,
+	// letting the caller cancel or pause tables individually
+	TableContext func(ctx context.Context, tableName string) (context.Context, *Control)
+	// JobID labels the metrics and traces of the job's tables, default metrics.CLIJob
+	JobID string
+	// Memory bounds the rows buffered by all of the job's tables. When nil,
+	// IngestMultipleTables creates one from the config's memory limit and
+	// IngestSingleTable buffers without a bound.
+	Memory *MemoryBudget
+	// Workers bounds the batch inserts running at once, likewise created by
+	// IngestMultipleTables from the config's insert_workers when nil
+	Workers *WorkerBudget
+	// OnQueue is called by IngestMultipleTables with the tables not started
+	// yet, waiting for a slot or their dependencies, whenever they change
+	OnQueue func(queued []string)
+}
+
+func (o *IngestOptions) memory() *MemoryBudget {
+	if o == nil {
+		return nil
+	}
+	return o.Memory
+}
+
+func (o *IngestOptions) workers() *WorkerBudget {
+	if o == nil {
+		return nil
+	}
+	return o.Workers
+}
+
+func (o *IngestOptions) jobID() string {
+	if o == nil || o.JobID == "" {
+		return metrics.CLIJob
+	}
+	return o.JobID
 }
 
 // IngestSingleTable ingests a single table from PostgreSQL to ClickHouse
@@ -45,12 +84,58 @@ func IngestSingleTable(
 		Success:   false,
 	}
 
+	tableMetrics := metrics.ForTable(opts.jobID(), tableConfig.Name)
+
+	var control *Control
+	if opts != nil && opts.TableContext != nil {
+		ctx, control = opts.TableContext(ctx, tableConfig.Name)
+	}
+
+	ctx, span := tracing.StartTable(ctx, "ingest table", opts.jobID(), tableConfig.Name)
+	defer func() {
+		span.SetAttributes(tracing.RowsKey.Int64(result.RowCount))
+		var err error
+		if !result.Success {
+			err = errors.New(result.Error)
+		}
+		tracing.End(span, err)
+	}()
+
 	if opts != nil && opts.OnTableStart != nil {
 		opts.OnTableStart(tableConfig.Name)
 	}
 
-	// Extract data from PostgreSQL
-	stream, err := ExtractTableDataStreaming(ctx, pgConn, tableConfig.Name, &tableConfig.Limit)
+	// Replace loads insert into a staging table, swapped in once complete
+	into, err := loadTable(tableConfig.Name, tableConfig.LoadMode)
+	if err != nil {
+		result.Error = err.Error()
+		if opts != nil && opts.OnTableError != nil {
+			opts.OnTableError(tableConfig.Name, err)
+		}
+		return result
+	}
+
+	// The initial load gets its own context so extraction stops when insertion
+	// gives up; ctx itself lives on in the poller
+	loadCtx, cancelLoad := context.WithCancel(ctx)
+	defer cancelLoad()
+
+	if err := runPostgresHooks(loadCtx, pgConn, tableConfig.Name, "pre_sql", tableConfig.PreSQL.Postgres); err != nil {
+		result.Error = err.Error()
+		if opts != nil && opts.OnTableError != nil {
+			opts.OnTableError(tableConfig.Name, err)
+		}
+		return result
+	}
+
+	// Extract data from PostgreSQL. Rows wait in the stream, holding their
+	// share of the memory budget, until the table is created and inserting
+	tracker := &progressTracker{}
+	stream, err := ExtractTableDataStreaming(loadCtx, pgConn, tableConfig.Name, &tableConfig.Limit, &StreamOptions{
+		Memory:  opts.memory(),
+		Metrics: tableMetrics,
+		OnRow:   func(_ []any, size int64) { tracker.extract(size) },
+	})
 	if err != nil {
 		errMsg := fmt.Sprintf("extraction failed: %v", err)
 		result.Error = errMsg
@@ -60,19 +145,30 @@ func IngestSingleTable(
 		return result
 	}
 
+	// Rows not handed to the inserter still hold memory when setup fails
+	inserting := false
+	defer func() {
+		if !inserting {
+			opts.memory().drain(stream.RowChan)
+		}
+	}()
+
 	if opts != nil && opts.OnExtractStart != nil {
 		opts.OnExtractStart(tableConfig.Name, len(stream.Columns))
 	}
 
+	ddlCtx, ddlSpan := tracing.Tracer().Start(ctx, "create table")
+
 	// Query for primary key columns if CDC is enabled
 	var pkCols []string
 	if tableConfig.Polling.Enabled {
-		pkCols, _ = GetPrimaryKeyColumns(ctx, pgConn, tableConfig.Name)
+		pkCols, _ = GetPrimaryKeyColumns(ddlCtx, pgConn, tableConfig.Name)
 	}
 
 	// Build DDL and create table in ClickHouse
-	ddl, err := BuildDDLQuery(tableConfig.Name, stream.Columns, tableConfig.Polling.Enabled, tableConfig.Polling.DeltaCol, pkCols)
+	ddl, err := BuildDDLQuery(into, stream.Columns, tableConfig.Polling.Enabled, tableConfig.Polling.DeltaCol, pkCols)
 	if err != nil {
+		tracing.End(ddlSpan, err)
 		errMsg := fmt.Sprintf("DDL generation failed: %v", err)
 		result.Error = errMsg
 		if opts != nil && opts.OnTableError != nil {
@@ -81,7 +177,13 @@ func IngestSingleTable(
 		return result
 	}
 
-	if err := CreateTable(chURL, ddl); err != nil {
+	ddlSpan.SetAttributes(attribute.String("chug.ddl", ddl), attribute.String("chug.load_mode", tableConfig.LoadMode))
+	err = resetTable(ddlCtx, chURL, tableConfig.Name, tableConfig.LoadMode)
+	if err == nil {
+		err = CreateTable(chURL, ddl)
+	}
+	tracing.End(ddlSpan, err)
+	if err != nil {
 		errMsg := fmt.Sprintf("table creation failed: %v", err)
 		result.Error = errMsg
 		if opts != nil && opts.OnTableError != nil {
@@ -90,50 +192,72 @@ func IngestSingleTable(
 		return result
 	}
 
+	dlq, err := NewDeadLetterQueue(chURL, tableConfig.Name, tableConfig.ErrorPolicy)
+	if err != nil {
+		errMsg := fmt.Sprintf("dead-letter queue setup failed: %v", err)
+		result.Error = errMsg
+		if opts != nil && opts.OnTableError != nil {
+			opts.OnTableError(tableConfig.Name, fmt.Errorf("%s", errMsg))
+		}
+		return result
+	}
+	if dlq != nil {
+		defer dlq.Close()
+	}
+
+	if err := runClickHouseHooks(loadCtx, chURL, tableConfig.Name, "pre_sql", tableConfig.PreSQL.ClickHouse); err != nil {
+		result.Error = err.Error()
+		if opts != nil && opts.OnTableError != nil {
+			opts.OnTableError(tableConfig.Name, err)
+		}
+		return result
+	}
+
 	if opts != nil && opts.OnInsertStart != nil {
 		opts.OnInsertStart(tableConfig.Name)
 	}
 
 	// Stream rows to ClickHouse
-	var rowCount atomic.Int64
-	rowChan := make(chan []any, 100)
-
-	// Calculate total rows for percentage
-	var totalRows int64
-	if tableConfig.Limit > 0 {
-		totalRows = int64(tableConfig.Limit)
-	}
+	tracker.start = time.Now()
+	tracker.expectTotal(loadCtx, pgConn, tableConfig.Name, tableConfig.Limit, tableConfig.ExactCount)
 
 	// Progress reporting ticker
 	progressTicker := time.NewTicker(2 * time.Second)
 	defer progressTicker.Stop()
+	progressDone := make(chan struct{})
+	defer close(progressDone)
 
 	// Goroutine for progress updates
 	go func() {
-		for range progressTicker.C {
-			current := rowCount.Load()
-			if opts != nil && opts.OnProgress != nil && current > 0 {
-				var percentage float64
-				if totalRows > 0 {
-					percentage = float64(current) / float64(totalRows) * 100
-					if percentage > 100 {
-						percentage = 100
-					}
+		for {
+			select {
+			case <-progressTicker.C:
+				if opts != nil && opts.OnProgress != nil && tracker.extracted.Load() > 0 {
+					opts.OnProgress(tableConfig.Name, tracker.report("inserting"))
 				}
-				opts.OnProgress(tableConfig.Name, current, totalRows, percentage, "inserting")
+			case <-progressDone:
+				return
 			}
 		}
 	}()
 
-	go func() {
-		for row := range stream.RowChan {
-			rowChan <- row
-			rowCount.Add(1)
-		}
-		close(rowChan)
-	}()
-
-	if err := InsertRowsStreaming(ctx, chURL, tableConfig.Name, GetColumnNames(stream.Columns), rowChan, tableConfig.BatchSize); err != nil {
+	retry := RetryConfigFromPolicy(tableConfig.Retry)
+	insertOpts := &InsertOptions{
+		Retry:     &retry,
+		DLQ:       dlq,
+		MaxErrors: tableConfig.ErrorPolicy.MaxErrors,
+		Control:   control,
+		Metrics:   tableMetrics,
+		Inserted:  &tracker.inserted,
+		Memory:    opts.memory(),
+		Workers:   opts.workers(),
+		Into:      into,
+	}
+	inserting = true
+	stats, err := InsertRowsStreaming(loadCtx, chURL, tableConfig.Name, GetColumnNames(stream.Columns), stream.RowChan, tableConfig.BatchSize, insertOpts)
+	result.ExtractedRows = tracker.extracted.Load()
+	result.DeadLettered = stats.DeadLettered
+	if err != nil {
 		errMsg := fmt.Sprintf("insertion failed: %v", err)
 		result.Error = errMsg
 		if opts != nil && opts.OnTableError != nil {
@@ -156,8 +280,36 @@ func IngestSingleTable(
 	default:
 	}
 
+	if tableConfig.LoadMode == config.LoadModeReplace {
+		swapCtx, swapSpan := tracing.Tracer().Start(loadCtx, "swap table")
+		err := swapStaging(swapCtx, chURL, tableConfig.Name, result.ExtractedRows, stats)
+		tracing.End(swapSpan, err)
+		if err != nil {
+			errMsg := fmt.Sprintf("replace failed: %v", err)
+			result.Error = errMsg
+			if opts != nil && opts.OnTableError != nil {
+				opts.OnTableError(tableConfig.Name, fmt.Errorf("%s", errMsg))
+			}
+			return result
+		}
+	}
+
+	// Hooks see the committed rows, but polling has not started yet
+	err = runPostgresHooks(loadCtx, pgConn, tableConfig.Name, "post_sql", tableConfig.PostSQL.Postgres)
+	if err == nil {
+		err = runClickHouseHooks(loadCtx, chURL, tableConfig.Name, "post_sql", tableConfig.PostSQL.ClickHouse)
+	}
+	if err != nil {
+		result.RowCount = stats.Inserted
+		result.Error = err.Error()
+		if opts != nil && opts.OnTableError != nil {
+			opts.OnTableError(tableConfig.Name, err)
+		}
+		return result
+	}
+
 	result.Success = true
-	result.RowCount = rowCount.Load()
+	result.RowCount = stats.Inserted
 	result.Duration = time.Since(startTime)
 
 	if opts != nil && opts.OnTableComplete != nil {
@@ -166,42 +318,163 @@ func IngestSingleTable(
 
 	// Start polling if enabled
 	if tableConfig.Polling.Enabled && opts != nil && opts.StartPolling != nil {
-		go opts.StartPolling(ctx, tableConfig)
+		if opts.Pollers != nil {
+			opts.Pollers.Add(1)
+		}
+		go func() {
+			if opts.Pollers != nil {
+				defer opts.Pollers.Done()
+			}
+			opts.StartPolling(ctx, tableConfig)
+		}()
 	}
 
 	return result
 }
 
-// IngestMultipleTables ingests multiple tables in parallel
+// IngestMultipleTables ingests multiple tables in parallel, at most
+// cfg.ParallelTables at once. A table starts once the tables it depends on
+// have loaded, in order of priority, highest first, then in config order;
+// the tables not started yet are reported to opts.OnQueue. Tables fail
+// without starting when a dependency fails, when the dependencies are
+// invalid or have a cycle, and when ctx ends. Results are in config order.
 func IngestMultipleTables(
 	ctx context.Context,
 	cfg *config.Config,
 	pgConn *pgxpool.Pool,
 	opts *IngestOptions,
 ) []TableResult {
-	tableConfigs := cfg.GetEffectiveTableConfigs()
-	resultChan := make(chan TableResult, len(tableConfigs))
-	var wg sync.WaitGroup
+	if opts.memory() == nil || opts.workers() == nil {
+		shared := IngestOptions{}
+		if opts != nil {
+			shared = *opts
+		}
+		if shared.Memory == nil {
+			shared.Memory = NewMemoryBudget(cfg.MemoryLimit())
+		}
+		if shared.Workers == nil {
+			shared.Workers = NewWorkerBudget(cfg.InsertWorkerLimit())
+		}
+		opts = &shared
+	}
 
-	for _, tc := range tableConfigs {
-		wg.Add(1)
-		go func(tableConfig config.TableConfig) {
-			defer wg.Done()
-			resolved := cfg.ResolveTableConfig(tableConfig)
-			result := IngestSingleTable(ctx, pgConn, cfg.ClickHouseURL, resolved, opts)
-			resultChan <- result
-		}(tc)
+	var tables []config.ResolvedTableConfig
+	for _, tc := range cfg.GetEffectiveTableConfigs() {
+		tables = append(tables, cfg.ResolveTableConfig(tc))
 	}
 
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
+	results := make([]TableResult, len(tables))
+	loaded := make(map[string]bool, len(tables)) // finished tables, true when they succeeded
+	notStarted := func(i int, reason string) {
+		results[i] = TableResult{TableName: tables[i].Name, Error: "not started: " + reason}
+		loaded[tables[i].Name] = false
+		if opts.OnTableError != nil {
+			opts.OnTableError(tables[i].Name, errors.New(results[i].Error))
+		}
+	}
+
+	if err := config.ValidateDependencies(cfg.GetEffectiveTableConfigs()); err != nil {
+		for i := range tables {
+			notStarted(i, err.Error())
+		}
+		return results
+	}
+
+	parallel := cfg.ParallelTables()
+	// Priority only decides the start order; results keep the config order
+	pending := make([]int, len(tables)) // tables not started, in start order
+	for i := range pending {
+		pending[i] = i
+	}
+	sort.SliceStable(pending, func(a, b int) bool {
+		return tables[pending[a]].Priority > tables[pending[b]].Priority
+	})
+	queue := &tableQueue{onChange: opts.OnQueue}
+	finished := make(chan int)
+	stopped := ctx.Done()
+	running := 0
+
+	for len(pending) > 0 || running > 0 {
+		// Start the tables whose dependencies have loaded while slots are free.
+		// Failing a table can fail its dependents, so repeat until nothing changes.
+		for changed := true; changed; {
+			changed = false
+			waiting := make([]int, 0, len(pending))
+			for _, i := range pending {
+				ready, failed := dependenciesLoaded(tables[i], loaded)
+				switch {
+				case failed != "":
+					notStarted(i, fmt.Sprintf("depends on %s, which failed", failed))
+					changed = true
+				case ready && running < parallel:
+					running++
+					go func(i int) {
+						results[i] = IngestSingleTable(ctx, pgConn, cfg.ClickHouseURL, tables[i], opts)
+						finished <- i
+					}(i)
+				default:
+					waiting = append(waiting, i)
+				}
+			}
+			pending = waiting
+		}
+
+		names := make([]string, len(pending))
+		for j, i := range pending {
+			names[j] = tables[i].Name
+		}
+		queue.set(names)
+		if running == 0 {
+			break
+		}
 
-	var results []TableResult
-	for result := range resultChan {
-		results = append(results, result)
+		select {
+		case i := <-finished:
+			running--
+			loaded[tables[i].Name] = results[i].Success
+		case <-stopped:
+			// Let the running tables finish, start no more
+			stopped = nil
+			for _, i := range pending {
+				notStarted(i, ctx.Err().Error())
+			}
+			pending = nil
+		}
 	}
 
 	return results
 }
+
+// dependenciesLoaded reports whether every dependency of table has loaded,
+// or the first one that failed
+func dependenciesLoaded(table config.ResolvedTableConfig, loaded map[string]bool) (ready bool, failed string) {
+	ready = true
+	for _, dep := range table.DependsOn {
+		ok, finished := loaded[dep]
+		switch {
+		case !finished:
+			ready = false
+		case !ok:
+			return false, dep
+		}
+	}
+	return ready, ""
+}
+
+// tableQueue reports the tables of IngestMultipleTables that have not started
+type tableQueue struct {
+	names    []string
+	onChange func(queued []string)
+}
+
+// set replaces the queued tables, reporting them if they changed
+func (q *tableQueue) set(names []string) {
+	if slices.Equal(q.names, names) {
+		return
+	}
+	metrics.TablesQueued(len(names) - len(q.names))
+	q.names = names
+	if q.onChange != nil {
+		q.onChange(slices.Clone(names))
+	}
+}
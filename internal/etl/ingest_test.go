@@ -0,0 +1,126 @@
+package etl
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pixperk/chug/internal/config"
+)
+
+func TestIngestMultipleTablesScheduling(t *testing.T) {
+	table := func(name string, priority int, deps ...string) config.TableConfig {
+		return config.TableConfig{Name: name, Priority: priority, DependsOn: deps}
+	}
+
+	// An unknown load mode fails every table that starts before it touches a
+	// database, leaving only the scheduling to observe
+	tests := []struct {
+		name       string
+		tables     []config.TableConfig
+		parallel   int // 0 for the default
+		wantStarts []string
+		wantErrors []string // per table in config order, matched as substrings
+	}{
+		{
+			name:       "priority orders starts, results keep config order",
+			tables:     []config.TableConfig{table("a", 0), table("b", 10), table("c", 5), table("d", 1)},
+			parallel:   1,
+			wantStarts: []string{"b", "c", "d", "a"},
+			wantErrors: []string{"unknown load mode", "unknown load mode", "unknown load mode", "unknown load mode"},
+		},
+		{
+			name:       "dependents of a failed table do not start",
+			tables:     []config.TableConfig{table("a", 0), table("b", 10), table("c", 5, "a"), table("d", 1, "c")},
+			parallel:   1,
+			wantStarts: []string{"b", "a"},
+			wantErrors: []string{
+				"unknown load mode",
+				"unknown load mode",
+				"not started: depends on a, which failed",
+				"not started: depends on c, which failed",
+			},
+		},
+		{
+			name:   "a cycle fails every table",
+			tables: []config.TableConfig{table("a", 0), table("b", 10, "c"), table("c", 5, "b")},
+			wantErrors: []string{
+				"not started: dependency cycle: b -> c -> b",
+				"not started: dependency cycle: b -> c -> b",
+				"not started: dependency cycle: b -> c -> b",
+			},
+		},
+		{
+			name:   "an unknown dependency fails every table",
+			tables: []config.TableConfig{table("a", 0, "missing"), table("b", 0)},
+			wantErrors: []string{
+				"not started: table a depends on missing",
+				"not started: table a depends on missing",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Tables: tt.tables, LoadMode: "bogus", MaxParallelTables: tt.parallel}
+
+			var mu sync.Mutex
+			var starts, failed []string
+			results := IngestMultipleTables(context.Background(), cfg, nil, &IngestOptions{
+				OnTableStart: func(table string) {
+					mu.Lock()
+					defer mu.Unlock()
+					starts = append(starts, table)
+				},
+				OnTableError: func(table string, _ error) {
+					mu.Lock()
+					defer mu.Unlock()
+					failed = append(failed, table)
+				},
+			})
+
+			if tt.wantStarts != nil && !slices.Equal(starts, tt.wantStarts) {
+				t.Errorf("started %v, want %v", starts, tt.wantStarts)
+			}
+			if len(results) != len(tt.tables) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.tables))
+			}
+			for i, result := range results {
+				if result.TableName != tt.tables[i].Name {
+					t.Errorf("result %d is for %s, want %s", i, result.TableName, tt.tables[i].Name)
+				}
+				if result.Success || !strings.Contains(result.Error, tt.wantErrors[i]) {
+					t.Errorf("%s: error %q, want %q", result.TableName, result.Error, tt.wantErrors[i])
+				}
+			}
+			if len(failed) != len(tt.tables) {
+				t.Errorf("OnTableError called for %v, want every table", failed)
+			}
+		})
+	}
+}
+
+func TestDependenciesLoaded(t *testing.T) {
+	tests := []struct {
+		name       string
+		deps       []string
+		loaded     map[string]bool
+		wantReady  bool
+		wantFailed string
+	}{
+		{name: "no dependencies", wantReady: true},
+		{name: "all loaded", deps: []string{"a", "b"}, loaded: map[string]bool{"a": true, "b": true}, wantReady: true},
+		{name: "one still running", deps: []string{"a", "b"}, loaded: map[string]bool{"a": true}},
+		{name: "one failed", deps: []string{"a", "b"}, loaded: map[string]bool{"a": true, "b": false}, wantFailed: "b"},
+		{name: "failed before unfinished", deps: []string{"a", "b"}, loaded: map[string]bool{"b": false}, wantFailed: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ready, failed := dependenciesLoaded(config.ResolvedTableConfig{Name: "t", DependsOn: tt.deps}, tt.loaded)
+			if ready != tt.wantReady || failed != tt.wantFailed {
+				t.Errorf("dependenciesLoaded = %v, %q, want %v, %q", ready, failed, tt.wantReady, tt.wantFailed)
+			}
+		})
+	}
+}
@@ -10,14 +10,19 @@ import (
 
 	"github.com/pixperk/chug/internal/db"
 	"github.com/pixperk/chug/internal/logx"
+	"github.com/pixperk/chug/internal/metrics"
+	"github.com/pixperk/chug/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 func CreateTable(chURL, ddl string) error {
-	conn, err := db.GetClickHousePool(chURL)
+	conn, release, err := db.Pools.AcquireClickHouse(chURL)
 	if err != nil {
 		return err
 	}
+	defer release()
 
 	_, err = conn.ExecContext(context.Background(), ddl)
 	if err != nil {
@@ -27,22 +32,140 @@ func CreateTable(chURL, ddl string) error {
 	return nil
 }
 
-func InsertRows(chURL, table string, columns []string, rows [][]any, batchSize int) error {
+// InsertOptions controls how failed batches are handled during insertion
+type InsertOptions struct {
+	Retry     *RetryConfig    // nil = DefaultRetryConfig
+	DLQ       DeadLetterQueue // nil = a failed batch fails the whole insert
+	MaxErrors int             // max dead-lettered rows before giving up, 0 = unlimited
+	Control   *Control        // pauses workers between batches, nil = never paused
+	Metrics   *metrics.Table  // nil = not recorded
+	Inserted  *atomic.Int64   // counts rows as their batches commit, nil = not counted
+	Memory    *MemoryBudget   // budget the streamed rows were reserved from, nil = unbounded
+	Workers   *WorkerBudget   // slot held by each batch insert, nil = unbounded
+	Into      string          // table the rows are written to, e.g. a staging table, "" = the table itself
+}
+
+func (o *InsertOptions) metrics() *metrics.Table {
+	if o == nil {
+		return nil
+	}
+	return o.Metrics
+}
+
+// committed counts n rows inserted into ClickHouse
+func (o *InsertOptions) committed(n int64) {
+	if o == nil {
+		return
+	}
+	o.Metrics.RowsInserted(n)
+	if o.Inserted != nil {
+		o.Inserted.Add(n)
+	}
+}
+
+// deadLetterLimit returns ErrDeadLetterLimit once dead rows exceed MaxErrors
+func (o *InsertOptions) deadLetterLimit(dead int64) error {
+	if o == nil || o.MaxErrors <= 0 || dead <= int64(o.MaxErrors) {
+		return nil
+	}
+	return fmt.Errorf("%w: more than %d rows", ErrDeadLetterLimit, o.MaxErrors)
+}
+
+func (o *InsertOptions) memory() *MemoryBudget {
+	if o == nil {
+		return nil
+	}
+	return o.Memory
+}
+
+func (o *InsertOptions) workers() *WorkerBudget {
+	if o == nil {
+		return nil
+	}
+	return o.Workers
+}
+
+// into returns the table the rows of table are written to
+func (o *InsertOptions) into(table string) string {
+	if o == nil || o.Into == "" {
+		return table
+	}
+	return o.Into
+}
+
+func (o *InsertOptions) control() *Control {
+	if o == nil {
+		return nil
+	}
+	return o.Control
+}
+
+func (o *InsertOptions) retryConfig() RetryConfig {
+	if o == nil || o.Retry == nil {
+		return DefaultRetryConfig
+	}
+	return *o.Retry
+}
+
+// InsertStats reports how many rows were inserted and how many were dead-lettered
+type InsertStats struct {
+	Inserted     int64
+	DeadLettered int64
+	Abandoned    int64 // rows of batches never started because ctx was cancelled
+}
+
+// flushGrace is how long a batch already being inserted may keep going after
+// its context is cancelled, so shutdown does not cut an INSERT off mid-statement
+const flushGrace = 10 * time.Second
+
+// flushContext returns a context that outlives the cancellation of ctx by
+// flushGrace, carrying ctx's cause once it finally ends. Call stop when the
+// work is done.
+func flushContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	flushCtx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	stopAfter := context.AfterFunc(ctx, func() {
+		timer := time.NewTimer(flushGrace)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancel(context.Cause(ctx))
+		case <-flushCtx.Done():
+		}
+	})
+	return flushCtx, func() {
+		stopAfter()
+		cancel(context.Canceled)
+	}
+}
+
+// batchInserter writes batches of rows into one ClickHouse table
+type batchInserter struct {
+	conn         *sql.DB
+	breaker      *db.CircuitBreaker
+	table        string
+	columns      []string
+	insertPrefix string
+	opts         *InsertOptions
+}
+
+func newBatchInserter(chURL, table string, columns []string, opts *InsertOptions) (*batchInserter, func(), error) {
+	into := opts.into(table)
+
 	// Validate table name as an extra security measure
-	if !IsValidIdentifier(table) {
-		return fmt.Errorf("invalid table name: %s", table)
+	if !IsValidIdentifier(into) {
+		return nil, nil, fmt.Errorf("invalid table name: %s", into)
 	}
 
 	// Validate column names as an extra security measure
 	for _, col := range columns {
 		if !IsValidIdentifier(col) {
-			return fmt.Errorf("invalid column name: %s", col)
+			return nil, nil, fmt.Errorf("invalid column name: %s", col)
 		}
 	}
 
-	conn, err := db.GetClickHousePool(chURL)
+	conn, release, err := db.Pools.AcquireClickHouse(chURL)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// Quote each column name to prevent SQL injection
@@ -54,29 +177,49 @@ func InsertRows(chURL, table string, columns []string, rows [][]any, batchSize i
 	colNames := "(" + join(quotedColumns, ", ") + ")"
 
 	// Use QuoteIdentifier to safely quote the table name
-	quotedTable := QuoteIdentifier(table)
-	insertPrefix := fmt.Sprintf("INSERT INTO %s %s VALUES ", quotedTable, colNames)
+	quotedTable := QuoteIdentifier(into)
+
+	return &batchInserter{
+		conn:         conn,
+		breaker:      db.ClickHouseBreaker(chURL),
+		table:        table,
+		columns:      columns,
+		insertPrefix: fmt.Sprintf("INSERT INTO %s %s VALUES ", quotedTable, colNames),
+		opts:         opts,
+	}, release, nil
+}
+
+func InsertRows(ctx context.Context, chURL, table string, columns []string, rows [][]any, batchSize int, opts *InsertOptions) (InsertStats, error) {
+	var stats InsertStats
+
+	inserter, release, err := newBatchInserter(chURL, table, columns, opts)
+	if err != nil {
+		return stats, err
+	}
+	defer release()
 
-	ctx := context.Background()
 	for i := 0; i < len(rows); i += batchSize {
 		end := min(i+batchSize, len(rows))
 		batch := rows[i:end]
 
-		query := insertPrefix + buildValuesPlaceholders(len(batch), len(columns))
-		args := flatten(batch)
-
-		err := Retry(ctx, RetryConfig{
-			MaxAttempts: 4,
-			BaseDelay:   250 * time.Millisecond,
-			MaxDelay:    2 * time.Second,
-			Jitter:      true,
-		}, func() error {
-			_, err := conn.ExecContext(ctx, query, args...)
-			return err
-		})
-
+		if err := opts.workers().acquire(ctx, opts.metrics()); err != nil {
+			stats.Abandoned = int64(len(rows) - i)
+			return stats, fmt.Errorf("failed to insert rows into %s: %w", table, err)
+		}
+		inserted, dead, err := inserter.insertWithPolicy(ctx, batch)
+		opts.workers().release()
+		stats.Inserted += inserted
+		opts.committed(inserted)
+		stats.DeadLettered += dead
+		opts.metrics().RowsDeadLettered(dead)
+		if err == nil {
+			err = opts.deadLetterLimit(stats.DeadLettered)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to insert rows into %s: %w", table, err)
+			if ctx.Err() != nil {
+				stats.Abandoned = int64(len(rows) - i)
+			}
+			return stats, fmt.Errorf("failed to insert rows into %s: %w", table, err)
 		}
 
 		logx.Logger.Info("Inserted rows into ClickHouse",
@@ -87,57 +230,91 @@ func InsertRows(chURL, table string, columns []string, rows [][]any, batchSize i
 		)
 
 	}
-	return nil
+	return stats, nil
 }
 
-func InsertRowsStreaming(ctx context.Context, chURL, table string, columns []string, rowChan <-chan []any, batchSize int) error {
-	if !IsValidIdentifier(table) {
-		return fmt.Errorf("invalid table name: %s", table)
-	}
+// batchLinger is how long a partial batch waits for more rows before it is
+// inserted anyway. It keeps slow sources flowing and stops tables from
+// holding the shared memory budget in half-filled batches.
+const batchLinger = time.Second
 
-	for _, col := range columns {
-		if !IsValidIdentifier(col) {
-			return fmt.Errorf("invalid column name: %s", col)
-		}
-	}
+// rowBatch is a batch of rows and the bytes they hold of the memory budget
+type rowBatch struct {
+	rows  [][]any
+	bytes int64
+}
 
-	conn, err := db.GetClickHousePool(chURL)
-	if err != nil {
-		return err
-	}
+// InsertRowsStreaming inserts the rows of rowChan in batches of batchSize
+// using 4 workers, each holding a slot of opts.Workers while it inserts.
+// Rows hold their bytes of opts.Memory, the budget they were extracted with,
+// until their batch is inserted or given up.
+func InsertRowsStreaming(ctx context.Context, chURL, table string, columns []string, rowChan <-chan []any, batchSize int, opts *InsertOptions) (InsertStats, error) {
+	var stats InsertStats
 
-	quotedColumns := make([]string, len(columns))
-	for i, col := range columns {
-		quotedColumns[i] = QuoteIdentifier(col)
+	inserter, release, err := newBatchInserter(chURL, table, columns, opts)
+	if err != nil {
+		opts.memory().drain(rowChan)
+		return stats, err
 	}
+	defer release()
 
-	colNames := "(" + join(quotedColumns, ", ") + ")"
-	quotedTable := QuoteIdentifier(table)
-	insertPrefix := fmt.Sprintf("INSERT INTO %s %s VALUES ", quotedTable, colNames)
+	// Stop the batcher as soon as a worker gives up
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
 	numWorkers := 4
-	batchChan := make(chan [][]any, numWorkers*2)
+	batchChan := make(chan rowBatch, numWorkers*2)
+	m := opts.metrics()
+	memory := opts.memory()
+	workers := opts.workers()
 
 	var wg sync.WaitGroup
 	var totalRows atomic.Int64
+	var deadRows atomic.Int64
+	var abandonedRows atomic.Int64
 	errChan := make(chan error, numWorkers)
 
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func(workerID int) {
 			defer wg.Done()
-			for batch := range batchChan {
-				if err := insertBatch(ctx, conn, insertPrefix, batch, len(columns), table); err != nil {
+			for {
+				waitStart := time.Now()
+				batch, ok := <-batchChan
+				m.Blocked(metrics.StageInsert, time.Since(waitStart))
+				if !ok {
+					return
+				}
+				if ctx.Err() != nil || workers.acquire(ctx, m) != nil {
+					// Keep draining so the batcher is never stuck on a full channel
+					abandonedRows.Add(int64(len(batch.rows)))
+					memory.release(batch.bytes)
+					continue
+				}
+				inserted, dead, err := inserter.insertWithPolicy(ctx, batch.rows)
+				workers.release()
+				memory.release(batch.bytes)
+				// Committed rows count even when the batch fails part way
+				totalRows.Add(inserted)
+				opts.committed(inserted)
+				if dead > 0 {
+					total := deadRows.Add(dead)
+					m.RowsDeadLettered(dead)
+					if err == nil {
+						err = opts.deadLetterLimit(total)
+					}
+				}
+				if err != nil {
 					select {
 					case errChan <- err:
 					default:
 					}
-					return
+					cancel()
+					continue
 				}
-				totalRows.Add(int64(len(batch)))
 				logx.Logger.Info("Worker inserted batch",
 					zap.Int("worker_id", workerID),
-					zap.Int("batch_rows", len(batch)),
+					zap.Int("batch_rows", len(batch.rows)),
 					zap.String("table", table),
 					zap.Int64("total_rows", totalRows.Load()))
 			}
@@ -145,47 +322,214 @@ func InsertRowsStreaming(ctx context.Context, chURL, table string, columns []str
 	}
 
 	go func() {
-		batch := make([][]any, 0, batchSize)
-		for row := range rowChan {
-			batch = append(batch, row)
-
-			if len(batch) >= batchSize {
-				batchChan <- batch
-				batch = make([][]any, 0, batchSize)
+		defer close(batchChan)
+		batch := rowBatch{rows: make([][]any, 0, batchSize)}
+		linger := time.NewTimer(batchLinger)
+		linger.Stop()
+		defer linger.Stop()
+
+		// stop gives up on the rows not yet in a batch, returning their bytes.
+		// The extract ends when its context does, closing rowChan.
+		stop := func() {
+			memory.release(batch.bytes)
+			memory.drain(rowChan)
+		}
+		flush := func() bool {
+			linger.Stop()
+			if err := send(ctx, batchChan, batch, m, metrics.StageBatch); err != nil {
+				return false
 			}
+			batch = rowBatch{rows: make([][]any, 0, batchSize)}
+			return true
 		}
 
-		if len(batch) > 0 {
-			batchChan <- batch
+		for {
+			select {
+			case row, ok := <-rowChan:
+				if !ok {
+					if len(batch.rows) > 0 && !flush() {
+						memory.release(batch.bytes)
+					}
+					return
+				}
+				batch.rows = append(batch.rows, row)
+				batch.bytes += memory.cost(rowSize(row))
+				if len(batch.rows) == 1 {
+					linger.Reset(batchLinger)
+				}
+				if len(batch.rows) >= batchSize && !flush() {
+					stop()
+					return
+				}
+			case <-linger.C:
+				if !flush() {
+					stop()
+					return
+				}
+			case <-ctx.Done():
+				stop()
+				return
+			}
 		}
-		close(batchChan)
 	}()
 
 	wg.Wait()
 	close(errChan)
 
+	stats.Inserted = totalRows.Load()
+	stats.DeadLettered = deadRows.Load()
+	stats.Abandoned = abandonedRows.Load()
+	if stats.Abandoned > 0 {
+		logx.Logger.Warn("Abandoned queued batches after cancellation",
+			zap.String("table", table),
+			zap.Int64("rows", stats.Abandoned),
+			zap.Int64("inserted", stats.Inserted))
+	}
+
 	if err := <-errChan; err != nil {
-		return err
+		return stats, err
+	}
+	if err := ctx.Err(); err != nil {
+		return stats, err
 	}
 
 	logx.Logger.Info("All batches inserted successfully",
 		zap.String("table", table),
-		zap.Int64("total_rows", totalRows.Load()))
+		zap.Int64("total_rows", stats.Inserted),
+		zap.Int64("dead_lettered", stats.DeadLettered))
 
-	return nil
+	return stats, nil
+}
+
+// send hands v to ch, recording the time spent waiting against stage of m
+func send[T any](ctx context.Context, ch chan<- T, v T, m *metrics.Table, stage string) error {
+	select {
+	case ch <- v:
+		return nil
+	default:
+	}
+	start := time.Now()
+	defer func() { m.Blocked(stage, time.Since(start)) }()
+	select {
+	case ch <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func insertBatch(ctx context.Context, conn *sql.DB, insertPrefix string, batch [][]any, colCount int, table string) error {
-	query := insertPrefix + buildValuesPlaceholders(len(batch), colCount)
+func (b *batchInserter) insert(ctx context.Context, batch [][]any) error {
+	query := b.insertPrefix + buildValuesPlaceholders(len(batch), len(b.columns))
 	args := flatten(batch)
 
-	return Retry(ctx, RetryConfig{
-		MaxAttempts: 4,
-		BaseDelay:   250 * time.Millisecond,
-		MaxDelay:    2 * time.Second,
-		Jitter:      true,
-	}, func() error {
-		_, err := conn.ExecContext(ctx, query, args...)
+	ctx, span := tracing.Tracer().Start(ctx, "insert batch", trace.WithAttributes(
+		tracing.TableKey.String(b.table),
+		tracing.RowsKey.Int(len(batch)),
+	))
+
+	m := b.opts.metrics()
+	retry := b.opts.retryConfig()
+	onRetry := retry.OnRetry
+	retry.OnRetry = func(attempt int, err error) {
+		m.InsertRetried()
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("chug.attempt", attempt),
+			attribute.String("error", err.Error()),
+		))
+		if onRetry != nil {
+			onRetry(attempt, err)
+		}
+	}
+
+	start := time.Now()
+	err := Retry(ctx, retry, func() error {
+		// Pause here while ClickHouse is down instead of burning attempts
+		if err := b.breaker.Wait(ctx); err != nil {
+			return err
+		}
+		_, err := b.conn.ExecContext(ctx, query, args...)
+		RecordHealth(b.breaker, err)
 		return err
 	})
+	if err == nil {
+		m.BatchInserted(time.Since(start))
+	} else if ctx.Err() == nil {
+		m.InsertFailed()
+	}
+	tracing.End(span, err)
+	return err
+}
+
+// insertWithPolicy inserts a batch and, when a dead-letter queue is
+// configured, bisects a failed batch to isolate and dead-letter the bad rows.
+// It returns the rows committed to ClickHouse and the rows written to the
+// dead-letter queue, which are counted even when it fails part way.
+func (b *batchInserter) insertWithPolicy(ctx context.Context, batch [][]any) (inserted, dead int64, err error) {
+	if err := b.opts.control().Wait(ctx); err != nil {
+		return 0, 0, err
+	}
+	// Batches not started yet are abandoned once ctx is cancelled
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	// A batch that has started is flushed even if ctx is cancelled meanwhile
+	flushCtx, stop := flushContext(ctx)
+	defer stop()
+
+	err = b.insert(flushCtx, batch)
+	if err == nil {
+		return int64(len(batch)), 0, nil
+	}
+	if b.opts == nil || b.opts.DLQ == nil || ctx.Err() != nil {
+		return 0, 0, err
+	}
+
+	// Transient failures that survived retries are not caused by bad rows,
+	// so bisecting would only dead-letter good data
+	if ClassifyError(err) != ErrorFatal {
+		return 0, 0, err
+	}
+
+	logx.Logger.Warn("Batch insert failed, isolating bad rows",
+		zap.String("table", b.table),
+		zap.Int("batch_rows", len(batch)),
+		zap.Error(err))
+
+	return b.bisect(ctx, batch, err)
+}
+
+// bisect splits a batch that failed with a fatal error and inserts each half
+// with the same retries and breaker as whole batches, until the rows that
+// still fail on their own are dead-lettered
+func (b *batchInserter) bisect(ctx context.Context, batch [][]any, cause error) (inserted, dead int64, err error) {
+	if len(batch) == 1 {
+		if err := b.opts.DLQ.Write(ctx, b.table, b.columns, batch, cause); err != nil {
+			return 0, 0, fmt.Errorf("failed to write to dead-letter queue: %w", err)
+		}
+		return 0, 1, nil
+	}
+
+	mid := len(batch) / 2
+	for _, half := range [][][]any{batch[:mid], batch[mid:]} {
+		err := b.insert(ctx, half)
+		if err == nil {
+			inserted += int64(len(half))
+			continue
+		}
+		if ctx.Err() != nil {
+			return inserted, dead, ctx.Err()
+		}
+		if ClassifyError(err) != ErrorFatal {
+			return inserted, dead, err
+		}
+
+		n, d, err := b.bisect(ctx, half, err)
+		inserted += n
+		dead += d
+		if err != nil {
+			return inserted, dead, err
+		}
+	}
+	return inserted, dead, nil
 }
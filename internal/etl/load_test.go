@@ -0,0 +1,199 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/pixperk/chug/internal/db"
+	"github.com/pixperk/chug/internal/logx"
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	logx.Logger = zap.NewNop()
+	os.Exit(m.Run())
+}
+
+// fakeConn is a database/sql connection whose Exec fails with the error fail
+// returns for the statement's arguments
+type fakeConn struct {
+	fail func(args []driver.NamedValue) error
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *fakeConn) ExecContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.fail(args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(len(args)), nil
+}
+
+type fakeConnector struct{ conn *fakeConn }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return c.conn, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+// recordingDLQ keeps the rows written to it and fails once failAfter rows were written
+type recordingDLQ struct {
+	mu        sync.Mutex
+	rows      [][]any
+	failAfter int
+}
+
+func (q *recordingDLQ) Write(_ context.Context, _ string, _ []string, rows [][]any, _ error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.failAfter > 0 && len(q.rows) >= q.failAfter {
+		return errors.New("dead-letter queue full")
+	}
+	q.rows = append(q.rows, rows...)
+	return nil
+}
+
+func (q *recordingDLQ) Close() error { return nil }
+
+// badRows fails every statement that inserts one of the given ids
+func badRows(ids ...int64) func(args []driver.NamedValue) error {
+	return func(args []driver.NamedValue) error {
+		for _, arg := range args {
+			if id, ok := arg.Value.(int64); ok && slices.Contains(ids, id) {
+				return &clickhouse.Exception{Code: 53, Message: "type mismatch"}
+			}
+		}
+		return nil
+	}
+}
+
+func testInserter(t *testing.T, fail func(args []driver.NamedValue) error, dlq DeadLetterQueue) *batchInserter {
+	t.Helper()
+	conn := sql.OpenDB(fakeConnector{&fakeConn{fail: fail}})
+	t.Cleanup(func() { conn.Close() })
+	return &batchInserter{
+		conn:         conn,
+		breaker:      db.NewCircuitBreaker("test", db.BreakerConfig{FailureThreshold: 100, MinBackoff: time.Hour, MaxBackoff: time.Hour}, nil),
+		table:        "events",
+		columns:      []string{"id"},
+		insertPrefix: "INSERT INTO events (id) VALUES ",
+		opts: &InsertOptions{
+			Retry: &RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			DLQ:   dlq,
+		},
+	}
+}
+
+func testBatch(n int) [][]any {
+	batch := make([][]any, n)
+	for i := range batch {
+		batch[i] = []any{int64(i)}
+	}
+	return batch
+}
+
+func TestInsertWithPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		fail         func(args []driver.NamedValue) error
+		dlq          *recordingDLQ
+		wantInserted int64
+		wantDead     int64
+		wantErr      bool
+		wantDLQ      [][]any
+	}{
+		{
+			name:         "clean batch",
+			fail:         badRows(),
+			dlq:          &recordingDLQ{},
+			wantInserted: 8,
+		},
+		{
+			name:         "bad rows are isolated",
+			fail:         badRows(2, 5),
+			dlq:          &recordingDLQ{},
+			wantInserted: 6,
+			wantDead:     2,
+			wantDLQ:      [][]any{{int64(2)}, {int64(5)}},
+		},
+		{
+			name:    "no dead-letter queue",
+			fail:    badRows(2),
+			wantErr: true,
+		},
+		{
+			name: "transient failure is not bisected",
+			fail: func([]driver.NamedValue) error {
+				return syscall.ECONNRESET
+			},
+			dlq:     &recordingDLQ{},
+			wantErr: true,
+		},
+		{
+			name:         "rows committed before a failing dead-letter write are counted",
+			fail:         badRows(1, 6),
+			dlq:          &recordingDLQ{failAfter: 1},
+			wantInserted: 5, // rows 0, 2, 3, 4 and 5 before row 6 fails to dead-letter
+			wantDead:     1,
+			wantErr:      true,
+			wantDLQ:      [][]any{{int64(1)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dlq DeadLetterQueue
+			if tt.dlq != nil {
+				dlq = tt.dlq
+			}
+			b := testInserter(t, tt.fail, dlq)
+
+			inserted, dead, err := b.insertWithPolicy(context.Background(), testBatch(8))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if inserted != tt.wantInserted || dead != tt.wantDead {
+				t.Errorf("inserted, dead = %d, %d, want %d, %d", inserted, dead, tt.wantInserted, tt.wantDead)
+			}
+			if tt.dlq != nil && !slices.EqualFunc(tt.dlq.rows, tt.wantDLQ, slices.Equal) {
+				t.Errorf("dead-lettered %v, want %v", tt.dlq.rows, tt.wantDLQ)
+			}
+		})
+	}
+}
+
+func TestDeadLetterLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *InsertOptions
+		dead    int64
+		wantErr bool
+	}{
+		{"nil options", nil, 100, false},
+		{"unlimited", &InsertOptions{}, 100, false},
+		{"at the limit", &InsertOptions{MaxErrors: 10}, 10, false},
+		{"over the limit", &InsertOptions{MaxErrors: 10}, 11, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.deadLetterLimit(tt.dead)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deadLetterLimit(%d) = %v, want error %v", tt.dead, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrDeadLetterLimit) {
+				t.Errorf("error %v does not wrap ErrDeadLetterLimit", err)
+			}
+			if err != nil && ClassifyError(err) != ErrorFatal {
+				t.Errorf("ClassifyError(%v) = %v, want fatal", err, ClassifyError(err))
+			}
+		})
+	}
+}
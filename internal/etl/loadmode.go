@@ -0,0 +1,104 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/db"
+	"github.com/pixperk/chug/internal/logx"
+	"go.uber.org/zap"
+)
+
+// StagingSuffix is appended to a table's name to name the staging table of replace loads
+const StagingSuffix = "__chug_staging"
+
+// StagingTable returns the table a replace load of table inserts into
+func StagingTable(table string) string {
+	return table + StagingSuffix
+}
+
+// loadTable returns the ClickHouse table a load in mode inserts into
+func loadTable(table, mode string) (string, error) {
+	switch mode {
+	case "", config.LoadModeAppend, config.LoadModeTruncate:
+		return table, nil
+	case config.LoadModeReplace:
+		return StagingTable(table), nil
+	default:
+		return "", fmt.Errorf("unknown load mode %q (want append, truncate or replace)", mode)
+	}
+}
+
+// resetTable clears what a load in mode must not keep before the table is
+// created: the rows of table for truncate, and the staging table left by an
+// earlier replace that failed
+func resetTable(ctx context.Context, chURL, table, mode string) error {
+	var stmt string
+	switch mode {
+	case config.LoadModeTruncate:
+		stmt = "TRUNCATE TABLE IF EXISTS " + QuoteIdentifier(table)
+	case config.LoadModeReplace:
+		stmt = "DROP TABLE IF EXISTS " + QuoteIdentifier(StagingTable(table))
+	default:
+		return nil
+	}
+
+	conn, release, err := db.Pools.AcquireClickHouse(chURL)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if _, err := conn.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("failed to reset table: %w", err)
+	}
+	return nil
+}
+
+// swapStaging checks that the staging table of a replace load holds every
+// extracted row that was not dead-lettered, swaps it with table in one step
+// with EXCHANGE TABLES, then drops the previous rows. A table that does not
+// exist yet is renamed into place instead. The staging table is kept when
+// the counts differ.
+func swapStaging(ctx context.Context, chURL, table string, extracted int64, stats InsertStats) error {
+	conn, release, err := db.Pools.AcquireClickHouse(chURL)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	staging := StagingTable(table)
+	var count uint64
+	if err := conn.QueryRowContext(ctx, "SELECT count() FROM "+QuoteIdentifier(staging)).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count staging rows: %w", err)
+	}
+	if want := extracted - stats.DeadLettered; int64(count) != want || stats.Inserted != want {
+		return fmt.Errorf("staging table %s has %d rows, expected %d (%d extracted, %d dead-lettered, %d inserted)",
+			staging, count, want, extracted, stats.DeadLettered, stats.Inserted)
+	}
+
+	_, exists, err := clickHouseEngine(ctx, conn, table)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("RENAME TABLE %s TO %s", QuoteIdentifier(staging), QuoteIdentifier(table))); err != nil {
+			return fmt.Errorf("failed to rename staging table: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("EXCHANGE TABLES %s AND %s", QuoteIdentifier(table), QuoteIdentifier(staging))); err != nil {
+		return fmt.Errorf("failed to exchange tables: %w", err)
+	}
+	// The new rows are live, so failing to drop the old ones only costs space
+	// until the next replace drops them
+	if _, err := conn.ExecContext(ctx, "DROP TABLE IF EXISTS "+QuoteIdentifier(staging)); err != nil {
+		logx.Logger.Warn("Failed to drop the replaced rows",
+			zap.String("table", table),
+			zap.String("staging_table", staging),
+			zap.Error(err))
+	}
+	return nil
+}
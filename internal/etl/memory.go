@@ -0,0 +1,82 @@
+package etl
+
+import (
+	"context"
+	"time"
+
+	"github.com/pixperk/chug/internal/metrics"
+	"golang.org/x/sync/semaphore"
+)
+
+// MemoryBudget bounds the bytes of rows held between extraction and
+// insertion, shared by every table loading at the same time. Extractors
+// reserve each row before handing it on and wait while the budget is spent;
+// insert workers return a batch's bytes once it is written or given up.
+// Sizes are approximate, see rowSize. A nil *MemoryBudget is unbounded.
+type MemoryBudget struct {
+	sem   *semaphore.Weighted
+	limit int64
+}
+
+// NewMemoryBudget returns a budget of limit bytes
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	metrics.SetMemoryBudget(limit)
+	return &MemoryBudget{sem: semaphore.NewWeighted(limit), limit: limit}
+}
+
+// Limit returns the size of the budget in bytes, 0 when unbounded
+func (b *MemoryBudget) Limit() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.limit
+}
+
+// cost is the bytes a row of size bytes reserves. A row larger than the
+// whole budget takes all of it rather than waiting forever.
+func (b *MemoryBudget) cost(size int64) int64 {
+	if b == nil {
+		return 0
+	}
+	return min(size, b.limit)
+}
+
+// reserve takes n bytes, waiting until they are free or ctx ends. Time spent
+// waiting is recorded against the memory stage of m.
+func (b *MemoryBudget) reserve(ctx context.Context, n int64, m *metrics.Table) error {
+	if b == nil || n == 0 {
+		return nil
+	}
+	if !b.sem.TryAcquire(n) {
+		start := time.Now()
+		err := b.sem.Acquire(ctx, n)
+		m.Blocked(metrics.StageMemory, time.Since(start))
+		if err != nil {
+			return err
+		}
+	}
+	metrics.MemoryBuffered(n)
+	return nil
+}
+
+// release returns n bytes taken by reserve
+func (b *MemoryBudget) release(n int64) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.sem.Release(n)
+	metrics.MemoryBuffered(-n)
+}
+
+// drain releases the rows left in rows in the background, for a consumer
+// that gives up before rows is closed
+func (b *MemoryBudget) drain(rows <-chan []any) {
+	if b == nil {
+		return
+	}
+	go func() {
+		for row := range rows {
+			b.release(b.cost(rowSize(row)))
+		}
+	}()
+}
@@ -0,0 +1,194 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/api/types"
+	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/db"
+)
+
+// ErrTableNotFound is returned by PlanTable for tables PostgreSQL does not have
+var ErrTableNotFound = errors.New("table not found in PostgreSQL")
+
+// lossyTypes explains PostgreSQL types whose ClickHouse mapping may lose data
+var lossyTypes = map[string]string{
+	"numeric":                     "exact decimal stored as Float64, precision beyond ~15 digits is lost",
+	"decimal":                     "exact decimal stored as Float64, precision beyond ~15 digits is lost",
+	"timestamp":                   "DateTime keeps whole seconds and years 1970-2106",
+	"timestamp without time zone": "DateTime keeps whole seconds and years 1970-2106",
+	"timestamp with time zone":    "DateTime keeps whole seconds and years 1970-2106, the offset is not kept",
+	"date":                        "Date keeps years 1970-2149",
+	"bytea":                       "only 16-byte values fit UUID, other values fail to insert",
+	"USER-DEFINED":                "enum and composite values are stored as text",
+}
+
+// Column differences between the planned and an existing ClickHouse table
+const (
+	ColumnMissing  = "missing"  // planned, not in the existing table: inserts will fail
+	ColumnExtra    = "extra"    // in the existing table only: filled with defaults
+	ColumnMismatch = "mismatch" // types differ: inserts may fail or convert
+)
+
+// Preview results are defined with the API's wire types
+type (
+	ColumnPlan = types.ColumnPlan
+	ColumnDiff = types.ColumnDiff
+	TablePlan  = types.TablePlan
+)
+
+// PlanTable runs the discovery steps of IngestSingleTable and builds its DDL
+// without executing it. An empty chURL skips the comparison with ClickHouse.
+func PlanTable(ctx context.Context, pgConn *pgxpool.Pool, chURL string, tableConfig config.ResolvedTableConfig) (*TablePlan, error) {
+	cols, err := getColumns(ctx, pgConn, tableConfig.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("%s: %w", tableConfig.Name, ErrTableNotFound)
+	}
+
+	pkCols, err := GetPrimaryKeyColumns(ctx, pgConn, tableConfig.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query primary key: %w", err)
+	}
+
+	plan := &TablePlan{Table: tableConfig.Name, PrimaryKey: pkCols, Engine: "MergeTree"}
+	planned := make(map[string]string, len(cols)+1) // column -> ClickHouse type
+	var order []string
+	for _, col := range cols {
+		column := ColumnPlan{Name: col.Name, PostgresType: col.Type}
+		if chType, ok := pgToCHType[col.Type]; ok {
+			column.ClickHouseType = chType
+			column.Warning = lossyTypes[col.Type]
+			planned[col.Name] = chType
+			order = append(order, col.Name)
+		} else {
+			column.Warning = "unsupported type, ingestion will fail"
+		}
+		plan.Columns = append(plan.Columns, column)
+	}
+
+	cdc := tableConfig.Polling.Enabled
+	if cdc {
+		if tableConfig.Polling.DeltaCol == "" {
+			plan.Warnings = append(plan.Warnings, "polling is enabled without a delta column")
+		} else {
+			plan.Engine = "ReplacingMergeTree"
+			planned["_dedup_key"] = "UInt64"
+			order = append(order, "_dedup_key")
+			if len(pkCols) == 0 {
+				plan.Warnings = append(plan.Warnings, "no primary key, the dedup key hashes every column")
+			}
+		}
+	}
+
+	// Same arguments as IngestSingleTable, which only looks up the key for CDC
+	var ddlPK []string
+	if cdc {
+		ddlPK = pkCols
+	}
+	if plan.DDL, err = BuildDDLQuery(tableConfig.Name, cols, cdc, tableConfig.Polling.DeltaCol, ddlPK); err != nil {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("DDL generation failed: %v", err))
+	}
+
+	if plan.EstimatedRows, err = estimateRows(ctx, pgConn, tableConfig.Name); err != nil {
+		return nil, err
+	}
+
+	if chURL == "" {
+		plan.Warnings = append(plan.Warnings, "no ClickHouse connection, the existing table was not checked")
+		return plan, nil
+	}
+	if err := diffExistingTable(ctx, chURL, plan, planned, order); err != nil {
+		return nil, err
+	}
+	if plan.Exists {
+		switch tableConfig.LoadMode {
+		case config.LoadModeTruncate:
+			plan.Warnings = append(plan.Warnings, "load_mode truncate deletes the existing rows before loading")
+		case config.LoadModeReplace:
+			plan.Warnings = append(plan.Warnings, "load_mode replace loads a new table from this DDL and swaps it in, the existing rows are dropped")
+		}
+	}
+	return plan, nil
+}
+
+// estimateRows reads the planner's row estimate, -1 when there is none
+func estimateRows(ctx context.Context, pgConn *pgxpool.Pool, table string) (int64, error) {
+	var estimate *float64
+	err := pgConn.QueryRow(ctx, `SELECT reltuples::float8 FROM pg_class WHERE oid = to_regclass($1)`, table).Scan(&estimate)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && estimate == nil) {
+		return -1, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate rows: %w", err)
+	}
+	if *estimate < 0 {
+		return -1, nil
+	}
+	return int64(*estimate), nil
+}
+
+// diffExistingTable compares the planned columns with the ClickHouse table of
+// the same name, if there is one
+func diffExistingTable(ctx context.Context, chURL string, plan *TablePlan, planned map[string]string, order []string) error {
+	conn, release, err := db.Pools.AcquireClickHouse(chURL)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if plan.ExistingEngine, plan.Exists, err = clickHouseEngine(ctx, conn, plan.Table); err != nil || !plan.Exists {
+		return err
+	}
+	if plan.ExistingEngine != plan.Engine {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("existing table uses %s, chug would create %s", plan.ExistingEngine, plan.Engine))
+	}
+
+	rows, err := conn.QueryContext(ctx,
+		`SELECT name, type FROM system.columns WHERE database = currentDatabase() AND table = ? ORDER BY position`,
+		plan.Table)
+	if err != nil {
+		return fmt.Errorf("failed to query ClickHouse columns: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name, chType string
+		if err := rows.Scan(&name, &chType); err != nil {
+			return fmt.Errorf("failed to scan ClickHouse column: %w", err)
+		}
+		existing[name] = true
+		want, ok := planned[name]
+		switch {
+		case !ok:
+			plan.Diff = append(plan.Diff, ColumnDiff{Name: name, Change: ColumnExtra, Existing: chType})
+		case want != chType:
+			plan.Diff = append(plan.Diff, ColumnDiff{Name: name, Change: ColumnMismatch, Planned: want, Existing: chType})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating ClickHouse columns: %w", err)
+	}
+
+	for _, name := range order {
+		if !existing[name] {
+			plan.Diff = append(plan.Diff, ColumnDiff{Name: name, Change: ColumnMissing, Planned: planned[name]})
+		}
+	}
+	if len(plan.Diff) > 0 {
+		changes := make([]string, len(plan.Diff))
+		for i, d := range plan.Diff {
+			changes[i] = d.Name + " (" + d.Change + ")"
+		}
+		plan.Warnings = append(plan.Warnings, "existing table differs and is not altered: "+strings.Join(changes, ", "))
+	}
+	return nil
+}
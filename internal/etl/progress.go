@@ -0,0 +1,143 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/internal/logx"
+	"go.uber.org/zap"
+)
+
+// TableProgress is a progress report of a table's initial load
+type TableProgress struct {
+	Extracted      int64         // rows read from PostgreSQL
+	Inserted       int64         // rows committed to ClickHouse
+	Total          int64         // expected rows, 0 = unknown
+	TotalEstimated bool          // Total is the planner's estimate rather than a count
+	Percentage     float64       // Inserted of Total, 0 when Total is unknown
+	RowsPerSec     float64       // rows inserted per second since insertion started
+	BytesPerSec    float64       // approximate uncompressed bytes inserted per second
+	ETA            time.Duration // 0 when Total or the rate is unknown
+	Phase          string
+}
+
+// progressTracker counts the rows of one table's initial load
+type progressTracker struct {
+	start          time.Time
+	total          atomic.Int64
+	estimated      atomic.Bool
+	extracted      atomic.Int64
+	extractedBytes atomic.Int64
+	inserted       atomic.Int64
+}
+
+// extract counts a row of size bytes read from PostgreSQL
+func (t *progressTracker) extract(size int64) {
+	t.extracted.Add(1)
+	t.extractedBytes.Add(size)
+}
+
+func (t *progressTracker) report(phase string) TableProgress {
+	p := TableProgress{
+		Extracted:      t.extracted.Load(),
+		Inserted:       t.inserted.Load(),
+		Total:          t.total.Load(),
+		TotalEstimated: t.estimated.Load(),
+		Phase:          phase,
+	}
+	// A stale estimate can be below what was already read
+	if p.Total > 0 && p.Extracted > p.Total {
+		p.Total = p.Extracted
+	}
+
+	if elapsed := time.Since(t.start).Seconds(); elapsed > 0 {
+		p.RowsPerSec = float64(p.Inserted) / elapsed
+		if p.Extracted > 0 {
+			avgRowBytes := float64(t.extractedBytes.Load()) / float64(p.Extracted)
+			p.BytesPerSec = p.RowsPerSec * avgRowBytes
+		}
+	}
+	if p.Total > 0 {
+		p.Percentage = min(float64(p.Inserted)/float64(p.Total)*100, 100)
+		if remaining := p.Total - p.Inserted; remaining > 0 && p.RowsPerSec > 0 {
+			p.ETA = time.Duration(float64(remaining) / p.RowsPerSec * float64(time.Second))
+		}
+	}
+	return p
+}
+
+// expectTotal sets the expected row count of the load: the planner's
+// estimate at once and, with exact, the result of COUNT(*) once it returns.
+// Failures leave the total unknown rather than failing the load.
+func (t *progressTracker) expectTotal(ctx context.Context, pgConn *pgxpool.Pool, table string, limit int, exact bool) {
+	estimate, err := estimateRows(ctx, pgConn, table)
+	if err != nil {
+		logx.Logger.Warn("Row estimate failed, progress has no total", zap.String("table", table), zap.Error(err))
+	}
+	switch {
+	case estimate > 0 && limit > 0:
+		t.total.Store(min(estimate, int64(limit)))
+		t.estimated.Store(true)
+	case estimate > 0:
+		t.total.Store(estimate)
+		t.estimated.Store(true)
+	case limit > 0:
+		t.total.Store(int64(limit))
+		t.estimated.Store(true)
+	}
+
+	if !exact {
+		return
+	}
+	go func() {
+		count, err := countRows(ctx, pgConn, table, limit)
+		if err != nil {
+			if ctx.Err() == nil {
+				logx.Logger.Warn("Exact row count failed, keeping the estimate", zap.String("table", table), zap.Error(err))
+			}
+			return
+		}
+		t.total.Store(count)
+		t.estimated.Store(false)
+	}()
+}
+
+// countRows counts the rows a load of table reads, at most limit when limit > 0
+func countRows(ctx context.Context, pgConn *pgxpool.Pool, table string, limit int) (int64, error) {
+	query := "SELECT count(*) FROM " + pgx.Identifier{table}.Sanitize()
+	if limit > 0 {
+		query = fmt.Sprintf("SELECT count(*) FROM (SELECT 1 FROM %s LIMIT %d) t", pgx.Identifier{table}.Sanitize(), limit)
+	}
+	var count int64
+	if err := pgConn.QueryRow(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count rows: %w", err)
+	}
+	return count, nil
+}
+
+// rowSize approximates the uncompressed size of a row in ClickHouse
+func rowSize(row []any) int64 {
+	var size int64
+	for _, value := range row {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			size += int64(len(v))
+		case []byte:
+			size += int64(len(v))
+		case bool, int8, uint8:
+			size++
+		case int16, uint16:
+			size += 2
+		case int32, uint32, float32:
+			size += 4
+		default:
+			size += 8
+		}
+	}
+	return size
+}
@@ -2,44 +2,96 @@ package etl
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"math"
 	"math/rand"
 	"time"
 
+	"github.com/pixperk/chug/internal/config"
 	"github.com/pixperk/chug/internal/logx"
 	"go.uber.org/zap"
 )
 
 type RetryConfig struct {
-	MaxAttempts int
-	BaseDelay   time.Duration
-	MaxDelay    time.Duration
-	Jitter      bool
+	MaxAttempts   int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	ThrottleDelay time.Duration // minimum wait when the server asks us to slow down
+	Jitter        bool
+	Classify      func(error) ErrorClass       // defaults to ClassifyError
+	OnRetry       func(attempt int, err error) // called before waiting for each retry
+}
+
+// DefaultRetryConfig is used when no retry policy is configured
+var DefaultRetryConfig = RetryConfig{
+	MaxAttempts:   4,
+	BaseDelay:     250 * time.Millisecond,
+	MaxDelay:      2 * time.Second,
+	ThrottleDelay: 5 * time.Second,
+	Jitter:        true,
+}
+
+// RetryConfigFromPolicy converts a resolved config.RetryPolicy into a RetryConfig
+func RetryConfigFromPolicy(p config.RetryPolicy) RetryConfig {
+	rc := DefaultRetryConfig
+	if p.MaxAttempts > 0 {
+		rc.MaxAttempts = p.MaxAttempts
+	}
+	if p.BaseDelayMs > 0 {
+		rc.BaseDelay = time.Duration(p.BaseDelayMs) * time.Millisecond
+	}
+	if p.MaxDelayMs > 0 {
+		rc.MaxDelay = time.Duration(p.MaxDelayMs) * time.Millisecond
+	}
+	if p.ThrottleDelayMs > 0 {
+		rc.ThrottleDelay = time.Duration(p.ThrottleDelayMs) * time.Millisecond
+	}
+	if p.Jitter != nil {
+		rc.Jitter = *p.Jitter
+	}
+	return rc
 }
 
 func Retry(ctx context.Context, config RetryConfig, operation func() error) error {
+	classify := config.Classify
+	if classify == nil {
+		classify = ClassifyError
+	}
+
 	var attempt int
 	for {
 		err := operation()
 		if err == nil {
 			return nil
 		}
+
+		class := classify(err)
+		if class == ErrorFatal {
+			return err
+		}
+
 		attempt++
 		if attempt >= config.MaxAttempts {
-			return errors.New("max retry attempts reached: " + err.Error())
+			return fmt.Errorf("max retry attempts reached: %w", err)
 		}
 
 		//Exponential backoff with jitter
 		backoff := min(config.BaseDelay*time.Duration(math.Pow(2, float64(attempt))), config.MaxDelay)
-		if config.Jitter {
+		if class == ErrorThrottled {
+			backoff = max(backoff, config.ThrottleDelay)
+		}
+		if config.Jitter && backoff > 1 {
 			jitter := time.Duration(rand.Int63n(int64(backoff / 2)))
 			backoff += jitter
 		}
 
+		if config.OnRetry != nil {
+			config.OnRetry(attempt, err)
+		}
 		logx.Logger.Warn("Operation failed, retrying",
 			zap.Int("attempt", attempt),
 			zap.Error(err),
+			zap.Stringer("class", class),
 			zap.Duration("backoff", backoff),
 		)
 		select {
@@ -0,0 +1,702 @@
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/api/types"
+	"github.com/pixperk/chug/internal/config"
+	"github.com/pixperk/chug/internal/db"
+	"github.com/pixperk/chug/internal/logx"
+	"go.uber.org/zap"
+)
+
+// DefaultVerifyChunkRows is how many PostgreSQL rows one checksum range covers
+const DefaultVerifyChunkRows = 100000
+
+// floatTolerance is the relative difference allowed between float aggregates,
+// which ClickHouse and PostgreSQL sum in different orders and precisions
+const floatTolerance = 1e-6
+
+// VerifyOptions controls VerifyTable
+type VerifyOptions struct {
+	ChunkRows int            // rows per checksum range, default DefaultVerifyChunkRows
+	Repair    bool           // re-ingest mismatching ranges
+	BatchSize int            // rows per insert when repairing, default 500
+	Insert    *InsertOptions // retry, DLQ and metrics of repair inserts
+}
+
+// Verification results are defined with the API's wire types
+type (
+	AggregateCheck = types.AggregateCheck
+	RangeCheck     = types.RangeCheck
+	VerifyReport   = types.VerifyReport
+)
+
+// column classes decide which aggregates are compared and how
+const (
+	classNone = iota
+	classInt
+	classFloat
+	classDate
+	classTime
+	classText
+	classBool
+)
+
+func columnClass(pgType string) int {
+	switch pgType {
+	case "smallint", "integer", "bigint", "serial", "bigserial":
+		return classInt
+	case "numeric", "decimal", "real", "double precision":
+		return classFloat
+	case "date":
+		return classDate
+	case "timestamp", "timestamp without time zone", "timestamp with time zone":
+		return classTime
+	case "text", "varchar", "character varying", "char", "character":
+		return classText
+	case "boolean":
+		return classBool
+	default:
+		return classNone
+	}
+}
+
+// verifier holds what VerifyTable needs across its steps
+type verifier struct {
+	table     string
+	pg        *pgxpool.Pool
+	ch        *sql.DB
+	cols      []Column // compared columns, present on both sides
+	pk        string
+	chunkRows int
+	final     string // " FINAL" or ""
+	pgFrom    string
+	chFrom    string
+	results   *VerifyReport
+}
+
+// VerifyTable compares a PostgreSQL table with its ClickHouse copy: row
+// counts, per-column aggregates and, for tables with a single integer primary
+// key, checksums of ranges of ChunkRows rows. With opts.Repair, rows of
+// mismatching ranges are deleted from ClickHouse and copied again.
+//
+// Rows written to PostgreSQL while verifying show up as mismatches.
+func VerifyTable(ctx context.Context, pgConn *pgxpool.Pool, chURL string, tableConfig config.ResolvedTableConfig, opts VerifyOptions) (*VerifyReport, error) {
+	start := time.Now()
+	if opts.ChunkRows <= 0 {
+		opts.ChunkRows = DefaultVerifyChunkRows
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+
+	chConn, release, err := db.Pools.AcquireClickHouse(chURL)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	v := &verifier{
+		table:     tableConfig.Name,
+		pg:        pgConn,
+		ch:        chConn,
+		chunkRows: opts.ChunkRows,
+		pgFrom:    " FROM " + pgx.Identifier{tableConfig.Name}.Sanitize(),
+		results:   &VerifyReport{Table: tableConfig.Name},
+	}
+	if err := v.discover(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := v.aggregates(ctx); err != nil {
+		return nil, err
+	}
+	if v.pk != "" {
+		if err := v.checksums(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Repair && len(v.results.Mismatches) > 0 {
+		for i := range v.results.Mismatches {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if v.repair(ctx, chURL, &v.results.Mismatches[i], opts) {
+				v.results.Warnings = append(v.results.Warnings, fmt.Sprintf(
+					"range %s was deleted from ClickHouse and not fully copied again, repair stopped; run it again",
+					v.results.Mismatches[i].String()))
+				break
+			}
+		}
+		// Counts and aggregates again, now that ranges were rewritten
+		v.results.Aggregates = nil
+		if err := v.aggregates(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	report := v.results
+	report.Match = report.PostgresRows == report.ClickHouseRows
+	for _, check := range report.Aggregates {
+		report.Match = report.Match && check.Match
+	}
+	for _, mismatch := range report.Mismatches {
+		report.Match = report.Match && mismatch.Repaired
+	}
+	report.Duration = time.Since(start).String()
+	return report, nil
+}
+
+// discover finds the columns both sides have, the primary key used for
+// checksums and whether ClickHouse must be read with FINAL
+func (v *verifier) discover(ctx context.Context) error {
+	cols, err := getColumns(ctx, v.pg, v.table)
+	if err != nil {
+		return err
+	}
+	if len(cols) == 0 {
+		return fmt.Errorf("%s: %w", v.table, ErrTableNotFound)
+	}
+
+	engine, exists, err := clickHouseEngine(ctx, v.ch, v.table)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("ClickHouse table %s does not exist", v.table)
+	}
+	if strings.Contains(engine, "ReplacingMergeTree") {
+		v.final = " FINAL"
+		v.results.Final = true
+	}
+	v.chFrom = " FROM " + QuoteIdentifier(v.table) + v.final
+
+	chCols := make(map[string]bool)
+	rows, err := v.ch.QueryContext(ctx,
+		`SELECT name FROM system.columns WHERE database = currentDatabase() AND table = ?`, v.table)
+	if err != nil {
+		return fmt.Errorf("failed to query ClickHouse columns: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("failed to scan ClickHouse column: %w", err)
+		}
+		chCols[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating ClickHouse columns: %w", err)
+	}
+
+	for _, col := range cols {
+		if !chCols[col.Name] {
+			v.results.Warnings = append(v.results.Warnings, fmt.Sprintf("column %s is missing in ClickHouse, not compared", col.Name))
+			continue
+		}
+		v.cols = append(v.cols, col)
+	}
+
+	pkCols, err := GetPrimaryKeyColumns(ctx, v.pg, v.table)
+	if err != nil {
+		return fmt.Errorf("failed to query primary key: %w", err)
+	}
+	if len(pkCols) == 1 && chCols[pkCols[0]] {
+		for _, col := range cols {
+			if col.Name == pkCols[0] && columnClass(col.Type) == classInt {
+				v.pk = col.Name
+			}
+		}
+	}
+	if v.pk == "" {
+		v.results.Warnings = append(v.results.Warnings, "checksums need a single integer primary key, only counts and aggregates were compared")
+	}
+	v.results.PrimaryKey = v.pk
+	return nil
+}
+
+// aggregates compares row counts and the aggregates of each column class in
+// one scan of each side
+func (v *verifier) aggregates(ctx context.Context) error {
+	pgExprs := []string{"count(*)::text"}
+	chExprs := []string{"toString(count())"}
+	type pending struct {
+		column, aggregate string
+		class             int
+	}
+	var checks []pending
+
+	for _, col := range v.cols {
+		class := columnClass(col.Type)
+		if class == classNone {
+			continue
+		}
+		pgCol, chCol := pgx.Identifier{col.Name}.Sanitize(), QuoteIdentifier(col.Name)
+		pgDefault, chDefault := aggregateDefaults(class)
+
+		pgExprs = append(pgExprs, fmt.Sprintf("(count(*) FILTER (WHERE %s IS NULL OR %s = %s))::text", pgCol, pgCol, pgDefault))
+		chExprs = append(chExprs, fmt.Sprintf("toString(countIf(%s = %s))", chCol, chDefault))
+		checks = append(checks, pending{col.Name, "null_or_default", classInt})
+
+		value := fmt.Sprintf("COALESCE(%s, %s)", pgCol, pgDefault)
+		switch class {
+		case classInt, classFloat:
+			for _, agg := range []string{"min", "max", "sum"} {
+				pgExprs = append(pgExprs, fmt.Sprintf("%s(%s::float8)::text", agg, value))
+				if class == classInt {
+					pgExprs[len(pgExprs)-1] = fmt.Sprintf("%s(%s)::text", agg, value)
+				}
+				chExprs = append(chExprs, fmt.Sprintf("toString(%s(%s))", agg, chCol))
+				checks = append(checks, pending{col.Name, agg, class})
+			}
+		case classDate:
+			for _, agg := range []string{"min", "max"} {
+				pgExprs = append(pgExprs, fmt.Sprintf("(%s(%s) - DATE 'epoch')::text", agg, value))
+				chExprs = append(chExprs, fmt.Sprintf("toString(dateDiff('day', toDate(0), %s(%s)))", agg, chCol))
+				checks = append(checks, pending{col.Name, agg, classInt})
+			}
+		case classTime:
+			for _, agg := range []string{"min", "max"} {
+				pgExprs = append(pgExprs, fmt.Sprintf("floor(extract(epoch FROM %s(%s)))::bigint::text", agg, value))
+				chExprs = append(chExprs, fmt.Sprintf("toString(toUnixTimestamp(%s(%s)))", agg, chCol))
+				checks = append(checks, pending{col.Name, agg, classInt})
+			}
+		}
+	}
+
+	pgValues := make([]*string, len(pgExprs))
+	chValues := make([]*string, len(chExprs))
+	pgDest, chDest := make([]any, len(pgExprs)), make([]any, len(chExprs))
+	for i := range pgValues {
+		pgDest[i], chDest[i] = &pgValues[i], &chValues[i]
+	}
+	if err := v.pg.QueryRow(ctx, "SELECT "+strings.Join(pgExprs, ", ")+v.pgFrom).Scan(pgDest...); err != nil {
+		return fmt.Errorf("failed to aggregate PostgreSQL table: %w", err)
+	}
+	if err := v.ch.QueryRowContext(ctx, "SELECT "+strings.Join(chExprs, ", ")+v.chFrom).Scan(chDest...); err != nil {
+		return fmt.Errorf("failed to aggregate ClickHouse table: %w", err)
+	}
+
+	v.results.PostgresRows, _ = strconv.ParseInt(deref(pgValues[0]), 10, 64)
+	v.results.ClickHouseRows, _ = strconv.ParseInt(deref(chValues[0]), 10, 64)
+	if v.results.PostgresRows == 0 {
+		// Aggregates of an empty table are NULL on one side and defaults on the other
+		return nil
+	}
+	for i, check := range checks {
+		pgValue, chValue := deref(pgValues[i+1]), deref(chValues[i+1])
+		v.results.Aggregates = append(v.results.Aggregates, AggregateCheck{
+			Column:     check.column,
+			Aggregate:  check.aggregate,
+			Postgres:   pgValue,
+			ClickHouse: chValue,
+			Match:      aggregatesMatch(check.class, pgValue, chValue),
+		})
+	}
+	return nil
+}
+
+// aggregateDefaults returns the value a NULL becomes in ClickHouse, as a
+// PostgreSQL and a ClickHouse expression
+func aggregateDefaults(class int) (pg, ch string) {
+	switch class {
+	case classDate:
+		return "'epoch'", "toDate(0)"
+	case classTime:
+		return "'epoch'", "toDateTime(0)"
+	case classText:
+		return "''", "''"
+	case classBool:
+		return "false", "false"
+	default:
+		return "0", "0"
+	}
+}
+
+func aggregatesMatch(class int, pgValue, chValue string) bool {
+	if class != classFloat {
+		return pgValue == chValue
+	}
+	a, errA := strconv.ParseFloat(pgValue, 64)
+	b, errB := strconv.ParseFloat(chValue, 64)
+	if errA != nil || errB != nil {
+		return pgValue == chValue
+	}
+	return math.Abs(a-b) <= floatTolerance*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// checksums splits the primary key into ranges of ChunkRows PostgreSQL rows
+// and compares the row checksums of each range
+func (v *verifier) checksums(ctx context.Context) error {
+	pkCol := pgx.Identifier{v.pk}.Sanitize()
+	boundsQuery := "SELECT " + pkCol + v.pgFrom + " WHERE " + pkCol + " > $1 ORDER BY " + pkCol + " OFFSET $2 LIMIT 1"
+
+	var from *int64
+	for {
+		var to *int64
+		last := int64(math.MinInt64)
+		if from != nil {
+			last = *from
+		}
+		var bound int64
+		err := v.pg.QueryRow(ctx, boundsQuery, last, v.chunkRows-1).Scan(&bound)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			// The last range is open, so rows only ClickHouse has are caught
+		case err != nil:
+			return fmt.Errorf("failed to find checksum range: %w", err)
+		default:
+			to = &bound
+		}
+
+		check, err := v.compareRange(ctx, from, to)
+		if err != nil {
+			return err
+		}
+		v.results.Ranges++
+		if check != nil {
+			v.results.Mismatches = append(v.results.Mismatches, *check)
+		}
+		if to == nil {
+			return nil
+		}
+		from = to
+	}
+}
+
+// compareRange returns a RangeCheck when the checksums of (from, to] differ
+func (v *verifier) compareRange(ctx context.Context, from, to *int64) (*RangeCheck, error) {
+	pgCount, pgSum, err := v.pgChecksum(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	chCount, chSum, err := v.chChecksum(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if pgCount == chCount && pgSum == chSum {
+		return nil, nil
+	}
+	return &RangeCheck{From: from, To: to, PostgresRows: pgCount, ClickHouseRows: chCount}, nil
+}
+
+func (v *verifier) selectList(quote func(string) string) string {
+	names := make([]string, len(v.cols))
+	for i, col := range v.cols {
+		names[i] = quote(col.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func (v *verifier) pgChecksum(ctx context.Context, from, to *int64) (int64, uint64, error) {
+	where, args := pgRangeCondition(v.pk, from, to)
+	rows, err := v.pg.Query(ctx, "SELECT "+v.selectList(func(name string) string {
+		return pgx.Identifier{name}.Sanitize()
+	})+v.pgFrom+where, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read PostgreSQL range: %w", err)
+	}
+	defer rows.Close()
+
+	var count int64
+	var sum uint64
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read PostgreSQL row: %w", err)
+		}
+		sum += v.rowHash(values)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error iterating PostgreSQL range: %w", err)
+	}
+	return count, sum, nil
+}
+
+func (v *verifier) chChecksum(ctx context.Context, from, to *int64) (int64, uint64, error) {
+	where, args := chRangeCondition(v.pk, from, to)
+	rows, err := v.ch.QueryContext(ctx, "SELECT "+v.selectList(QuoteIdentifier)+v.chFrom+where, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read ClickHouse range: %w", err)
+	}
+	defer rows.Close()
+
+	values := make([]any, len(v.cols))
+	dest := make([]any, len(v.cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var count int64
+	var sum uint64
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return 0, 0, fmt.Errorf("failed to read ClickHouse row: %w", err)
+		}
+		sum += v.rowHash(values)
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error iterating ClickHouse range: %w", err)
+	}
+	return count, sum, nil
+}
+
+// rowHash hashes the canonical form of a row. Rows are summed, so the order
+// in which each side returns them does not matter.
+func (v *verifier) rowHash(values []any) uint64 {
+	h := fnv.New64a()
+	for i, value := range values {
+		h.Write([]byte(canonicalValue(v.cols[i].Type, value)))
+		h.Write([]byte{0x1f})
+	}
+	return h.Sum64()
+}
+
+// canonicalValue renders a value read from either database the same way.
+// NULLs and zero values are both "", since chug stores NULLs as ClickHouse
+// defaults; timestamps compare to the second like DateTime.
+func canonicalValue(pgType string, value any) string {
+	if value == nil {
+		return ""
+	}
+	if ptr := reflect.ValueOf(value); ptr.Kind() == reflect.Pointer {
+		if ptr.IsNil() {
+			return ""
+		}
+		value = ptr.Elem().Interface()
+	}
+
+	switch v := value.(type) {
+	case string:
+		if pgType == "json" || pgType == "jsonb" {
+			var parsed any
+			if json.Unmarshal([]byte(v), &parsed) == nil {
+				return canonicalValue(pgType, parsed)
+			}
+		}
+		return v
+	case []byte:
+		return canonicalValue(pgType, string(v))
+	case bool:
+		if v {
+			return "1"
+		}
+		return ""
+	case float32:
+		return canonicalFloat(float64(v), 6)
+	case float64:
+		return canonicalFloat(v, 15)
+	case pgtype.Numeric:
+		f, err := v.Float64Value()
+		if err != nil || !f.Valid {
+			return ""
+		}
+		return canonicalFloat(f.Float64, 15)
+	case time.Time:
+		if columnClass(pgType) == classDate {
+			if v.IsZero() || v.Format(time.DateOnly) == "1970-01-01" {
+				return ""
+			}
+			return v.Format(time.DateOnly)
+		}
+		if v.IsZero() || v.Unix() == 0 {
+			return ""
+		}
+		return strconv.FormatInt(v.Unix(), 10)
+	case map[string]any, []any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Int() == 0 {
+			return ""
+		}
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() == 0 {
+			return ""
+		}
+		return strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Array:
+		// UUIDs: [16]byte from pgx, uuid.UUID from clickhouse-go
+		if rv.Len() == 16 && rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, 16)
+			reflect.Copy(reflect.ValueOf(b), rv)
+			if rv.IsZero() {
+				return ""
+			}
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+		}
+	}
+	return fmt.Sprint(value)
+}
+
+func canonicalFloat(f float64, digits int) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'g', digits, 64)
+}
+
+// pgRangeCondition is the WHERE clause selecting (from, to] of pkCol
+func pgRangeCondition(pkCol string, from, to *int64) (string, []any) {
+	col := pgx.Identifier{pkCol}.Sanitize()
+	var conds []string
+	var args []any
+	if from != nil {
+		args = append(args, *from)
+		conds = append(conds, fmt.Sprintf("%s > $%d", col, len(args)))
+	}
+	if to != nil {
+		args = append(args, *to)
+		conds = append(conds, fmt.Sprintf("%s <= $%d", col, len(args)))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func chRangeCondition(pkCol string, from, to *int64) (string, []any) {
+	col := QuoteIdentifier(pkCol)
+	var conds []string
+	var args []any
+	if from != nil {
+		conds = append(conds, col+" > ?")
+		args = append(args, *from)
+	}
+	if to != nil {
+		conds = append(conds, col+" <= ?")
+		args = append(args, *to)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// repair copies a mismatching range again from PostgreSQL and checks it once
+// more. The ClickHouse rows of the range are deleted only once PostgreSQL has
+// started returning the range, so a failing query leaves them as they were.
+// It reports whether the range was left emptied or partly reloaded, in which
+// case no further range should be repaired.
+func (v *verifier) repair(ctx context.Context, chURL string, check *RangeCheck, opts VerifyOptions) (emptied bool) {
+	logx.Logger.Info("Repairing range",
+		zap.String("table", v.table),
+		zap.String("range", check.String()),
+		zap.Int64("pg_rows", check.PostgresRows),
+		zap.Int64("ch_rows", check.ClickHouseRows))
+
+	fail := func(err error) {
+		check.RepairError = err.Error()
+		logx.Logger.Warn("Range repair failed", zap.String("table", v.table), zap.String("range", check.String()), zap.Error(err))
+	}
+
+	// Stops the extract when the repair gives up before reading every row
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	memory := opts.Insert.memory()
+	stream, err := ExtractTableRangeStreaming(ctx, v.pg, v.table, v.pk, check.From, check.To,
+		&StreamOptions{Memory: memory, Metrics: opts.Insert.metrics()})
+	if err != nil {
+		fail(err)
+		return false
+	}
+	first, ok := <-stream.RowChan
+	if !ok {
+		if err := <-stream.ErrChan; err != nil {
+			fail(err)
+			return false
+		}
+	}
+
+	where, args := chRangeCondition(v.pk, check.From, check.To)
+	// Wait for the mutation on every replica before copying the range again
+	mutationCtx := clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{"mutations_sync": 2}))
+	if _, err := v.ch.ExecContext(mutationCtx, "ALTER TABLE "+QuoteIdentifier(v.table)+" DELETE"+where, args...); err != nil {
+		if ok {
+			memory.release(memory.cost(rowSize(first)))
+			memory.drain(stream.RowChan)
+		}
+		fail(fmt.Errorf("failed to delete range: %w", err))
+		return false
+	}
+
+	if ok {
+		// Hand the row read before the delete on to the inserter with the rest
+		rows := make(chan []any, 1)
+		rows <- first
+		go func() {
+			defer close(rows)
+			for row := range stream.RowChan {
+				select {
+				case rows <- row:
+				case <-ctx.Done():
+					memory.release(memory.cost(rowSize(row)))
+				}
+			}
+		}()
+		if _, err := InsertRowsStreaming(ctx, chURL, v.table, GetColumnNames(stream.Columns), rows, opts.BatchSize, opts.Insert); err != nil {
+			fail(fmt.Errorf("range emptied, failed to insert it again: %w", err))
+			return true
+		}
+		if err := <-stream.ErrChan; err != nil {
+			fail(fmt.Errorf("range emptied, failed to extract it again: %w", err))
+			return true
+		}
+	}
+
+	recheck, err := v.compareRange(ctx, check.From, check.To)
+	if err != nil {
+		fail(err)
+		return false
+	}
+	if recheck != nil {
+		fail(fmt.Errorf("range still differs after repair: %d rows in PostgreSQL, %d in ClickHouse", recheck.PostgresRows, recheck.ClickHouseRows))
+		return false
+	}
+	check.Repaired = true
+	return false
+}
+
+// clickHouseEngine returns the engine of a table of the current database
+func clickHouseEngine(ctx context.Context, conn *sql.DB, table string) (engine string, exists bool, err error) {
+	err = conn.QueryRowContext(ctx,
+		`SELECT engine FROM system.tables WHERE database = currentDatabase() AND name = ?`,
+		table).Scan(&engine)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up ClickHouse table: %w", err)
+	}
+	return engine, true, nil
+}
@@ -0,0 +1,57 @@
+package etl
+
+import (
+	"context"
+	"time"
+
+	"github.com/pixperk/chug/internal/metrics"
+	"golang.org/x/sync/semaphore"
+)
+
+// WorkerBudget bounds the batch inserts running at once across all tables.
+// Every table keeps its own insert workers, but a worker holds a slot of the
+// budget while it inserts. A nil *WorkerBudget is unbounded.
+type WorkerBudget struct {
+	sem   *semaphore.Weighted
+	limit int
+}
+
+// NewWorkerBudget returns a budget of limit concurrent inserts
+func NewWorkerBudget(limit int) *WorkerBudget {
+	return &WorkerBudget{sem: semaphore.NewWeighted(int64(limit)), limit: limit}
+}
+
+// Limit returns the number of slots, 0 when unbounded
+func (b *WorkerBudget) Limit() int {
+	if b == nil {
+		return 0
+	}
+	return b.limit
+}
+
+// acquire takes a slot, waiting until one is free or ctx ends. Time spent
+// waiting is recorded against the worker stage of m.
+func (b *WorkerBudget) acquire(ctx context.Context, m *metrics.Table) error {
+	if b == nil {
+		return nil
+	}
+	if !b.sem.TryAcquire(1) {
+		start := time.Now()
+		err := b.sem.Acquire(ctx, 1)
+		m.Blocked(metrics.StageWorker, time.Since(start))
+		if err != nil {
+			return err
+		}
+	}
+	metrics.InsertWorkersBusy(1)
+	return nil
+}
+
+// release gives back a slot taken by acquire
+func (b *WorkerBudget) release() {
+	if b == nil {
+		return
+	}
+	b.sem.Release(1)
+	metrics.InsertWorkersBusy(-1)
+}
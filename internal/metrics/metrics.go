@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// CLIJob is the job_id label of tables loaded by chug ingest and chug poll
+const CLIJob = "cli"
+
+// Registry holds every chug metric plus the Go runtime and process collectors
+var Registry = prometheus.NewRegistry()
+
+// Metrics are labelled job_id rather than job, which Prometheus sets itself on scrape
+var tableLabels = []string{"job_id", "table"}
+
+var (
+	rowsExtracted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chug_rows_extracted_total",
+		Help: "Rows read from PostgreSQL, by the initial load and CDC polls.",
+	}, tableLabels)
+
+	rowsInserted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chug_rows_inserted_total",
+		Help: "Rows written to ClickHouse.",
+	}, tableLabels)
+
+	rowsDeadLettered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chug_rows_dead_lettered_total",
+		Help: "Rows written to the dead-letter queue.",
+	}, tableLabels)
+
+	batchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chug_batch_insert_duration_seconds",
+		Help:    "Time to insert one batch into ClickHouse, retries included.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 2, 12), // 10ms to ~20s
+	}, tableLabels)
+
+	insertRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chug_insert_retries_total",
+		Help: "Batch insert attempts that failed with a transient error and were retried.",
+	}, tableLabels)
+
+	insertErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chug_insert_errors_total",
+		Help: "Batch inserts that failed after all retries.",
+	}, tableLabels)
+
+	pollLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "chug_poll_lag_seconds",
+		Help: "Time since the newest delta column value seen by the CDC poller. Only set for timestamp delta columns.",
+	}, tableLabels)
+
+	lastPoll = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "chug_poll_last_success_timestamp_seconds",
+		Help: "Unix time of the last CDC poll that completed without error.",
+	}, tableLabels)
+
+	pipelineBlocked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "chug_pipeline_blocked_seconds_total",
+		Help: "Time a pipeline stage spent waiting: memory (extractor waiting for the memory budget), extract (extractor waiting for the batcher), batch (batcher waiting for an insert worker), worker (insert worker waiting for a global insert slot), insert (insert workers waiting for a batch).",
+	}, append(tableLabels, "stage"))
+
+	memoryLimit = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "chug_memory_budget_bytes",
+		Help: "Bytes of rows all tables may buffer between extraction and insertion.",
+	})
+
+	memoryBuffered = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "chug_memory_buffered_bytes",
+		Help: "Bytes of rows currently buffered between extraction and insertion, approximate.",
+	})
+
+	insertSlotsBusy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "chug_insert_workers_busy",
+		Help: "Batch inserts running across all tables, bounded by insert_workers.",
+	})
+
+	tablesQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "chug_tables_queued",
+		Help: "Tables not started yet, waiting for a slot under max_parallel_tables or for their dependencies.",
+	})
+
+	vectors = []interface{ DeletePartialMatch(prometheus.Labels) int }{
+		rowsExtracted, rowsInserted, rowsDeadLettered, batchDuration,
+		insertRetries, insertErrors, pollLag, lastPoll, pipelineBlocked,
+	}
+)
+
+// Pipeline stages whose waiting time is recorded
+const (
+	StageMemory  = "memory"
+	StageExtract = "extract"
+	StageBatch   = "batch"
+	StageWorker  = "worker"
+	StageInsert  = "insert"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		rowsExtracted, rowsInserted, rowsDeadLettered, batchDuration,
+		insertRetries, insertErrors, pollLag, lastPoll, pipelineBlocked,
+		memoryLimit, memoryBuffered, insertSlotsBusy, tablesQueued,
+		poolCollector{},
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Serve exposes /metrics on addr until the listener fails
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	err := http.ListenAndServe(addr, mux)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// DeleteJob drops every series of a job, so forgotten jobs stop being exported
+func DeleteJob(job string) {
+	for _, v := range vectors {
+		v.DeletePartialMatch(prometheus.Labels{"job_id": job})
+	}
+}
+
+// Table records the metrics of one table of one job. A nil *Table records nothing.
+type Table struct {
+	extracted prometheus.Counter
+	inserted  prometheus.Counter
+	dead      prometheus.Counter
+	batch     prometheus.Observer
+	retries   prometheus.Counter
+	errors    prometheus.Counter
+	pollLag   prometheus.Gauge
+	lastPoll  prometheus.Gauge
+	blocked   map[string]prometheus.Counter // by stage
+}
+
+// ForTable returns the metrics of table within job
+func ForTable(job, table string) *Table {
+	return &Table{
+		extracted: rowsExtracted.WithLabelValues(job, table),
+		inserted:  rowsInserted.WithLabelValues(job, table),
+		dead:      rowsDeadLettered.WithLabelValues(job, table),
+		batch:     batchDuration.WithLabelValues(job, table),
+		retries:   insertRetries.WithLabelValues(job, table),
+		errors:    insertErrors.WithLabelValues(job, table),
+		pollLag:   pollLag.WithLabelValues(job, table),
+		lastPoll:  lastPoll.WithLabelValues(job, table),
+		blocked: map[string]prometheus.Counter{
+			StageMemory:  pipelineBlocked.WithLabelValues(job, table, StageMemory),
+			StageExtract: pipelineBlocked.WithLabelValues(job, table, StageExtract),
+			StageBatch:   pipelineBlocked.WithLabelValues(job, table, StageBatch),
+			StageWorker:  pipelineBlocked.WithLabelValues(job, table, StageWorker),
+			StageInsert:  pipelineBlocked.WithLabelValues(job, table, StageInsert),
+		},
+	}
+}
+
+func (t *Table) RowsExtracted(n int) {
+	if t != nil {
+		t.extracted.Add(float64(n))
+	}
+}
+
+func (t *Table) RowsInserted(n int64) {
+	if t != nil {
+		t.inserted.Add(float64(n))
+	}
+}
+
+func (t *Table) RowsDeadLettered(n int64) {
+	if t != nil {
+		t.dead.Add(float64(n))
+	}
+}
+
+func (t *Table) BatchInserted(d time.Duration) {
+	if t != nil {
+		t.batch.Observe(d.Seconds())
+	}
+}
+
+func (t *Table) InsertRetried() {
+	if t != nil {
+		t.retries.Inc()
+	}
+}
+
+func (t *Table) InsertFailed() {
+	if t != nil {
+		t.errors.Inc()
+	}
+}
+
+// PollSucceeded records a completed poll. newest is the latest delta value
+// seen so far, zero when the delta column is not a timestamp.
+func (t *Table) PollSucceeded(newest time.Time) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.lastPoll.Set(float64(now.Unix()))
+	if !newest.IsZero() {
+		t.pollLag.Set(max(now.Sub(newest).Seconds(), 0))
+	}
+}
+
+// Blocked records time a pipeline stage of the table spent waiting
+func (t *Table) Blocked(stage string, d time.Duration) {
+	if t != nil {
+		t.blocked[stage].Add(d.Seconds())
+	}
+}
+
+// SetMemoryBudget records the size of the memory budget
+func SetMemoryBudget(bytes int64) {
+	memoryLimit.Set(float64(bytes))
+}
+
+// MemoryBuffered records bytes taken from (n > 0) or returned to (n < 0) the memory budget
+func MemoryBuffered(n int64) {
+	memoryBuffered.Add(float64(n))
+}
+
+// InsertWorkersBusy records insert slots taken (n > 0) or given back (n < 0)
+func InsertWorkersBusy(n int) {
+	insertSlotsBusy.Add(float64(n))
+}
+
+// TablesQueued records tables joining (n > 0) or leaving (n < 0) the table queue
+func TablesQueued(n int) {
+	tablesQueued.Add(float64(n))
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"github.com/pixperk/chug/internal/db"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var poolLabels = []string{"type", "database"}
+
+var (
+	poolMaxConns = prometheus.NewDesc("chug_pool_max_connections",
+		"Maximum connections of the pool.", poolLabels, nil)
+	poolOpenConns = prometheus.NewDesc("chug_pool_open_connections",
+		"Open connections, in use or idle.", poolLabels, nil)
+	poolInUseConns = prometheus.NewDesc("chug_pool_in_use_connections",
+		"Connections currently in use.", poolLabels, nil)
+	poolIdleConns = prometheus.NewDesc("chug_pool_idle_connections",
+		"Idle connections.", poolLabels, nil)
+	poolWaits = prometheus.NewDesc("chug_pool_waits_total",
+		"Connection requests that had to wait for a free connection.", poolLabels, nil)
+	poolWaitSeconds = prometheus.NewDesc("chug_pool_wait_seconds_total",
+		"Time spent waiting for a free connection.", poolLabels, nil)
+)
+
+// poolCollector reads pgxpool and sql.DB statistics of the open pools on every scrape
+type poolCollector struct{}
+
+func (poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{poolMaxConns, poolOpenConns, poolInUseConns, poolIdleConns, poolWaits, poolWaitSeconds} {
+		ch <- d
+	}
+}
+
+func (poolCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, stat := range db.Pools.PoolStats() {
+		gauge := func(desc *prometheus.Desc, kind string, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, kind, stat.Name)
+		}
+		counter := func(desc *prometheus.Desc, kind string, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, kind, stat.Name)
+		}
+
+		switch {
+		case stat.Postgres != nil:
+			s := stat.Postgres
+			gauge(poolMaxConns, "postgres", float64(s.MaxConns()))
+			gauge(poolOpenConns, "postgres", float64(s.TotalConns()))
+			gauge(poolInUseConns, "postgres", float64(s.AcquiredConns()))
+			gauge(poolIdleConns, "postgres", float64(s.IdleConns()))
+			counter(poolWaits, "postgres", float64(s.EmptyAcquireCount()))
+			counter(poolWaitSeconds, "postgres", s.EmptyAcquireWaitTime().Seconds())
+		case stat.ClickHouse != nil:
+			s := stat.ClickHouse
+			gauge(poolMaxConns, "clickhouse", float64(s.MaxOpenConnections))
+			gauge(poolOpenConns, "clickhouse", float64(s.OpenConnections))
+			gauge(poolInUseConns, "clickhouse", float64(s.InUse))
+			gauge(poolIdleConns, "clickhouse", float64(s.Idle))
+			counter(poolWaits, "clickhouse", float64(s.WaitCount))
+			counter(poolWaitSeconds, "clickhouse", s.WaitDuration.Seconds())
+		}
+	}
+}
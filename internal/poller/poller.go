@@ -6,8 +6,13 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/pixperk/chug/internal/db"
 	"github.com/pixperk/chug/internal/etl"
 	"github.com/pixperk/chug/internal/logx"
+	"github.com/pixperk/chug/internal/metrics"
+	"github.com/pixperk/chug/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -17,9 +22,22 @@ type PollConfig struct {
 	Interval  time.Duration
 	Limit     *int
 	StartFrom string
-	OnData    func(data *etl.TableData) error
+	Source    *db.CircuitBreaker // PostgreSQL health, fed by extract results
+	Target    *db.CircuitBreaker // ClickHouse health, polling pauses while open
+	Control   *etl.Control       // polling is skipped while paused
+	Metrics   *metrics.Table     // rows extracted, poll lag and last successful poll
+	Memory    *etl.MemoryBudget  // bounds the rows buffered by a cycle, nil = unbounded
+	// OnData consumes a cycle's rows from stream.RowChan, inserting them with
+	// Memory as their budget so the bytes they hold are given back
+	OnData func(ctx context.Context, stream *etl.StreamResult) error
+	// OnCheckpoint is called with the new last seen value once a cycle's rows
+	// are safely in ClickHouse, so it can be persisted and polling resumed from it
+	OnCheckpoint func(lastSeen string)
 }
 
+// deltaTimeLayout is how timestamp delta values are passed back to PostgreSQL
+const deltaTimeLayout = "2006-01-02 15:04:05.999999"
+
 type Poller struct {
 	conn   *pgxpool.Pool
 	config PollConfig
@@ -36,64 +54,166 @@ func (p *Poller) Start(ctx context.Context) error {
 	lastSeen := p.config.StartFrom
 	log := logx.StyledLog.With(zap.String("table", p.config.Table))
 
+	// Newest delta value as a time, for the poll lag metric
+	newest, _ := time.Parse(deltaTimeLayout, lastSeen)
+
 	ticker := time.NewTicker(p.config.Interval)
 	defer ticker.Stop()
 
 	log.Highlight(fmt.Sprintf("Poller started (interval: %v)", p.config.Interval))
 
+	paused := false
+	userPaused := false
 	for {
 		select {
 		case <-ctx.Done():
-			log.Info("Poller stopped (context cancelled)")
+			log.Info("Poller stopped (context cancelled)", zap.String("last_seen", lastSeen))
 			return ctx.Err()
 
 		case <-ticker.C:
+			if p.config.Control.Paused() {
+				if !userPaused {
+					log.Warn("Polling paused")
+					userPaused = true
+				}
+				continue
+			}
+			if userPaused {
+				log.Success("Polling resumed")
+				userPaused = false
+			}
+
+			if down := p.unavailableTarget(); down != "" {
+				if !paused {
+					log.Warn(fmt.Sprintf("Polling paused: %s unavailable", down))
+					paused = true
+				}
+				continue
+			}
+			if paused {
+				log.Success("Polling resumed")
+				paused = false
+			}
+
 			log.Info(fmt.Sprintf("Polling for changes (last_seen: %s)", lastSeen))
-			data, err := etl.ExtractTableDataSince(ctx, p.conn, p.config.Table, p.config.DeltaCol, lastSeen, p.config.Limit)
+			pollCtx, span := tracing.Tracer().Start(ctx, "poll", trace.WithNewRoot(), trace.WithAttributes(
+				tracing.TableKey.String(p.config.Table),
+				attribute.String("chug.last_seen", lastSeen),
+			))
+			// Rows stream straight into OnData; the last one read gives the new last_seen
+			var rowCount int
+			var lastRow []any
+			pollCtx, cancelPoll := context.WithCancel(pollCtx)
+			stream, err := etl.ExtractTableDataSinceStreaming(pollCtx, p.conn, p.config.Table, p.config.DeltaCol, lastSeen, p.config.Limit, &etl.StreamOptions{
+				Memory:  p.config.Memory,
+				Metrics: p.config.Metrics,
+				OnRow: func(row []any, _ int64) {
+					rowCount++
+					lastRow = row
+				},
+			})
 			if err != nil {
+				cancelPoll()
+				if p.config.Source != nil {
+					etl.RecordHealth(p.config.Source, err)
+				}
 				log.Error(fmt.Sprintf("Failed to extract data: %v", err))
+				tracing.End(span, err)
+				continue
+			}
+
+			err = p.config.OnData(pollCtx, stream)
+			if err != nil {
+				cancelPoll()
+			}
+			// Closed once the extract has finished, so rowCount and lastRow are final
+			extractErr := <-stream.ErrChan
+			cancelPoll()
+			if p.config.Source != nil {
+				etl.RecordHealth(p.config.Source, extractErr)
+			}
+			span.SetAttributes(tracing.RowsKey.Int(rowCount))
+			if err == nil && extractErr != nil {
+				// Rows past the failure were not read: poll them again from the old last_seen
+				log.Error(fmt.Sprintf("Failed to extract data: %v", extractErr))
+				tracing.End(span, extractErr)
 				continue
 			}
-			if len(data.Rows) == 0 {
+			tracing.End(span, err)
+			if err != nil {
+				if ctx.Err() != nil {
+					// Stopped mid-cycle: keep the checkpoint so the rows are polled again
+					log.Warn("Poll cycle interrupted, not advancing last_seen", zap.String("last_seen", lastSeen))
+					continue
+				}
+				// Rows that were extracted may not have been inserted, so
+				// last_seen stays put either way
+				if etl.ClassifyError(err) != etl.ErrorFatal {
+					// Transient failure: retry the same rows on the next tick
+					log.Error(fmt.Sprintf("Failed to process data: %v", err))
+					continue
+				}
+				// Replaying the same rows would fail the same way
+				log.Error(fmt.Sprintf("Poller stopped: %v", err), zap.String("last_seen", lastSeen))
+				return fmt.Errorf("failed to process data: %w", err)
+			}
+			if rowCount == 0 {
 				log.Info("No new changes detected")
+				p.config.Metrics.PollSucceeded(newest)
 				continue
-			} //update last seen value
-			lastRow := data.Rows[len(data.Rows)-1]
-			for i, col := range data.Columns {
+			}
+
+			// Only advance last_seen once the rows are safely in ClickHouse
+			nextSeen := lastSeen
+			nextNewest := newest
+			for i, col := range stream.Columns {
 				if col.Name == p.config.DeltaCol {
 					switch v := lastRow[i].(type) {
 					case time.Time:
 						// Format as PostgreSQL-compatible timestamp
-						lastSeen = v.Format("2006-01-02 15:04:05.999999")
+						nextSeen = v.Format(deltaTimeLayout)
+						nextNewest = v
 					case string:
-						lastSeen = v
+						nextSeen = v
 					case int, int64:
-						lastSeen = fmt.Sprintf("%d", v)
+						nextSeen = fmt.Sprintf("%d", v)
 					case int32, int16, int8:
-						lastSeen = fmt.Sprintf("%d", v)
+						nextSeen = fmt.Sprintf("%d", v)
 					case uint, uint64, uint32, uint16, uint8:
-						lastSeen = fmt.Sprintf("%d", v)
+						nextSeen = fmt.Sprintf("%d", v)
 					case float64, float32:
-						lastSeen = fmt.Sprintf("%f", v)
+						nextSeen = fmt.Sprintf("%f", v)
 					default:
 						// Fallback: try to convert to time.Time first
 						if t, ok := v.(time.Time); ok {
-							lastSeen = t.Format("2006-01-02 15:04:05.999999")
+							nextSeen = t.Format("2006-01-02 15:04:05.999999")
 						} else {
-							lastSeen = fmt.Sprintf("%v", v)
+							nextSeen = fmt.Sprintf("%v", v)
 						}
 					}
 					break
 				}
 			}
 
-			log.Success(fmt.Sprintf("Found %d new rows", len(data.Rows)),
-				zap.String("last_seen", lastSeen))
+			log.Success(fmt.Sprintf("Synced %d new rows", rowCount),
+				zap.String("last_seen", nextSeen))
 
-			if err := p.config.OnData(data); err != nil {
-				log.Error(fmt.Sprintf("Failed to process data: %v", err))
-				continue
+			lastSeen = nextSeen
+			newest = nextNewest
+			p.config.Metrics.PollSucceeded(newest)
+			if p.config.OnCheckpoint != nil {
+				p.config.OnCheckpoint(lastSeen)
 			}
 		}
 	}
 }
+
+// unavailableTarget returns the name of the first database whose breaker is open
+func (p *Poller) unavailableTarget() string {
+	for _, b := range []*db.CircuitBreaker{p.config.Source, p.config.Target} {
+		if b != nil && b.IsOpen() {
+			return b.Status().Name
+		}
+	}
+	return ""
+}
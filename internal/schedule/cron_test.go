@@ -0,0 +1,81 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"* * * foo *",
+		"@weekdays",
+	}
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if c, err := Parse(expr); err == nil {
+				t.Errorf("Parse(%q) = %v, want error", expr, c)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	// 2025-01-01 is a Wednesday
+	tests := []struct {
+		expr string
+		from string
+		want string // "" for no match
+	}{
+		{"*/15 * * * *", "2025-01-01 10:07", "2025-01-01 10:15"},
+		{"*/15 * * * *", "2025-01-01 10:15", "2025-01-01 10:30"},
+		{"0 */6 * * *", "2025-01-01 07:00", "2025-01-01 12:00"},
+		{"5/20 * * * *", "2025-01-01 10:06", "2025-01-01 10:25"},
+		{"0,30 9-10 * * *", "2025-01-01 10:45", "2025-01-02 09:00"},
+		{"@daily", "2025-01-01 00:00", "2025-01-02 00:00"},
+		{"@HOURLY", "2025-01-01 23:59", "2025-01-02 00:00"},
+		{"0 9 * * mon-fri", "2025-01-03 10:00", "2025-01-06 09:00"},
+		{"0 0 * * 7", "2025-01-01 00:00", "2025-01-05 00:00"},
+		{"0 0 1 jan,jul *", "2025-02-01 00:00", "2025-07-01 00:00"},
+		{"0 0 31 * *", "2025-01-31 00:00", "2025-03-31 00:00"},
+		// Both day fields restricted: either one matching runs
+		{"0 0 13 * fri", "2025-01-01 00:00", "2025-01-03 00:00"},
+		{"0 0 29 2 *", "2025-01-01 00:00", "2028-02-29 00:00"},
+		{"0 0 30 2 *", "2025-01-01 00:00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr+" after "+tt.from, func(t *testing.T) {
+			c, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			got := c.Next(at(tt.from))
+			var want time.Time
+			if tt.want != "" {
+				want = at(tt.want)
+			}
+			if !got.Equal(want) {
+				t.Errorf("Next(%s) = %v, want %v", tt.from, got, want)
+			}
+		})
+	}
+}
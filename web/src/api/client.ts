@@ -1,28 +1,52 @@
 // HTTP client for API requests
 
+import type { ErrorCode, ErrorResponse, FieldError } from '../types/api';
+
 const API_BASE = import.meta.env.VITE_API_URL || 'http://localhost:8080';
+export const API_TOKEN: string | undefined = import.meta.env.VITE_API_TOKEN;
+
+const authHeaders = (): Record<string, string> =>
+  API_TOKEN ? { Authorization: `Bearer ${API_TOKEN}` } : {};
 
-class APIError extends Error {
+export class APIError extends Error {
   constructor(
     message: string,
     public status: number,
-    public statusText: string
+    public statusText: string,
+    public code?: ErrorCode,
+    public details: FieldError[] = []
   ) {
     super(message);
     this.name = 'APIError';
   }
 }
 
+// toAPIError reads the {error: {code, message}} envelope of a failed response,
+// falling back to the status text for responses not sent by chug
+const toAPIError = async (method: string, endpoint: string, res: Response): Promise<APIError> => {
+  try {
+    const body = (await res.json()) as ErrorResponse;
+    if (body?.error?.code) {
+      return new APIError(
+        `${method} ${endpoint} failed: ${body.error.message}`,
+        res.status,
+        res.statusText,
+        body.error.code,
+        body.error.details ?? []
+      );
+    }
+  } catch {
+    // Not JSON
+  }
+  return new APIError(`${method} ${endpoint} failed: ${res.statusText}`, res.status, res.statusText);
+};
+
 export const apiClient = {
   get: async <T>(endpoint: string): Promise<T> => {
-    const res = await fetch(`${API_BASE}${endpoint}`);
+    const res = await fetch(`${API_BASE}${endpoint}`, { headers: authHeaders() });
 
     if (!res.ok) {
-      throw new APIError(
-        `GET ${endpoint} failed: ${res.statusText}`,
-        res.status,
-        res.statusText
-      );
+      throw await toAPIError('GET', endpoint, res);
     }
 
     return res.json();
@@ -31,16 +55,12 @@ export const apiClient = {
   post: async <T>(endpoint: string, data: unknown): Promise<T> => {
     const res = await fetch(`${API_BASE}${endpoint}`, {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
+      headers: { 'Content-Type': 'application/json', ...authHeaders() },
       body: JSON.stringify(data),
     });
 
     if (!res.ok) {
-      throw new APIError(
-        `POST ${endpoint} failed: ${res.statusText}`,
-        res.status,
-        res.statusText
-      );
+      throw await toAPIError('POST', endpoint, res);
     }
 
     return res.json();
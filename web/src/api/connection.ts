@@ -1,5 +1,9 @@
 import { apiClient } from './client';
-import type { ConnectionTestResponse } from '../types/api';
+import type { ConnectionTestResponse, ConnectionsResponse } from '../types/api';
+
+export const fetchConnections = async (): Promise<ConnectionsResponse> => {
+  return apiClient.get<ConnectionsResponse>('/api/v1/connections');
+};
 
 export const testConnection = async (params: {
   pg_url?: string;
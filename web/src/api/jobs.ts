@@ -3,11 +3,24 @@ import type {
   IngestRequest,
   CreateJobResponse,
   JobsResponse,
+  JobsQuery,
   JobResponse,
+  JobActionResponse,
+  RetryJobRequest,
+  RetryJobResponse,
+  PollEventsResponse,
 } from '../types/api';
 
-export const fetchJobs = async (): Promise<JobsResponse> => {
-  return apiClient.get<JobsResponse>('/api/v1/jobs');
+export const fetchJobs = async (query: JobsQuery = {}): Promise<JobsResponse> => {
+  const params = new URLSearchParams();
+  if (query.status?.length) params.set('status', query.status.join(','));
+  if (query.table) params.set('table', query.table);
+  if (query.since) params.set('since', query.since);
+  if (query.limit) params.set('limit', String(query.limit));
+  if (query.cursor) params.set('cursor', query.cursor);
+  if (query.view) params.set('view', query.view);
+  const qs = params.toString();
+  return apiClient.get<JobsResponse>(qs ? `/api/v1/jobs?${qs}` : '/api/v1/jobs');
 };
 
 export const fetchJob = async (id: string): Promise<JobResponse> => {
@@ -17,3 +30,23 @@ export const fetchJob = async (id: string): Promise<JobResponse> => {
 export const createJob = async (req: IngestRequest): Promise<CreateJobResponse> => {
   return apiClient.post<CreateJobResponse>('/api/v1/ingest', req);
 };
+
+export type JobAction = 'cancel' | 'pause' | 'resume';
+
+export const controlJob = async (
+  id: string,
+  action: JobAction,
+  table?: string
+): Promise<JobActionResponse> => {
+  const query = table ? `?table=${encodeURIComponent(table)}` : '';
+  return apiClient.post<JobActionResponse>(`/api/v1/jobs/${id}/${action}${query}`, {});
+};
+
+export const retryJob = async (id: string, req: RetryJobRequest = {}): Promise<RetryJobResponse> => {
+  return apiClient.post<RetryJobResponse>(`/api/v1/jobs/${id}/retry`, req);
+};
+
+// Long-polls for the updates of a job after since, waiting up to timeout seconds
+export const pollJobEvents = async (id: string, since = 0, timeout = 30): Promise<PollEventsResponse> => {
+  return apiClient.get<PollEventsResponse>(`/api/v1/jobs/${id}/events/poll?since=${since}&timeout=${timeout}`);
+};
@@ -0,0 +1,10 @@
+import { apiClient } from './client';
+import type { CreateScheduleRequest, ScheduleResponse, SchedulesResponse } from '../types/api';
+
+export const fetchSchedules = async (): Promise<SchedulesResponse> => {
+  return apiClient.get<SchedulesResponse>('/api/v1/schedules');
+};
+
+export const createSchedule = async (req: CreateScheduleRequest): Promise<ScheduleResponse> => {
+  return apiClient.post<ScheduleResponse>('/api/v1/schedules', req);
+};
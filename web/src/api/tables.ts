@@ -1,7 +1,41 @@
 import { apiClient } from './client';
-import type { TablesResponse } from '../types/api';
+import type { TablesResponse, PreviewResponse, VerifyResponse } from '../types/api';
 
-export const fetchTables = async (pgUrl?: string): Promise<TablesResponse> => {
-  const params = pgUrl ? `?pg_url=${encodeURIComponent(pgUrl)}` : '';
-  return apiClient.get<TablesResponse>(`/api/v1/tables${params}`);
+export const fetchTables = async (pgUrl?: string, pgConnection?: string): Promise<TablesResponse> => {
+  const params = new URLSearchParams();
+  if (pgConnection) params.append('connection', pgConnection);
+  else if (pgUrl) params.append('pg_url', pgUrl);
+  const query = params.toString();
+  return apiClient.get<TablesResponse>(`/api/v1/tables${query ? `?${query}` : ''}`);
+};
+
+// DDL dry-run: what chug would create for table, without creating it
+export const previewTable = async (
+  table: string,
+  opts: { pgConnection?: string; chConnection?: string; deltaColumn?: string } = {}
+): Promise<PreviewResponse> => {
+  const params = new URLSearchParams();
+  if (opts.pgConnection) params.append('connection', opts.pgConnection);
+  if (opts.chConnection) params.append('ch_connection', opts.chConnection);
+  if (opts.deltaColumn) params.append('delta_column', opts.deltaColumn);
+  const query = params.toString();
+  return apiClient.get<PreviewResponse>(
+    `/api/v1/tables/${encodeURIComponent(table)}/preview${query ? `?${query}` : ''}`
+  );
+};
+
+// Compares table in PostgreSQL and ClickHouse; repair re-ingests the ranges that differ
+export const verifyTable = async (
+  table: string,
+  opts: { pgConnection?: string; chConnection?: string; chunkSize?: number; repair?: boolean } = {}
+): Promise<VerifyResponse> => {
+  const params = new URLSearchParams();
+  if (opts.pgConnection) params.append('connection', opts.pgConnection);
+  if (opts.chConnection) params.append('ch_connection', opts.chConnection);
+  if (opts.chunkSize) params.append('chunk_size', String(opts.chunkSize));
+  const query = params.toString();
+  const endpoint = `/api/v1/tables/${encodeURIComponent(table)}/verify${query ? `?${query}` : ''}`;
+  return opts.repair
+    ? apiClient.post<VerifyResponse>(endpoint, undefined)
+    : apiClient.get<VerifyResponse>(endpoint);
 };
@@ -1,16 +1,21 @@
 import type { ProgressUpdate } from '../types/api';
+import { API_TOKEN } from './client';
 
 export class WebSocketManager {
   private ws: WebSocket | null = null;
   private listeners = new Set<(update: ProgressUpdate) => void>();
   private reconnectTimeout: number | null = null;
   private url: string;
+  private lastSeq: number | null = null;
 
   constructor() {
     // Determine WebSocket URL based on current location
     const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
     const host = window.location.host;
     this.url = `${protocol}//${host}/ws`;
+    if (API_TOKEN) {
+      this.url += `?access_token=${encodeURIComponent(API_TOKEN)}`;
+    }
   }
 
   connect() {
@@ -19,7 +24,9 @@ export class WebSocketManager {
     }
 
     try {
-      this.ws = new WebSocket(this.url);
+      // Replay whatever was missed while disconnected
+      const since = this.lastSeq !== null ? `${this.url.includes('?') ? '&' : '?'}since=${this.lastSeq}` : '';
+      this.ws = new WebSocket(this.url + since);
 
       this.ws.onopen = () => {
         console.log('WebSocket connected');
@@ -28,6 +35,8 @@ export class WebSocketManager {
       this.ws.onmessage = (event) => {
         try {
           const update: ProgressUpdate = JSON.parse(event.data);
+          if (this.lastSeq !== null && update.seq <= this.lastSeq) return;
+          this.lastSeq = update.seq;
           this.listeners.forEach(fn => fn(update));
         } catch (error) {
           console.error('Failed to parse WebSocket message:', error);
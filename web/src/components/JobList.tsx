@@ -5,6 +5,14 @@ import { Tabs, TabsList, TabsTrigger, TabsContent } from './ui/Tabs';
 import { useJobs } from '../hooks/useJobs';
 import type { IngestionJob, TableProgress, PollingConfig } from '../types/api';
 
+// formatETA renders seconds left as 45s, 12m or 1h 5m
+function formatETA(seconds: number): string {
+  if (seconds < 60) return `${Math.round(seconds)}s`;
+  const minutes = Math.round(seconds / 60);
+  if (minutes < 60) return `${minutes}m`;
+  return `${Math.floor(minutes / 60)}h ${minutes % 60}m`;
+}
+
 interface TableProgressItemProps {
   tableProgress: TableProgress;
   polling?: PollingConfig;
@@ -13,6 +21,7 @@ interface TableProgressItemProps {
 function TableProgressItem({ tableProgress, polling }: TableProgressItemProps) {
   const statusConfig = {
     pending: { icon: Clock, color: 'text-gray-400', bgColor: 'bg-gray-800/30' },
+    queued: { icon: Clock, color: 'text-gray-400', bgColor: 'bg-gray-800/30' },
     extracting: { icon: ArrowRight, color: 'text-blue-400', bgColor: 'bg-blue-500/10' },
     inserting: { icon: ArrowRight, color: 'text-accent', bgColor: 'bg-accent/10' },
     completed: { icon: CheckCircle2, color: 'text-success', bgColor: 'bg-success/10' },
@@ -37,7 +46,10 @@ function TableProgressItem({ tableProgress, polling }: TableProgressItemProps) {
         </div>
         <div className={`flex items-center gap-1.5 text-xs ${config.color}`}>
           <Icon className="w-3.5 h-3.5" />
-          <span className="capitalize">{tableProgress.status}</span>
+          <span className="capitalize">
+            {tableProgress.status}
+            {tableProgress.status === 'queued' && tableProgress.queue_position ? ` #${tableProgress.queue_position}` : ''}
+          </span>
         </div>
       </div>
 
@@ -57,9 +69,15 @@ function TableProgressItem({ tableProgress, polling }: TableProgressItemProps) {
       <div className="flex items-center justify-between text-xs">
         <span className="text-gray-500">
           {tableProgress.total_rows
-            ? `${(tableProgress.current_rows || 0).toLocaleString()} / ${tableProgress.total_rows.toLocaleString()} rows`
+            ? `${(tableProgress.current_rows || 0).toLocaleString()} / ${tableProgress.total_estimated ? '~' : ''}${tableProgress.total_rows.toLocaleString()} rows`
             : `${(tableProgress.current_rows || 0).toLocaleString()} rows`
           }
+          {tableProgress.status === 'inserting' && tableProgress.rows_per_sec
+            ? ` · ${Math.round(tableProgress.rows_per_sec).toLocaleString()} rows/s`
+            : ''}
+          {tableProgress.status === 'inserting' && tableProgress.eta_seconds
+            ? ` · ETA ${formatETA(tableProgress.eta_seconds)}`
+            : ''}
         </span>
         {(tableProgress.percentage || 0) > 0 && (
           <span className="font-medium text-accent">
@@ -128,13 +146,24 @@ function JobItem({ job }: { job: IngestionJob }) {
               : update.phase as any || 'extracting',
         current_rows: update.current_rows || update.row_count || 0,
         total_rows: update.total_rows,
+        total_estimated: update.total_estimated,
         percentage: update.percentage || 0,
+        rows_per_sec: update.rows_per_sec,
+        eta_seconds: update.eta_seconds,
         error: update.event === 'error' ? update.message : undefined,
         latest_update: update,
       });
     }
   });
 
+  // The job's queue is current, queued updates only hold the position at the time
+  (job.queued || []).forEach((tableName, i) => {
+    const current = tableProgressMap.get(tableName);
+    if (current) {
+      tableProgressMap.set(tableName, { ...current, status: 'queued', queue_position: i + 1 });
+    }
+  });
+
   const tableProgressList = Array.from(tableProgressMap.values());
   const completedTables = tableProgressList.filter(t => t.status === 'completed').length;
   const failedTables = tableProgressList.filter(t => t.status === 'failed').length;
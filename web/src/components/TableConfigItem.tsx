@@ -11,11 +11,16 @@ interface TableConfigItemProps {
   onChange: (config: Omit<TableConfigRequest, 'name'>) => void;
   onRemove: () => void;
   pgUrl?: string;
+  pgConnection?: string;
 }
 
-export function TableConfigItem({ tableName, config, onChange, onRemove, pgUrl }: TableConfigItemProps) {
+export function TableConfigItem({ tableName, config, onChange, onRemove, pgUrl, pgConnection }: TableConfigItemProps) {
   const [isExpanded, setIsExpanded] = useState(false);
-  const { data: columnsData } = useColumns(tableName, config.polling?.enabled ? pgUrl : undefined);
+  const { data: columnsData } = useColumns(
+    tableName,
+    config.polling?.enabled ? pgUrl : undefined,
+    config.polling?.enabled ? pgConnection : undefined
+  );
 
   const updateConfig = (updates: Partial<Omit<TableConfigRequest, 'name'>>) => {
     onChange({ ...config, ...updates });
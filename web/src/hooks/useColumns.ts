@@ -1,10 +1,10 @@
 import { useQuery } from '@tanstack/react-query';
 import { fetchColumns } from '../api/columns';
 
-export function useColumns(table: string, pgUrl?: string) {
+export function useColumns(table: string, pgUrl?: string, pgConnection?: string) {
   return useQuery({
-    queryKey: ['columns', table, pgUrl],
-    queryFn: () => fetchColumns(table, pgUrl),
+    queryKey: ['columns', table, pgUrl, pgConnection],
+    queryFn: () => fetchColumns(table, pgUrl, pgConnection),
     enabled: !!table, // Only fetch if table is specified
   });
 }
@@ -0,0 +1,10 @@
+import { useQuery } from '@tanstack/react-query';
+import { fetchConnections } from '../api/connection';
+
+export function useConnections() {
+  return useQuery({
+    queryKey: ['connections'],
+    queryFn: fetchConnections,
+    staleTime: Infinity, // Profiles only change when the server restarts
+  });
+}
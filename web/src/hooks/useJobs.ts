@@ -4,7 +4,7 @@ import { fetchJobs, createJob } from '../api/jobs';
 export function useJobs() {
   return useQuery({
     queryKey: ['jobs'],
-    queryFn: fetchJobs,
+    queryFn: () => fetchJobs(),
     // WebSocket provides real-time updates, no need for polling
     // Only refetch on window focus if data is stale
     staleTime: 30000, // 30 seconds
@@ -1,10 +1,10 @@
 import { useQuery } from '@tanstack/react-query';
 import { fetchTables } from '../api/tables';
 
-export function useTables(pgUrl?: string) {
+export function useTables(pgUrl?: string, pgConnection?: string) {
   return useQuery({
-    queryKey: ['tables', pgUrl],
-    queryFn: () => fetchTables(pgUrl),
+    queryKey: ['tables', pgUrl, pgConnection],
+    queryFn: () => fetchTables(pgUrl, pgConnection),
     enabled: false, // Only fetch when manually triggered
   });
 }
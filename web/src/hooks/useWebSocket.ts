@@ -1,37 +1,74 @@
 import { useEffect, useRef } from 'react';
 import { useQueryClient } from '@tanstack/react-query';
 import type { ProgressUpdate, IngestionJob, TableProgress } from '../types/api';
+import { API_TOKEN } from '../api/client';
 
 export function useWebSocket() {
   const wsRef = useRef<WebSocket | null>(null);
   const queryClient = useQueryClient();
   const reconnectTimeoutRef = useRef<number>();
+  const lastSeqRef = useRef<number | null>(null);
+  const eventSourceRef = useRef<EventSource | null>(null);
 
   useEffect(() => {
+    let failedAttempts = 0;
+
+    const receive = (data: string) => {
+      try {
+        const update: ProgressUpdate = JSON.parse(data);
+        if (lastSeqRef.current !== null && update.seq <= lastSeqRef.current) return;
+        lastSeqRef.current = update.seq;
+        handleProgressUpdate(update);
+      } catch (error) {
+        console.error('Failed to parse progress update:', error);
+      }
+    };
+
+    // Falls back to Server-Sent Events when proxies block WebSocket upgrades
+    const connectEventSource = () => {
+      const params = new URLSearchParams();
+      if (lastSeqRef.current !== null) params.set('since', String(lastSeqRef.current));
+      if (API_TOKEN) params.set('access_token', API_TOKEN);
+      const query = params.toString();
+      const es = new EventSource(`/api/v1/events${query ? `?${query}` : ''}`);
+      es.onopen = () => {
+        console.log('Event stream connected');
+      };
+      // EventSource reconnects by itself, resuming with Last-Event-ID
+      es.onmessage = (event) => receive(event.data);
+      eventSourceRef.current = es;
+    };
+
     const connect = () => {
       const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-      const ws = new WebSocket(`${protocol}//${window.location.host}/ws`);
-
+      const params = new URLSearchParams();
+      // Replay whatever was missed while disconnected
+      if (lastSeqRef.current !== null) params.set('since', String(lastSeqRef.current));
+      if (API_TOKEN) params.set('access_token', API_TOKEN);
+      const query = params.toString();
+      const ws = new WebSocket(`${protocol}//${window.location.host}/ws${query ? `?${query}` : ''}`);
+
+      let opened = false;
       ws.onopen = () => {
+        opened = true;
+        failedAttempts = 0;
         console.log('WebSocket connected');
       };
 
-      ws.onmessage = (event) => {
-        try {
-          const update: ProgressUpdate = JSON.parse(event.data);
-          handleProgressUpdate(update);
-        } catch (error) {
-          console.error('Failed to parse WebSocket message:', error);
-        }
-      };
+      ws.onmessage = (event) => receive(event.data);
 
       ws.onerror = (error) => {
         console.error('WebSocket error:', error);
       };
 
       ws.onclose = () => {
-        console.log('WebSocket disconnected, reconnecting in 3s...');
         wsRef.current = null;
+        if (!opened && ++failedAttempts >= 2) {
+          console.log('WebSocket unavailable, switching to Server-Sent Events');
+          connectEventSource();
+          return;
+        }
+        console.log('WebSocket disconnected, reconnecting in 3s...');
         reconnectTimeoutRef.current = setTimeout(connect, 3000);
       };
 
@@ -87,8 +124,10 @@ export function useWebSocket() {
         clearTimeout(reconnectTimeoutRef.current);
       }
       if (wsRef.current) {
+        wsRef.current.onclose = null;
         wsRef.current.close();
       }
+      eventSourceRef.current?.close();
     };
   }, [queryClient]);
 
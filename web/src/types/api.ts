@@ -1,39 +1,53 @@
 // TypeScript types matching Go API structs
 
 export interface ProgressUpdate {
+  seq: number;            // Increases with every update, resume with /ws?since=<seq>
   job_id: string;
   table: string;
-  event: 'started' | 'extracting' | 'inserting' | 'completed' | 'error';
+  event: 'queued' | 'started' | 'extracting' | 'inserting' | 'completed' | 'error';
   message: string;
   row_count?: number;      // Total rows processed for this table
-  current_rows?: number;   // Current batch/progress
-  total_rows?: number;     // Expected total (from limit)
+  current_rows?: number;   // Rows committed to ClickHouse so far
+  extracted_rows?: number; // Rows read from PostgreSQL so far
+  total_rows?: number;     // Expected total, from COUNT(*), the planner estimate or the limit
+  total_estimated?: boolean; // total_rows is an estimate
   percentage?: number;     // Completion percentage
-  phase?: string;          // extracting, inserting, completed
+  rows_per_sec?: number;   // Rows inserted per second
+  bytes_per_sec?: number;  // Approximate uncompressed bytes inserted per second
+  eta_seconds?: number;    // Estimated time left, absent when unknown
+  phase?: string;          // queued, extracting, inserting, completed
+  queue_position?: number; // Position of a queued table, 1 = first in line
+  dead_lettered?: number;  // Rows written to the dead-letter queue
   duration?: string;
   timestamp: string;
 }
 
 export interface TableResult {
   name: string;
-  rows: number;
+  rows: number;            // Rows committed to ClickHouse
+  extracted_rows?: number; // Rows read from PostgreSQL
+  dead_lettered?: number;
   duration: string;
   error?: string;
 }
 
 export interface TableProgress {
   name: string;
-  status: 'pending' | 'extracting' | 'inserting' | 'completed' | 'failed';
+  status: 'pending' | 'queued' | 'extracting' | 'inserting' | 'completed' | 'failed';
   current_rows: number;
   total_rows?: number;
+  total_estimated?: boolean;
   percentage: number;
+  rows_per_sec?: number;
+  eta_seconds?: number;
+  queue_position?: number; // Set while the table waits for a slot
   error?: string;
   latest_update?: ProgressUpdate;
 }
 
 export interface IngestionJob {
   id: string;
-  status: 'pending' | 'running' | 'completed' | 'failed';
+  status: 'pending' | 'running' | 'paused' | 'cancelling' | 'cancelled' | 'completed' | 'failed';
   tables: string[];
   table_configs?: TableConfigRequest[]; // Table configurations for UI display
   results: TableResult[];
@@ -41,6 +55,13 @@ export interface IngestionJob {
   start_time: string;
   end_time?: string;
   error?: string;
+  polling_tables?: string[]; // Tables with an active CDC poller
+  queued?: string[]; // Tables not started yet, waiting for a slot or their dependencies
+  retry_of?: string; // Job this job retries
+  retries?: string[]; // Jobs that retried this job
+  trace_id?: string; // Trace of the job span, set when tracing is enabled
+  schedule_id?: string; // Schedule that started this job
+  checkpoints?: Record<string, string>; // Last delta value synced by each table's poller
   table_progress?: Map<string, TableProgress>; // Client-side only for tracking
 }
 
@@ -50,20 +71,60 @@ export interface PollingConfig {
   interval_seconds: number;
 }
 
+export interface ErrorPolicy {
+  mode: 'fail' | 'dlq';
+  dlq?: 'file' | 'clickhouse';
+  dlq_path?: string;
+  max_errors?: number;
+}
+
+export interface RetryPolicy {
+  max_attempts?: number;
+  base_delay_ms?: number;
+  max_delay_ms?: number;
+  throttle_delay_ms?: number;
+  jitter?: boolean;
+}
+
+// What happens to the rows already in ClickHouse: kept, deleted first, or
+// replaced atomically from a staging table once the load completes
+export type LoadMode = 'append' | 'truncate' | 'replace';
+
+// Statements run around a table's load, in order
+export interface SQLHooks {
+  postgres?: string[];
+  clickhouse?: string[];
+}
+
 export interface TableConfigRequest {
   name: string;
   limit?: number;
   batch_size?: number;
+  exact_count?: boolean; // Progress totals from COUNT(*) instead of the planner estimate
+  priority?: number;     // Higher starts first, default 0
+  load_mode?: LoadMode;
+  depends_on?: string[]; // Tables of the same request that must load first
+  pre_sql?: SQLHooks;    // Needs server.allow_sql_hooks
+  post_sql?: SQLHooks;
   polling?: PollingConfig;
+  error_policy?: ErrorPolicy;
+  retry?: RetryPolicy;
 }
 
 export interface IngestRequest {
   tables: TableConfigRequest[];
-  pg_url?: string;
+  pg_connection?: string; // Name of a server-side connection profile
+  ch_connection?: string;
+  pg_url?: string;        // Raw URLs, when the server allows them
   ch_url?: string;
   limit?: number;        // Default for tables without specific config
   batch_size?: number;   // Default batch size
+  exact_count?: boolean; // Default for tables without exact_count
+  load_mode?: LoadMode;  // Default for tables without load_mode, append if absent
   polling?: PollingConfig; // Default polling config
+  error_policy?: ErrorPolicy; // Default error policy
+  retry?: RetryPolicy;        // Default retry policy
+  max_parallel_tables?: number; // Tables of the job loading at once, default the server's setting
 }
 
 export interface ConnectionTestResult {
@@ -81,6 +142,17 @@ export interface Column {
   data_type: string;
 }
 
+export interface ConnectionInfo {
+  name: string;
+  type: 'postgres' | 'clickhouse';
+  default: boolean;
+}
+
+export interface ConnectionsResponse {
+  connections: ConnectionInfo[];
+  raw_urls_allowed: boolean;
+}
+
 export interface TablesResponse {
   tables: string[];
 }
@@ -89,8 +161,85 @@ export interface ColumnsResponse {
   columns: Column[];
 }
 
+export interface ColumnPlan {
+  name: string;
+  postgres_type: string;
+  clickhouse_type?: string; // Absent when the type is not supported
+  warning?: string; // The conversion may lose data or fail
+}
+
+export interface ColumnDiff {
+  name: string;
+  change: 'missing' | 'extra' | 'mismatch';
+  planned?: string;
+  existing?: string;
+}
+
+export interface TablePlan {
+  table: string;
+  ddl?: string; // Absent when the DDL cannot be built, see warnings
+  engine: 'MergeTree' | 'ReplacingMergeTree';
+  primary_key?: string[];
+  columns: ColumnPlan[];
+  estimated_rows: number; // pg_class.reltuples, -1 when never analyzed
+  exists: boolean; // The ClickHouse table exists, so the DDL is a no-op
+  existing_engine?: string;
+  diff?: ColumnDiff[];
+  warnings?: string[];
+}
+
+export interface PreviewResponse {
+  preview: TablePlan;
+}
+
+export interface AggregateCheck {
+  column: string;
+  aggregate: 'null_or_default' | 'min' | 'max' | 'sum';
+  postgres: string;
+  clickhouse: string;
+  match: boolean;
+}
+
+// Primary key range (from, to] whose checksums differ
+export interface RangeCheck {
+  from?: number; // Absent for the start of the table
+  to?: number; // Absent for the end of the table
+  postgres_rows: number;
+  clickhouse_rows: number;
+  repaired?: boolean;
+  repair_error?: string;
+}
+
+export interface VerifyReport {
+  table: string;
+  final: boolean; // ClickHouse was read with FINAL (ReplacingMergeTree)
+  postgres_rows: number;
+  clickhouse_rows: number;
+  aggregates?: AggregateCheck[];
+  primary_key?: string; // Absent when checksums were skipped
+  ranges: number;
+  mismatches?: RangeCheck[];
+  match: boolean; // Counts, aggregates and checksums agree, after any repair
+  warnings?: string[];
+  duration: string;
+}
+
+export interface VerifyResponse {
+  verification: VerifyReport;
+}
+
 export interface JobsResponse {
   jobs: IngestionJob[];
+  next_cursor?: string; // Pass as cursor for the next page, absent on the last page
+}
+
+export interface JobsQuery {
+  status?: IngestionJob['status'][];
+  table?: string;
+  since?: string; // RFC 3339
+  limit?: number; // Default 50, at most 500
+  cursor?: string;
+  view?: 'summary' | 'detailed'; // summary keeps the latest progress update per table
 }
 
 export interface JobResponse {
@@ -100,3 +249,84 @@ export interface JobResponse {
 export interface CreateJobResponse {
   job_id: string;
 }
+
+export interface RetryJobRequest {
+  tables?: string[];
+  overrides?: TableConfigRequest[];
+}
+
+export interface RetryJobResponse {
+  job_id: string;
+  status: string;
+  retry_of: string;
+  tables: string[];
+}
+
+export interface PollEventsResponse {
+  updates: ProgressUpdate[];
+  next_since: number; // Pass as since on the next poll
+  done?: boolean;     // The job finished, no more updates will follow
+}
+
+export interface JobActionResponse {
+  job_id: string;
+  table?: string;
+  status: IngestionJob['status'];
+}
+
+export interface ScheduleRun {
+  time: string;
+  status: 'started' | 'skipped';
+  job_id: string; // Job started, or the job still active when the run was skipped
+}
+
+export interface Schedule {
+  id: string;
+  name?: string;
+  schedule: string; // Cron expression
+  source: 'config' | 'api';
+  tables: string[];
+  next_run?: string;
+  active_job?: string;
+  runs: ScheduleRun[]; // Most recent last
+}
+
+export interface CreateScheduleRequest {
+  name?: string;
+  schedule: string;
+  request: IngestRequest;
+}
+
+export interface SchedulesResponse {
+  schedules: Schedule[];
+}
+
+export interface ScheduleResponse {
+  schedule: Schedule;
+}
+
+export type ErrorCode =
+  | 'invalid_request'
+  | 'validation_failed'
+  | 'invalid_connection'
+  | 'unauthorized'
+  | 'forbidden'
+  | 'not_found'
+  | 'method_not_allowed'
+  | 'conflict'
+  | 'database_error'
+  | 'internal_error';
+
+export interface FieldError {
+  field: string; // JSON pointer into the body, or the query parameter name
+  message: string;
+}
+
+// Body of every non-2xx JSON response
+export interface ErrorResponse {
+  error: {
+    code: ErrorCode;
+    message: string;
+    details?: FieldError[];
+  };
+}